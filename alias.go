@@ -0,0 +1,321 @@
+package feature
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// aliasesFile is the name of the file holding the aliases of a tier, in the
+// gates directory.
+const aliasesFile = ".aliases"
+
+// Alias is a record mapping the former name of a gate to its current name,
+// which is left behind when gates are renamed so programs evaluating the gate
+// under its former name keep working.
+type Alias struct {
+	Family string
+	Gate   string
+
+	// The canonical name of the gate.
+	TargetFamily string
+	TargetGate   string
+}
+
+// String returns a representation of the alias as "family/gate -> family/gate".
+func (a Alias) String() string {
+	return a.Family + "/" + a.Gate + " -> " + a.TargetFamily + "/" + a.TargetGate
+}
+
+// ReadAliases returns the aliases of the tier, sorted by name.
+func (tier *Tier) ReadAliases() ([]Alias, error) {
+	return readAliases(tier.aliasesPath())
+}
+
+// CreateAlias creates an alias making the gate family/name resolve to the gate
+// targetFamily/targetName. Aliases cannot have the name of a gate of the tier.
+// If the target is itself an alias, the new alias points to its target.
+func (tier *Tier) CreateAlias(family, name, targetFamily, targetName string) error {
+	if err := validateFamilyGateNames(family, name); err != nil {
+		return err
+	}
+	if err := validateFamilyGateNames(targetFamily, targetName); err != nil {
+		return err
+	}
+	path := tier.aliasesPath()
+	return tier.update(path, func() error {
+		if err := tier.expectNoGate(family, name); err != nil {
+			return err
+		}
+		if err := mkdir(tier.pathTo("gates")); err != nil {
+			return err
+		}
+		aliases, err := readAliases(path)
+		if err != nil {
+			return err
+		}
+		aliases, err = addAlias(aliases, Alias{family, name, targetFamily, targetName})
+		if err != nil {
+			return err
+		}
+		return writeAliases(path, aliases)
+	})
+}
+
+// DeleteAlias deletes an alias of the tier, deleting an alias that does not
+// exist does nothing.
+func (tier *Tier) DeleteAlias(family, name string) error {
+	if err := validateFamilyGateNames(family, name); err != nil {
+		return err
+	}
+	path := tier.aliasesPath()
+	return tier.update(path, func() error {
+		aliases, err := readAliases(path)
+		if err != nil {
+			return err
+		}
+		n := len(aliases)
+		aliases = removeAlias(aliases, family, name)
+		if len(aliases) == n {
+			return nil
+		}
+		return writeAliases(path, aliases)
+	})
+}
+
+// RenameGate renames the gate family/name of the tier to newFamily/newName, and
+// leaves an alias behind. The salt, the configuration of each collection, the
+// metadata, and the state of the gate are retained.
+func (tier *Tier) RenameGate(family, name, newFamily, newName string) error {
+	if err := validateFamilyGateNames(family, name); err != nil {
+		return err
+	}
+	if err := validateFamilyGateNames(newFamily, newName); err != nil {
+		return err
+	}
+	if family == newFamily && name == newName {
+		return fmt.Errorf("%s/%s: cannot rename a gate to itself", family, name)
+	}
+	oldPath := tier.gatePath(family, name)
+	newPath := tier.gatePath(newFamily, newName)
+	aliasesPath := tier.aliasesPath()
+	return tier.lock(func() error {
+		if _, err := os.Stat(oldPath); err != nil {
+			return err
+		}
+		if err := tier.expectNoGate(newFamily, newName); err != nil {
+			return err
+		}
+		aliases, err := readAliases(aliasesPath)
+		if err != nil {
+			return err
+		}
+		// The new name may have been an alias (e.g. when reverting a rename),
+		// it is now the canonical name of the gate.
+		aliases = removeAlias(aliases, newFamily, newName)
+		if aliases, err = addAlias(aliases, Alias{family, name, newFamily, newName}); err != nil {
+			return err
+		}
+		if err := mkdir(tier.familyPath(newFamily)); err != nil {
+			return err
+		}
+		if err := os.Rename(oldPath, newPath); err != nil {
+			return err
+		}
+		if err := syncDir(tier.familyPath(family)); err != nil {
+			return err
+		}
+		if err := syncDir(tier.familyPath(newFamily)); err != nil {
+			return err
+		}
+		if err := writeAliases(aliasesPath, aliases); err != nil {
+			return err
+		}
+		return tier.path.updateManifest(oldPath, newPath, aliasesPath)
+	})
+}
+
+// RenameGate renames a gate in all the tiers where it exists, leaving aliases
+// behind (see Tier.RenameGate).
+//
+// The tiers are renamed in a copy of the database which then replaces it like
+// Builder.Commit does, so programs loading the database never see the gate
+// renamed in some tiers only. Changes made in place to the database while the
+// gate is renamed are lost.
+func (path MountPoint) RenameGate(family, name, newFamily, newName string) error {
+	b, err := path.NewBuilderFrom(path)
+	if err != nil {
+		return err
+	}
+	defer b.Abort()
+
+	if err := b.RenameGate(family, name, newFamily, newName); err != nil {
+		return err
+	}
+	return b.Commit()
+}
+
+// renameGate renames a gate in all the tiers of the database at path where it
+// exists, one tier at a time.
+func (path MountPoint) renameGate(family, name, newFamily, newName string) error {
+	found := false
+
+	err := Scan(path.Groups(), func(group string) error {
+		return Scan(path.Tiers(group), func(tier string) error {
+			t, err := path.OpenTier(group, tier)
+			if err != nil {
+				return err
+			}
+			defer t.Close()
+
+			if _, err := os.Stat(t.gatePath(family, name)); os.IsNotExist(err) {
+				return nil
+			}
+			found = true
+			return t.RenameGate(family, name, newFamily, newName)
+		})
+	})
+
+	if err == nil && !found {
+		err = &os.PathError{Op: "rename", Path: family + "/" + name, Err: os.ErrNotExist}
+	}
+	return err
+}
+
+func (tier *Tier) aliasesPath() string {
+	return filepath.Join(tier.pathTo("gates"), aliasesFile)
+}
+
+// expectNoGate returns an error if the gate family/name exists in the tier.
+func (tier *Tier) expectNoGate(family, name string) error {
+	_, err := os.Stat(tier.gatePath(family, name))
+	switch {
+	case err == nil:
+		return fmt.Errorf("%s/%s: gate already exists in tier %s/%s", family, name, tier.group, tier.name)
+	case os.IsNotExist(err):
+		return nil
+	default:
+		return err
+	}
+}
+
+// expectNoAlias returns an error if the gate family/name is an alias in the
+// tier.
+func (tier *Tier) expectNoAlias(family, name string) error {
+	aliases, err := readAliases(tier.aliasesPath())
+	if err != nil {
+		return err
+	}
+	for _, a := range aliases {
+		if a.Family == family && a.Gate == name {
+			return fmt.Errorf("%s/%s: gate name is an alias of %s/%s in tier %s/%s", family, name, a.TargetFamily, a.TargetGate, tier.group, tier.name)
+		}
+	}
+	return nil
+}
+
+// addAlias adds an alias to a sorted list of aliases. Aliases pointing to the
+// alias name are redirected to its target, so aliases are never chained.
+func addAlias(aliases []Alias, alias Alias) ([]Alias, error) {
+	for _, a := range aliases {
+		if a.Family == alias.TargetFamily && a.Gate == alias.TargetGate {
+			alias.TargetFamily, alias.TargetGate = a.TargetFamily, a.TargetGate
+		}
+	}
+	if alias.Family == alias.TargetFamily && alias.Gate == alias.TargetGate {
+		return nil, fmt.Errorf("%s/%s: gate cannot be an alias of itself", alias.Family, alias.Gate)
+	}
+
+	aliases = removeAlias(aliases, alias.Family, alias.Gate)
+	for i := range aliases {
+		if aliases[i].TargetFamily == alias.Family && aliases[i].TargetGate == alias.Gate {
+			aliases[i].TargetFamily, aliases[i].TargetGate = alias.TargetFamily, alias.TargetGate
+		}
+	}
+	aliases = append(aliases, alias)
+	sortAliases(aliases)
+	return aliases, nil
+}
+
+func removeAlias(aliases []Alias, family, name string) []Alias {
+	list := aliases[:0]
+	for _, a := range aliases {
+		if a.Family != family || a.Gate != name {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
+func sortAliases(aliases []Alias) {
+	sort.Slice(aliases, func(i, j int) bool {
+		if aliases[i].Family != aliases[j].Family {
+			return aliases[i].Family < aliases[j].Family
+		}
+		return aliases[i].Gate < aliases[j].Gate
+	})
+}
+
+// readAliases reads the aliases file at path, where each line maps the name
+// of an alias to the name of its target as "family/gate<tab>family/gate".
+func readAliases(path string) ([]Alias, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return nil, err
+	}
+
+	aliases := make([]Alias, 0)
+	line := 0
+	forEachLine(b, func(i, n int) {
+		if line++; err != nil {
+			return
+		}
+		s := bytes.TrimSpace(b[i : i+n])
+		if len(s) == 0 || s[0] == '#' {
+			return
+		}
+		k, v := splitKeyValue(s)
+		a := Alias{}
+		if a.Family, a.Gate, err = splitGateName(string(k)); err == nil {
+			a.TargetFamily, a.TargetGate, err = splitGateName(string(v))
+		}
+		if err != nil {
+			err = fmt.Errorf("%s:%d: %w", path, line, err)
+			return
+		}
+		aliases = append(aliases, a)
+	})
+
+	sortAliases(aliases)
+	return aliases, err
+}
+
+func writeAliases(path string, aliases []Alias) error {
+	if len(aliases) == 0 {
+		return unlink(path)
+	}
+	return writeFile(path, func(f *os.File) error {
+		for _, a := range aliases {
+			if _, err := fmt.Fprintf(f, "%s/%s\t%s/%s\n", a.Family, a.Gate, a.TargetFamily, a.TargetGate); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func splitGateName(s string) (family, gate string, err error) {
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return "", "", fmt.Errorf("malformed gate name: %q", s)
+	}
+	family, gate = s[:i], s[i+1:]
+	return family, gate, validateFamilyGateNames(family, gate)
+}
@@ -0,0 +1,277 @@
+package feature_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/feature"
+)
+
+func TestAlias(t *testing.T) {
+	tests := []gateTest{
+		{
+			scenario: "renaming a gate retains its configuration in all tiers",
+			function: testAliasRename,
+		},
+
+		{
+			scenario: "the former name of a renamed gate resolves to the new name in the cache",
+			function: testAliasCache,
+		},
+
+		{
+			scenario: "aliases of gates renamed multiple times point to the canonical name",
+			function: testAliasChain,
+		},
+
+		{
+			scenario: "gates cannot be created with the name of an alias",
+			function: testAliasCreateGate,
+		},
+
+		{
+			scenario: "gates renamed into another family are listed under their former name in that family",
+			function: testAliasMoved,
+		},
+
+		{
+			scenario: "aliases are ignored while a tier still has a gate under their name",
+			function: testAliasShadowed,
+		},
+
+		{
+			scenario: "stores resolve aliases as soon as they are opened",
+			function: testAliasStore,
+		},
+	}
+
+	runGateTests(t, tests, func(t testing.TB, path feature.MountPoint, tier *feature.Tier) {
+		tier2 := createTier(t, path, "standard", "2")
+		defer tier2.Close()
+
+		for _, tier := range []*feature.Tier{tier, tier2} {
+			populateCollection(t, createCollection(t, tier, "workspaces"), []string{"id-1", "id-2", "id-3", "id-4"})
+			createGate(t, tier, "family-A", "gate-1", "workspaces", 1234)
+			enableGate(t, tier, "family-A", "gate-1", "workspaces", 0.5, false)
+		}
+	})
+}
+
+func testAliasRename(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	if err := path.RenameGate("family-A", "gate-1", "family-B", "gate-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"1", "2"} {
+		tier, err := path.OpenTier("standard", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tier.Close()
+
+		open, salt, volume, err := tier.ReadGate("family-B", "gate-2", "workspaces")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if open || salt != "1234" || volume != 0.5 {
+			t.Errorf("gate configuration mismatch: open=%t salt=%s volume=%g", open, salt, volume)
+		}
+
+		if _, _, _, err := tier.ReadGate("family-A", "gate-1", "workspaces"); !os.IsNotExist(err) {
+			t.Errorf("the gate still exists under its former name: %v", err)
+		}
+
+		aliases, err := tier.ReadAliases()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectAliases(t, aliases, []string{"family-A/gate-1 -> family-B/gate-2"})
+	}
+
+	if err := path.RenameGate("family-A", "gate-1", "family-B", "gate-3"); !os.IsNotExist(err) {
+		t.Errorf("expected an error indicating that the gate does not exist, got %v", err)
+	}
+}
+
+func testAliasCache(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := make(map[string]bool)
+	for _, id := range []string{"id-1", "id-2", "id-3", "id-4"} {
+		before[id] = c.GateOpen("family-A", "gate-1", "workspaces", id)
+	}
+	c.Close()
+
+	if err := path.RenameGate("family-A", "gate-1", "family-A", "gate-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for id, open := range before {
+		expectGateIsEnabled(t, c, "family-A", "gate-1", "workspaces", id, open)
+		expectGateIsEnabled(t, c, "family-A", "gate-2", "workspaces", id, open)
+
+		if open {
+			expectGateLookup(t, c, "family-A", "workspaces", id, []string{"gate-2"})
+		}
+	}
+}
+
+func testAliasChain(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	for _, rename := range [][2]string{
+		{"gate-1", "gate-2"},
+		{"gate-2", "gate-3"},
+		{"gate-3", "gate-1"},
+	} {
+		if err := path.RenameGate("family-A", rename[0], "family-A", rename[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	aliases, err := tier.ReadAliases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectAliases(t, aliases, []string{
+		"family-A/gate-2 -> family-A/gate-1",
+		"family-A/gate-3 -> family-A/gate-1",
+	})
+
+	if err := tier.DeleteAlias("family-A", "gate-2"); err != nil {
+		t.Fatal(err)
+	}
+	if aliases, err = tier.ReadAliases(); err != nil {
+		t.Fatal(err)
+	}
+	expectAliases(t, aliases, []string{"family-A/gate-3 -> family-A/gate-1"})
+
+	if err := tier.CreateAlias("family-A", "gate-1", "family-A", "gate-3"); err == nil {
+		t.Error("creating an alias with the name of a gate did not fail")
+	}
+}
+
+func testAliasCreateGate(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	if err := path.RenameGate("family-A", "gate-1", "family-A", "gate-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tier.CreateGate("family-A", "gate-1", "workspaces", 1234); err == nil {
+		t.Error("creating a gate with the name of an alias did not fail")
+	}
+
+	expectProblems(t, string(path), validate(t, path), nil)
+}
+
+func testAliasMoved(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := make(map[string]bool)
+	for _, id := range []string{"id-1", "id-2", "id-3", "id-4"} {
+		before[id] = c.GateOpen("family-A", "gate-1", "workspaces", id)
+	}
+	c.Close()
+
+	if err := path.RenameGate("family-A", "gate-1", "family-B", "gate-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for id, open := range before {
+		var formerGates, gates []string
+		if open {
+			formerGates, gates = []string{"gate-1"}, []string{"gate-2"}
+		}
+		expectGateLookup(t, c, "family-A", "workspaces", id, formerGates)
+		expectGateLookup(t, c, "family-B", "workspaces", id, gates)
+	}
+}
+
+func testAliasShadowed(t *testing.T, path feature.MountPoint, tier1 *feature.Tier) {
+	tier2, err := path.OpenTier("standard", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tier2.Close()
+
+	// The gate is only renamed in the first tier, and closed in the second.
+	if err := tier1.RenameGate("family-A", "gate-1", "family-A", "gate-2"); err != nil {
+		t.Fatal(err)
+	}
+	enableGate(t, tier2, "family-A", "gate-1", "workspaces", 0, false)
+
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, id := range []string{"id-1", "id-2", "id-3", "id-4"} {
+		expectGateIsEnabled(t, c, "family-A", "gate-1", "workspaces", id, false)
+	}
+}
+
+func testAliasStore(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := make(map[string]bool)
+	for _, id := range []string{"id-1", "id-2", "id-3", "id-4"} {
+		before[id] = c.GateOpen("family-A", "gate-1", "workspaces", id)
+	}
+	c.Close()
+
+	if err := path.RenameGate("family-A", "gate-1", "family-B", "gate-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := path.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for id, open := range before {
+		if s.GateOpen("family-A", "gate-1", "workspaces", id) != open {
+			t.Errorf("%s: family-A/gate-1 was expected to be open=%t", id, open)
+		}
+
+		var gates []string
+		if open {
+			gates = []string{"gate-1"}
+		}
+		if found := s.LookupGates("family-A", "workspaces", id); !reflect.DeepEqual(found, gates) {
+			t.Errorf("%s: gates mismatch: want=%q got=%q", id, gates, found)
+		}
+	}
+}
+
+func expectAliases(t testing.TB, aliases []feature.Alias, want []string) {
+	t.Helper()
+
+	found := make([]string, len(aliases))
+	for i, a := range aliases {
+		found[i] = a.String()
+	}
+
+	if !reflect.DeepEqual(found, want) {
+		t.Error("aliases mismatch")
+		t.Logf("want: %q", want)
+		t.Logf("got:  %q", found)
+	}
+}
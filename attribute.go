@@ -0,0 +1,110 @@
+package feature
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Attribute is a key/value pair stored in a gate file in addition to the keys
+// interpreted by the package (open, salt, volume, start, end, ramp, buckets,
+// hash, and bucket-by).
+//
+// Attributes allow other tools to annotate gates, they are preserved when the
+// package rewrites gate files.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// ReadGateAttributes returns the attributes of a gate, in the order they
+// appear in the gate file.
+func (tier *Tier) ReadGateAttributes(family, name, collection string) ([]Attribute, error) {
+	if err := validateGateNames(family, name, collection); err != nil {
+		return nil, err
+	}
+	g, err := readGate(tier.gateCollectionPath(family, name, collection))
+	if err != nil {
+		return nil, err
+	}
+	return g.attributes(), nil
+}
+
+// ReadGateAttribute returns the value of a gate attribute, and a boolean
+// indicating whether the attribute was set.
+func (tier *Tier) ReadGateAttribute(family, name, collection, key string) (string, bool, error) {
+	attrs, err := tier.ReadGateAttributes(family, name, collection)
+	if err != nil {
+		return "", false, err
+	}
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return attr.Value, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// SetGateAttribute sets the value of a gate attribute. If the attribute
+// already exists its value is replaced in place, otherwise it is appended to
+// the gate file.
+//
+// Keys must not contain white spaces, start with '#', or be one of the keys
+// interpreted by the package. Values must not contain line breaks, and their
+// leading and trailing white spaces are not preserved.
+func (tier *Tier) SetGateAttribute(family, name, collection, key, value string) error {
+	if err := validateAttribute(key, value); err != nil {
+		return err
+	}
+	return tier.updateGate(family, name, collection, func(g *gate) { g.set(key, value) })
+}
+
+// DeleteGateAttribute removes an attribute from a gate. Deleting an attribute
+// that does not exist does nothing.
+func (tier *Tier) DeleteGateAttribute(family, name, collection, key string) error {
+	if err := validateAttribute(key, ""); err != nil {
+		return err
+	}
+	return tier.updateGate(family, name, collection, func(g *gate) { g.unset(key) })
+}
+
+// updateGate rewrites a gate after applying the modification made by do.
+func (tier *Tier) updateGate(family, name, collection string, do func(*gate)) error {
+	if err := validateGateNames(family, name, collection); err != nil {
+		return err
+	}
+	path := tier.gateCollectionPath(family, name, collection)
+	return tier.update(path, func() error {
+		g, err := readGate(path)
+		if err != nil {
+			return err
+		}
+		do(&g)
+		return tier.writeGate(path, g)
+	})
+}
+
+// writeGate writes a gate of the tier, refusing the keys which are not
+// supported by the format version of the database.
+func (tier *Tier) writeGate(path string, g gate) error {
+	if err := tier.path.checkGateFormat(path, g); err != nil {
+		return err
+	}
+	return writeGate(path, g)
+}
+
+func validateAttribute(key, value string) error {
+	switch {
+	case key == "":
+		return fmt.Errorf("invalid gate attribute: empty key")
+	case key[0] == '#':
+		return fmt.Errorf("invalid gate attribute %q: keys must not start with '#'", key)
+	case strings.IndexFunc(key, unicode.IsSpace) >= 0:
+		return fmt.Errorf("invalid gate attribute %q: keys must not contain white spaces", key)
+	case isGateKey(key):
+		return fmt.Errorf("invalid gate attribute %q: the key is reserved", key)
+	case strings.ContainsAny(value, "\r\n"):
+		return fmt.Errorf("invalid gate attribute %q: values must not contain line breaks", key)
+	}
+	return nil
+}
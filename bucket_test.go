@@ -0,0 +1,207 @@
+package feature_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/segmentio/feature"
+)
+
+func TestGateBucketBy(t *testing.T) {
+	tests := []gateTest{
+		{
+			scenario: "bucketing collections written to a tier can be read back",
+			function: testGateBucketByReadWrite,
+		},
+
+		{
+			scenario: "gates bucketing by another collection admit related ids together",
+			function: testGateBucketByEvaluate,
+		},
+
+		{
+			scenario: "gates only use bucketing keys of the collection they bucket by",
+			function: testGateBucketByCollection,
+		},
+
+		{
+			scenario: "invalid bucketing collections are reported by validation",
+			function: testGateBucketByValidate,
+		},
+	}
+
+	runGateTests(t, tests, func(t testing.TB, path feature.MountPoint, tier *feature.Tier) {
+		populateCollection(t, createCollection(t, tier, "sources"), makeIDs("source-%03d", 200))
+		createCollection(t, tier, "workspaces").Close()
+
+		for _, gate := range []string{"gate-1", "gate-2"} {
+			createGate(t, tier, "family-A", gate, "sources", 1234)
+			enableGate(t, tier, "family-A", gate, "sources", 0.5, false)
+		}
+	})
+}
+
+// workspaceOf returns the workspace of a source in the tests, each workspace
+// has 10 sources.
+func workspaceOf(source string) string {
+	var i int
+	fmt.Sscanf(source, "source-%03d", &i)
+	return fmt.Sprintf("workspace-%02d", i/10)
+}
+
+func testGateBucketByReadWrite(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	if err := tier.SetGateBucketBy("family-A", "gate-1", "sources", "workspaces"); err != nil {
+		t.Fatal(err)
+	}
+	expectGateBucketBy(t, tier, "workspaces")
+
+	b, err := ioutil.ReadFile(filepath.Join(string(path), "standard", "1", "gates", "family-A", "gate-1", "sources"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "open\tfalse\nsalt\t1234\nvolume\t0.5\nbucket-by\tworkspaces\n" {
+		t.Errorf("gate file mismatch:\n%s", s)
+	}
+
+	if err := tier.SetGateBucketBy("family-A", "gate-1", "sources", "../workspaces"); err == nil {
+		t.Error("setting an invalid collection name did not fail")
+	}
+
+	if err := tier.SetGateBucketBy("family-A", "gate-1", "sources", ""); err != nil {
+		t.Fatal(err)
+	}
+	expectGateBucketBy(t, tier, "")
+}
+
+func testGateBucketByEvaluate(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	if err := tier.SetGateBucketBy("family-A", "gate-1", "sources", "workspaces"); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	exposures := make(map[string]feature.Identifier)
+	c.SetExposureListener(feature.ExposureConfig{
+		Listener: feature.ExposureListenerFunc(func(e feature.Exposure) {
+			exposures[e.Gate+"/"+e.ID] = e.Key
+		}),
+	})
+
+	workspaces := make(map[string]bool)
+	split := make(map[bool]int)
+
+	for i := 0; i < 200; i++ {
+		source := fmt.Sprintf("source-%03d", i)
+		workspace := workspaceOf(source)
+		key := feature.Identifier{Collection: "workspaces", ID: workspace}
+
+		open := c.GateOpenKey("family-A", "gate-1", "sources", source, key)
+		if prev, ok := workspaces[workspace]; ok && prev != open {
+			t.Errorf("%s: sources of %s are not admitted together", source, workspace)
+		}
+		workspaces[workspace] = open
+		split[open]++
+
+		// Gates which do not bucket by another collection ignore the key, and
+		// evaluating without a key buckets by the id.
+		expectGateIsEnabled(t, c, "family-A", "gate-2", "sources", source, c.GateOpenKey("family-A", "gate-2", "sources", source, key))
+		if found := exposures["gate-1/"+source]; found != key {
+			t.Errorf("%s: exposure key mismatch: want %v, got %v", source, key, found)
+		}
+
+		var expect []string
+		for _, gate := range []string{"gate-1", "gate-2"} {
+			if c.GateOpenKey("family-A", gate, "sources", source, key) {
+				expect = append(expect, gate)
+			}
+		}
+		if gates := c.LookupGatesKey("family-A", "sources", source, key); fmt.Sprint(gates) != fmt.Sprint(expect) {
+			t.Errorf("%s: gates mismatch: want %q, got %q", source, expect, gates)
+		}
+	}
+
+	if split[true] == 0 || split[false] == 0 {
+		t.Errorf("the volume was not applied to workspaces: %v", split)
+	}
+
+	// Ids which are not in the collection get the default state of the gate,
+	// regardless of the key.
+	if c.GateOpenKey("family-A", "gate-1", "sources", "source-999", feature.Identifier{Collection: "workspaces", ID: "workspace-00"}) {
+		t.Error("the gate is open for an id which is not in the collection")
+	}
+}
+
+func testGateBucketByCollection(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	for gate, bucketBy := range map[string]string{"gate-1": "workspaces", "gate-2": "accounts"} {
+		if err := tier.SetGateBucketBy("family-A", gate, "sources", bucketBy); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened := make(map[string]bool)
+
+	for i := 0; i < 200; i++ {
+		source := fmt.Sprintf("source-%03d", i)
+		key := feature.Identifier{Collection: "workspaces", ID: workspaceOf(source)}
+
+		// Keys of other collections are ignored, the gates bucket by the id.
+		expectGateIsEnabled(t, c, "family-A", "gate-1", "sources", source, c.GateOpenKey("family-A", "gate-1", "sources", source, feature.Identifier{Collection: "accounts", ID: key.ID}))
+		expectGateIsEnabled(t, c, "family-A", "gate-2", "sources", source, c.GateOpenKey("family-A", "gate-2", "sources", source, key))
+
+		opened[source] = c.GateOpenKey("family-A", "gate-1", "sources", source, key) && c.GateOpen("family-A", "gate-2", "sources", source)
+	}
+	c.Close()
+
+	// Prerequisites which bucket by another collection do not use the key of
+	// the gate requiring them either.
+	if err := tier.SetGatePrerequisites("family-A", "gate-1", []string{"family-A/gate-2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err = path.Load(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for source, open := range opened {
+		key := feature.Identifier{Collection: "workspaces", ID: workspaceOf(source)}
+		if c.GateOpenKey("family-A", "gate-1", "sources", source, key) != open {
+			t.Errorf("%s: state mismatch: want %t", source, open)
+		}
+	}
+}
+
+func testGateBucketByValidate(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	for gate, bucketBy := range map[string]string{"gate-1": "sources", "gate-2": "accounts"} {
+		if err := tier.SetGateBucketBy("family-A", gate, "sources", bucketBy); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectProblems(t, string(path), validate(t, path), []string{
+		`standard/1/gates/family-A/gate-1/sources:4: warning: the gate buckets by its own collection "sources"`,
+		`standard/1/gates/family-A/gate-2/sources:4: warning: the gate buckets by collection "accounts" which does not exist in the tier`,
+	})
+}
+
+func expectGateBucketBy(t testing.TB, tier *feature.Tier, bucketBy string) {
+	t.Helper()
+
+	found, err := tier.ReadGateBucketBy("family-A", "gate-1", "sources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != bucketBy {
+		t.Errorf("bucketing collection mismatch: want %q, got %q", bucketBy, found)
+	}
+}
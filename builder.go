@@ -0,0 +1,468 @@
+package feature
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Builder is used to construct feature databases atomically.
+//
+// The builder stages the database in a temporary directory next to the target
+// mount point, and replaces the target with the staged directory when Commit
+// is called. Readers of the target never observe partial updates (on Linux the
+// directories are exchanged with renameat2(2), other platforms fallback to two
+// consecutive renames).
+//
+// Builders must be either committed or aborted, a common pattern is to defer
+// the call to Abort, which is a no-op after a successful commit:
+//
+//	b, err := path.NewBuilder()
+//	if err != nil {
+//		...
+//	}
+//	defer b.Abort()
+//	...
+//	if err := b.Commit(); err != nil {
+//		...
+//	}
+//
+type Builder struct {
+	target   MountPoint
+	staging  MountPoint
+	producer string
+	key      ed25519.PrivateKey
+	source   int // format version of the staged content
+	format   int // format version of the committed database
+	done     bool
+}
+
+// NewBuilder returns a Builder staging an empty database, which replaces the
+// content of the mount point it was called on when committed.
+//
+// If the mount point is a symbolic link, the directory that it points to is
+// replaced.
+func (path MountPoint) NewBuilder() (*Builder, error) {
+	return path.newBuilder("")
+}
+
+// NewBuilderFrom is like NewBuilder but the staged database is initialized
+// with a copy of the database at seed, which may be the target mount point.
+func (path MountPoint) NewBuilderFrom(seed MountPoint) (*Builder, error) {
+	return path.newBuilder(seed)
+}
+
+func (path MountPoint) newBuilder(seed MountPoint) (*Builder, error) {
+	target, err := resolve(string(path))
+	if err != nil {
+		return nil, err
+	}
+
+	staging, err := ioutil.TempDir(filepath.Dir(target), "."+filepath.Base(target)+".build-")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(staging, 0755); err != nil {
+		rmdir(staging)
+		return nil, err
+	}
+
+	b := &Builder{
+		target:  MountPoint(target),
+		staging: MountPoint(staging),
+		source:  MinFormatVersion,
+		format:  FormatVersion,
+	}
+
+	if seed != "" {
+		src, err := filepath.EvalSymlinks(string(seed))
+		if err == nil {
+			err = copyTree(staging, src)
+		}
+		if err == nil {
+			b.source, err = readFormat(staging)
+		}
+		if err == nil {
+			err = checkFormat(string(seed), b.source)
+		}
+		if err != nil {
+			b.Abort()
+			return nil, fmt.Errorf("seeding feature database from %s: %w", seed, err)
+		}
+		b.format = b.source
+	} else {
+		// The staged database declares the format from the start, so the
+		// keys introduced by the latest versions can be written to it.
+		if _, err := b.staging.writeManifest(b.producer, FormatVersion); err != nil {
+			b.Abort()
+			return nil, fmt.Errorf("writing manifest of feature database staged at %s: %w", b.staging, err)
+		}
+		b.source = FormatVersion
+	}
+
+	return b, nil
+}
+
+// Path returns the mount point where the database is staged.
+//
+// Programs may use the mount point to apply changes that the builder does not
+// expose methods for.
+func (b *Builder) Path() MountPoint {
+	return b.staging
+}
+
+// Target returns the mount point that the builder replaces when committed.
+func (b *Builder) Target() MountPoint {
+	return b.target
+}
+
+// CreateTier creates a tier in the staged database.
+func (b *Builder) CreateTier(group, name string) (*Tier, error) {
+	return b.staging.CreateTier(group, name)
+}
+
+// OpenTier opens a tier of the staged database.
+func (b *Builder) OpenTier(group, name string) (*Tier, error) {
+	return b.staging.OpenTier(group, name)
+}
+
+// DeleteTier deletes a tier from the staged database.
+func (b *Builder) DeleteTier(group, name string) error {
+	return b.staging.DeleteTier(group, name)
+}
+
+// DeleteGroup deletes a group of tiers from the staged database.
+func (b *Builder) DeleteGroup(group string) error {
+	return b.staging.DeleteGroup(group)
+}
+
+// CreateCollection creates a collection in a tier of the staged database,
+// creating the tier if it did not exist. The returned collection must be
+// closed before committing the builder.
+func (b *Builder) CreateCollection(group, tier, collection string) (*Collection, error) {
+	t, err := b.staging.CreateTier(group, tier)
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	return t.CreateCollection(collection)
+}
+
+// DeleteCollection deletes a collection from a tier of the staged database.
+func (b *Builder) DeleteCollection(group, tier, collection string) error {
+	return b.withTier(group, tier, func(t *Tier) error {
+		return t.DeleteCollection(collection)
+	})
+}
+
+// CreateGate creates a gate in a tier of the staged database, creating the
+// tier if it did not exist.
+func (b *Builder) CreateGate(group, tier, family, gate, collection string, salt uint32) error {
+	t, err := b.staging.CreateTier(group, tier)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+	return t.CreateGate(family, gate, collection, salt)
+}
+
+// EnableGate sets the volume and default state of a gate in a tier of the
+// staged database.
+func (b *Builder) EnableGate(group, tier, family, gate, collection string, volume float64, open bool) error {
+	return b.withTier(group, tier, func(t *Tier) error {
+		return t.EnableGate(family, gate, collection, volume, open)
+	})
+}
+
+// ScheduleGate sets the schedule of a gate in a tier of the staged database.
+func (b *Builder) ScheduleGate(group, tier, family, gate, collection string, start, end time.Time) error {
+	return b.withTier(group, tier, func(t *Tier) error {
+		return t.ScheduleGate(family, gate, collection, start, end)
+	})
+}
+
+// RampGate sets the ramp of a gate in a tier of the staged database.
+func (b *Builder) RampGate(group, tier, family, gate, collection string, ramp Ramp) error {
+	return b.withTier(group, tier, func(t *Tier) error {
+		return t.RampGate(family, gate, collection, ramp)
+	})
+}
+
+// SetGateBuckets sets the number of buckets of a gate in a tier of the staged
+// database.
+func (b *Builder) SetGateBuckets(group, tier, family, gate, collection string, buckets uint64) error {
+	return b.withTier(group, tier, func(t *Tier) error {
+		return t.SetGateBuckets(family, gate, collection, buckets)
+	})
+}
+
+// SetGateHash sets the hash algorithm of a gate in a tier of the staged
+// database.
+func (b *Builder) SetGateHash(group, tier, family, gate, collection, hash string) error {
+	return b.withTier(group, tier, func(t *Tier) error {
+		return t.SetGateHash(family, gate, collection, hash)
+	})
+}
+
+// SetGateBucketBy sets the collection that a gate buckets by in a tier of the
+// staged database.
+func (b *Builder) SetGateBucketBy(group, tier, family, gate, collection, bucketBy string) error {
+	return b.withTier(group, tier, func(t *Tier) error {
+		return t.SetGateBucketBy(family, gate, collection, bucketBy)
+	})
+}
+
+// DeleteGate deletes a gate from a tier of the staged database.
+func (b *Builder) DeleteGate(group, tier, family, gate, collection string) error {
+	return b.withTier(group, tier, func(t *Tier) error {
+		return t.DeleteGate(family, gate, collection)
+	})
+}
+
+// RenameGate renames a gate in all the tiers of the staged database, leaving
+// aliases behind so the former name of the gate resolves to the new one.
+func (b *Builder) RenameGate(family, gate, newFamily, newGate string) error {
+	return b.staging.renameGate(family, gate, newFamily, newGate)
+}
+
+func (b *Builder) withTier(group, tier string, do func(*Tier) error) error {
+	t, err := b.staging.OpenTier(group, tier)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+	return do(t)
+}
+
+// SetProducer sets the producer recorded in the manifest of the database,
+// which is DefaultProducer if it was never called.
+func (b *Builder) SetProducer(producer string) {
+	b.producer = producer
+}
+
+// SetFormat sets the layout version of the database when the builder is
+// committed or published, which is FormatVersion for builders created with
+// NewBuilder, and the version of the seed for builders created with
+// NewBuilderFrom.
+//
+// Upgrades are applied to the staged database immediately, so the features of
+// the new version can be used before committing. Downgrades are applied when
+// the builder is committed, and fail if the staged database uses features that
+// the older version does not support.
+func (b *Builder) SetFormat(version int) error {
+	if version < MinFormatVersion || version > FormatVersion {
+		return fmt.Errorf("unsupported format version %d, the supported versions are %d to %d", version, MinFormatVersion, FormatVersion)
+	}
+	if version > b.source {
+		if err := migrate(string(b.staging), b.source, version); err != nil {
+			return err
+		}
+		if _, err := b.staging.writeManifest(b.producer, version); err != nil {
+			return fmt.Errorf("writing manifest of feature database staged at %s: %w", b.staging, err)
+		}
+		b.source = version
+	}
+	b.format = version
+	return nil
+}
+
+// SetSigningKey sets the key used to sign the manifest of the database when
+// the builder is committed or published. Databases seeded with a signed copy
+// are left unsigned if the builder has no signing key, since their signature
+// would not match the new manifest.
+func (b *Builder) SetSigningKey(key ed25519.PrivateKey) {
+	b.key = key
+}
+
+// Commit writes the manifest of the staged database and validates it, then
+// atomically replaces the target mount point with it.
+//
+// If validation fails, the target is left untouched and the builder remains
+// usable, so the program may fix the issues and commit again.
+func (b *Builder) Commit() error {
+	if b.done {
+		return errBuilderDone
+	}
+
+	if err := b.seal(); err != nil {
+		return err
+	}
+
+	// Writers modifying the target in place hold a shared lock on it, taking
+	// the exclusive lock ensures that they are not interrupted by the swap.
+	err := b.target.lock(true, func() error {
+		return replace(string(b.target), string(b.staging))
+	})
+	if err != nil {
+		return fmt.Errorf("replacing feature database at %s: %w", b.target, err)
+	}
+
+	b.done = true
+	return nil
+}
+
+// Abort discards the staged database. Calling Abort after Commit or Abort
+// does nothing.
+func (b *Builder) Abort() error {
+	if b.done {
+		return nil
+	}
+	b.done = true
+	return rmdir(string(b.staging))
+}
+
+// seal converts the staged database to the target format, writes and signs
+// its manifest, then validates it.
+func (b *Builder) seal() error {
+	if err := migrate(string(b.staging), b.source, b.format); err != nil {
+		return err
+	}
+	b.source = b.format
+	if _, err := b.staging.writeManifest(b.producer, b.format); err != nil {
+		return fmt.Errorf("writing manifest of feature database staged at %s: %w", b.staging, err)
+	}
+	if b.key != nil {
+		if err := b.staging.Sign(b.key); err != nil {
+			return fmt.Errorf("signing feature database staged at %s: %w", b.staging, err)
+		}
+	} else if err := os.Remove(filepath.Join(string(b.staging), signatureFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := validate(b.staging); err != nil {
+		return fmt.Errorf("validating feature database staged at %s: %w", b.staging, err)
+	}
+	return nil
+}
+
+// validate ensures that the database at path can be loaded, and that it has
+// no problems of Error severity.
+func validate(path MountPoint) error {
+	c, err := path.Load()
+	if err != nil {
+		return err
+	}
+	if err := c.Close(); err != nil {
+		return err
+	}
+	problems, err := path.Validate()
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		if p.Severity == Error {
+			return errors.New(p.String())
+		}
+	}
+	return nil
+}
+
+var (
+	errBuilderDone = errors.New("feature database builder was already committed or aborted")
+
+	// errExchangeNotSupported is returned by exchange when the platform does
+	// not support atomically exchanging two directories.
+	errExchangeNotSupported = errors.New("exchanging directories is not supported")
+)
+
+// resolve returns path with symbolic links evaluated, or path unchanged if it
+// does not exist.
+func resolve(path string) (string, error) {
+	p, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	r, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return p, nil
+		}
+		return "", err
+	}
+	return r, nil
+}
+
+// replace atomically moves the directory at source to target, replacing the
+// previous content of target if it existed.
+func replace(target, source string) error {
+	_, err := os.Lstat(target)
+	switch {
+	case os.IsNotExist(err):
+		return os.Rename(source, target)
+	case err != nil:
+		return err
+	}
+
+	if err := exchange(source, target); err != nil {
+		if err != errExchangeNotSupported {
+			return err
+		}
+		// The platform does not support exchanging directories, fallback to
+		// moving the previous directory out of the way. There is a short time
+		// window during which the target does not exist.
+		if err := os.Rename(target, source+".old"); err != nil {
+			return err
+		}
+		if err := os.Rename(source, target); err != nil {
+			os.Rename(source+".old", target)
+			return err
+		}
+		source += ".old"
+	}
+
+	return rmdir(source)
+}
+
+// copyTree copies the directories and regular files found under src to dst.
+func copyTree(dst, src string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			if err := mkdir(target); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			if err := copyFile(target, path, mode.Perm()); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+}
+
+func copyFile(dst, src string, perm os.FileMode) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	return w.Close()
+}
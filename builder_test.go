@@ -0,0 +1,202 @@
+package feature_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/segmentio/feature"
+)
+
+func TestBuilder(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, feature.MountPoint)
+	}{
+		{
+			scenario: "committing a builder creates the target database",
+			function: testBuilderCommitCreate,
+		},
+
+		{
+			scenario: "committing a builder replaces the target database",
+			function: testBuilderCommitReplace,
+		},
+
+		{
+			scenario: "builders seeded from the target database apply incremental changes",
+			function: testBuilderSeeded,
+		},
+
+		{
+			scenario: "aborting a builder leaves the target database unchanged",
+			function: testBuilderAbort,
+		},
+
+		{
+			scenario: "committing an invalid database fails and leaves the target unchanged",
+			function: testBuilderCommitInvalid,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "feature")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+			test.function(t, feature.MountPoint(filepath.Join(tmp, "features")))
+		})
+	}
+}
+
+func testBuilderCommitCreate(t *testing.T, path feature.MountPoint) {
+	b := newBuilder(t, path)
+	defer b.Abort()
+
+	buildGate(t, b, "standard", "1", "family-A", "gate-1", "workspaces", 1.0, []string{"id-1"})
+	commitBuilder(t, b)
+
+	expectCacheGateOpened(t, path, "family-A", "gate-1", "workspaces", "id-1", true)
+	expectNoStagingDirectories(t, path)
+}
+
+func testBuilderCommitReplace(t *testing.T, path feature.MountPoint) {
+	b := newBuilder(t, path)
+	buildGate(t, b, "standard", "1", "family-A", "gate-1", "workspaces", 1.0, []string{"id-1"})
+	commitBuilder(t, b)
+
+	b = newBuilder(t, path)
+	buildGate(t, b, "standard", "2", "family-A", "gate-2", "workspaces", 1.0, []string{"id-2"})
+	commitBuilder(t, b)
+
+	expectGroups(t, path, []string{"standard"})
+	expectTiers(t, path, "standard", []string{"2"})
+	expectCacheGateOpened(t, path, "family-A", "gate-1", "workspaces", "id-1", false)
+	expectCacheGateOpened(t, path, "family-A", "gate-2", "workspaces", "id-2", true)
+	expectNoStagingDirectories(t, path)
+}
+
+func testBuilderSeeded(t *testing.T, path feature.MountPoint) {
+	b := newBuilder(t, path)
+	buildGate(t, b, "standard", "1", "family-A", "gate-1", "workspaces", 1.0, []string{"id-1"})
+	commitBuilder(t, b)
+
+	b, err := path.NewBuilderFrom(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Abort()
+
+	if err := b.EnableGate("standard", "1", "family-A", "gate-1", "workspaces", 0.0, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes are not visible until the builder is committed.
+	expectCacheGateOpened(t, path, "family-A", "gate-1", "workspaces", "id-1", true)
+	commitBuilder(t, b)
+	expectCacheGateOpened(t, path, "family-A", "gate-1", "workspaces", "id-1", false)
+}
+
+func testBuilderAbort(t *testing.T, path feature.MountPoint) {
+	b := newBuilder(t, path)
+	buildGate(t, b, "standard", "1", "family-A", "gate-1", "workspaces", 1.0, []string{"id-1"})
+
+	if err := b.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Commit(); err == nil {
+		t.Error("committing an aborted builder did not return an error")
+	}
+	if _, err := os.Stat(string(path)); !os.IsNotExist(err) {
+		t.Error("target database was created by an aborted builder:", err)
+	}
+	expectNoStagingDirectories(t, path)
+}
+
+func testBuilderCommitInvalid(t *testing.T, path feature.MountPoint) {
+	b := newBuilder(t, path)
+	buildGate(t, b, "standard", "1", "family-A", "gate-1", "workspaces", 1.0, []string{"id-1"})
+	commitBuilder(t, b)
+
+	b, err := path.NewBuilderFrom(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Abort()
+
+	gatePath := filepath.Join(string(b.Path()), "standard", "1", "gates", "family-A", "gate-1", "workspaces")
+	if err := ioutil.WriteFile(gatePath, []byte("volume\tnope\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Commit(); err == nil {
+		t.Error("committing an invalid database did not return an error")
+	}
+	expectCacheGateOpened(t, path, "family-A", "gate-1", "workspaces", "id-1", true)
+}
+
+func newBuilder(t testing.TB, path feature.MountPoint) *feature.Builder {
+	t.Helper()
+
+	b, err := path.NewBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func commitBuilder(t testing.TB, b *feature.Builder) {
+	t.Helper()
+
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func buildGate(t testing.TB, b *feature.Builder, group, tier, family, gate, collection string, volume float64, ids []string) {
+	t.Helper()
+
+	col, err := b.CreateCollection(group, tier, collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	populateCollection(t, col, ids)
+
+	if err := col.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.CreateGate(group, tier, family, gate, collection, 1234); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.EnableGate(group, tier, family, gate, collection, volume, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectCacheGateOpened(t testing.TB, path feature.MountPoint, family, gate, collection, id string, open bool) {
+	t.Helper()
+
+	cache, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	expectGateIsEnabled(t, cache, family, gate, collection, id, open)
+}
+
+func expectNoStagingDirectories(t testing.TB, path feature.MountPoint) {
+	t.Helper()
+
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(string(path)), ".*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("staging directories were left behind: %q", matches)
+	}
+}
@@ -3,11 +3,15 @@ package feature
 import (
 	"bytes"
 	"container/list"
+	"crypto/ed25519"
 	"hash/maphash"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Cache is an in-memory view of feature mount point on a file system.
@@ -20,15 +24,31 @@ import (
 // containing the id collections are memory mapped so multiple programs are able
 // to share the memory pages.
 type Cache struct {
-	cache lruCache
-	mutex sync.RWMutex
-	tiers []cachedTier
+	cache      lruCache
+	mutex      sync.RWMutex
+	tiers      []cachedTier
+	generation uint64
+	exposure   atomic.Value // *exposureLogger
+	clock      atomic.Value // func() time.Time
+	schedule   []time.Time
+	ramps      []*cachedGate
+	period     period
+	aliases    map[gateName]gateName // aliases of all the tiers, see aliasesOf
+	moved      map[string][]gateName // aliases of each family targeting another
+	aliased    uint32                // non-zero if aliases is not empty
 }
 
 func (c *Cache) swap(x *Cache) *Cache {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	c.tiers, x.tiers = x.tiers, c.tiers
+	c.schedule, x.schedule = x.schedule, c.schedule
+	c.ramps, x.ramps = x.ramps, c.ramps
+	c.aliases, x.aliases = x.aliases, c.aliases
+	c.moved, x.moved = x.moved, c.moved
+	atomic.StoreUint32(&c.aliased, atomic.LoadUint32(&x.aliased))
+	c.period = period{}
+	c.generation++
 	c.cache.clear()
 	return x
 }
@@ -52,39 +72,254 @@ func (c *Cache) Close() error {
 // GateOpen returns true if a gate is opened for a given id.
 //
 // The method does not retain any of the strings passed as arguments.
+//
+// If the gate was renamed, its former name resolves to the current one.
 func (c *Cache) GateOpen(family, gate, collection, id string) bool {
-	g := c.LookupGates(family, collection, id)
+	return c.GateOpenKey(family, gate, collection, id, Identifier{})
+}
+
+// GateOpenKey is like GateOpen, but gates which bucket by the collection of key
+// (see Tier.SetGateBucketBy) evaluate their volume with the bucket of the key
+// instead of id. The key is the identifier of the related entity, for example
+// the workspace of a source, so all the sources of a workspace are admitted
+// together.
+//
+// The membership of id in the collection is still checked, and gates which do
+// not bucket by the collection of the key ignore it, including prerequisites.
+// Passing a zero key is equivalent to calling GateOpen.
+func (c *Cache) GateOpenKey(family, gate, collection, id string, key Identifier) bool {
+	family, gate = c.resolve(family, gate)
+	g := c.lookupGates(family, collection, id, key)
 	i := sort.Search(len(g), func(i int) bool {
 		return g[i] >= gate
 	})
-	return i < len(g) && g[i] == gate
+	open := i < len(g) && g[i] == gate
+	if x := c.exposures(); x != nil {
+		x.expose(c, family, gate, collection, id, key, nil, open)
+	}
+	return open
+}
+
+// GateOpenStrict is like GateOpen but returns a *StateError if the gate was
+// removed in any of the tiers, so programs can treat the evaluation of removed
+// gates as a hard error.
+func (c *Cache) GateOpenStrict(family, gate, collection, id string) (bool, error) {
+	family, gate = c.resolve(family, gate)
+
+	c.mutex.RLock()
+	removed := false
+	for i := range c.tiers {
+		if c.tiers[i].states[gateName{family, gate}] == Removed {
+			removed = true
+			break
+		}
+	}
+	c.mutex.RUnlock()
+
+	if removed {
+		return false, &StateError{
+			Family: family,
+			Gate:   gate,
+			State:  Removed,
+			Reason: "the gate must not be evaluated",
+		}
+	}
+
+	return c.GateOpen(family, gate, collection, id), nil
+}
+
+// GateMetadata returns the metadata of a gate, and a boolean indicating whether
+// the gate had metadata. When the gate has metadata in multiple tiers, those of
+// the first tier in the order of evaluation are returned.
+//
+// Only the expiry times are retained in memory, the other metadata are read
+// from the database when the method is called.
+func (c *Cache) GateMetadata(family, gate string) (GateMetadata, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	name := c.aliasOf(gateName{family, gate})
+
+	for i := range c.tiers {
+		t := &Tier{path: c.tiers[i].path, group: c.tiers[i].group, name: c.tiers[i].name}
+		m, err := readMetadata(t.metadataPath(name.family, name.gate))
+		if err == nil && !m.IsZero() {
+			m.lines = nil
+			return m, true
+		}
+	}
+
+	return GateMetadata{}, false
+}
+
+// GateExpired returns true if the expiry time of a gate has passed. Programs
+// may call it when evaluating a gate to warn that the gate should be removed.
+func (c *Cache) GateExpired(family, gate string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.expired(c.aliasOf(gateName{family, gate}), c.now())
+}
+
+// ExpiredGates returns the sorted list of gates which have expired, in the
+// "family/gate" form.
+func (c *Cache) ExpiredGates() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	now := c.now()
+	seen := make(map[gateName]bool)
+	gates := make([]string, 0)
+
+	for i := range c.tiers {
+		for name := range c.tiers[i].expires {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if c.expired(name, now) {
+				gates = append(gates, name.family+"/"+name.gate)
+			}
+		}
+	}
+
+	sort.Strings(gates)
+	return gates
+}
+
+// resolve returns the canonical name of a gate, which differs from the name
+// passed as argument if it is an alias.
+func (c *Cache) resolve(family, gate string) (string, string) {
+	// Most databases have no aliases, which is known without taking the lock.
+	if atomic.LoadUint32(&c.aliased) == 0 {
+		return family, gate
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	name := c.aliasOf(gateName{family, gate})
+	return name.family, name.gate
+}
+
+// aliasOf returns the target of the gate if it is an alias, or the name itself
+// otherwise. The cache mutex must be held.
+func (c *Cache) aliasOf(name gateName) gateName {
+	if target, ok := c.aliases[name]; ok {
+		return target
+	}
+	return name
+}
+
+// aliasesOf merges the aliases of the tiers, the first tier defining an alias
+// in the order of evaluation wins. Aliases are ignored when one of the tiers
+// still has a gate under their name, so the gate is never evaluated under two
+// different names. The second map lists, for each family, the aliases which
+// target gates of other families.
+func aliasesOf(tiers []cachedTier) (map[gateName]gateName, map[string][]gateName) {
+	var aliases map[gateName]gateName
+	var moved map[string][]gateName
+
+	for i := range tiers {
+		for name, target := range tiers[i].aliases {
+			if _, ok := aliases[name]; ok || hasGate(tiers, name) {
+				continue
+			}
+			if aliases == nil {
+				aliases = make(map[gateName]gateName)
+			}
+			aliases[name] = target
+		}
+	}
+
+	for name, target := range aliases {
+		if name.family != target.family {
+			if moved == nil {
+				moved = make(map[string][]gateName)
+			}
+			moved[name.family] = append(moved[name.family], name)
+		}
+	}
+
+	return aliases, moved
+}
+
+func hasGate(tiers []cachedTier, name gateName) bool {
+	for i := range tiers {
+		for _, g := range tiers[i].gates[name.family] {
+			if g.name == name.gate {
+				return true
+			}
+		}
+	}
+	return false
 }
 
-// LookupGates returns the list of open gates in a family for a given id.
+// expired returns true if the first tier where the gate has an expiry time
+// says that it expired, the cache mutex must be held.
+func (c *Cache) expired(name gateName, now time.Time) bool {
+	for i := range c.tiers {
+		if expires, ok := c.tiers[i].expires[name]; ok {
+			return !expires.After(now)
+		}
+	}
+	return false
+}
+
+// LookupGates returns the list of open gates in a family for a given id. The
+// gates are listed under their canonical names, never under their aliases,
+// except for gates which were renamed into another family: since their
+// canonical name is not in the family, they are listed under their former
+// name so programs looking up the family keep finding them.
 //
 // The method does not retain any of the strings passed as arguments.
 func (c *Cache) LookupGates(family, collection, id string) []string {
+	return c.LookupGatesKey(family, collection, id, Identifier{})
+}
+
+// LookupGatesKey is like LookupGates, but gates which bucket by the collection
+// of key evaluate their volume with the bucket of the key, see GateOpenKey.
+func (c *Cache) LookupGatesKey(family, collection, id string, key Identifier) []string {
+	gates := c.lookupGates(family, collection, id, key)
+	if x := c.exposures(); x != nil {
+		c.exposeGates(x, family, collection, id, key, gates)
+	}
+	return gates
+}
+
+func (c *Cache) lookupGates(family, collection, id string, bucketKey Identifier) []string {
+	// The generation is read before sampling the time, so the result is not
+	// inserted if another lookup crossed a schedule boundary, or the cache was
+	// reloaded, while it was computed.
+	generation := c.cache.generation()
+	now := c.checkSchedule()
+
 	key := lruCacheKey{
-		family:     family,
-		collection: collection,
-		id:         id,
+		family:        family,
+		collection:    collection,
+		id:            id,
+		keyCollection: bucketKey.Collection,
+		key:           bucketKey.ID,
 	}
 
 	if v := c.cache.lookup(key); v != nil && v.key == key {
 		return v.gates
 	}
 
-	buf := family + collection + id
+	buf := family + collection + id + bucketKey.Collection + bucketKey.ID
+	n1 := len(family)
+	n2 := n1 + len(collection)
+	n3 := n2 + len(id)
+	n4 := n3 + len(bucketKey.Collection)
 	key = lruCacheKey{
-		family:     buf[:len(family)],
-		collection: buf[len(family) : len(family)+len(collection)],
-		id:         buf[len(family)+len(collection):],
+		family:        buf[:n1],
+		collection:    buf[n1:n2],
+		id:            buf[n2:n3],
+		keyCollection: buf[n3:n4],
+		key:           buf[n4:],
 	}
 
-	disabled := make(map[string]struct{})
-	gates := make([]string, 0, 8)
+	var gates []string
 	defer func() {
-		c.cache.insert(key, gates, 4096)
+		c.cache.insert(key, gates, 4096, generation)
 	}()
 
 	h := acquireBufferedHash64()
@@ -93,6 +328,74 @@ func (c *Cache) LookupGates(family, collection, id string) []string {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
+	gates = c.evaluate(family, collection, id, bucketKey, now, h)
+
+	if moved := c.moved[family]; len(moved) != 0 {
+		gates = c.evaluateMoved(gates, moved, collection, id, bucketKey, now, h)
+	}
+	return gates
+}
+
+// evaluateMoved adds to the list of open gates of a family the former names of
+// the gates which were renamed into other families and are open for the id.
+// The cache mutex must be held.
+func (c *Cache) evaluateMoved(gates []string, moved []gateName, collection, id string, key Identifier, now time.Time, h *bufferedHash64) []string {
+	open := make(map[string][]string)
+
+	for _, name := range moved {
+		target := c.aliases[name]
+		g, ok := open[target.family]
+		if !ok {
+			g = c.evaluate(target.family, collection, id, key, now, h)
+			open[target.family] = g
+		}
+		if i := sort.SearchStrings(g, target.gate); i < len(g) && g[i] == target.gate {
+			gates = append(gates, name.gate)
+		}
+	}
+
+	if len(gates) == 0 {
+		return nil
+	}
+	sort.Strings(gates)
+	return gates[:len(gates):len(gates)]
+}
+
+// evaluate returns the sorted list of open gates of a family for an id at the
+// time now, which excludes gates with closed prerequisites. The key is the
+// bucketing key of gates which bucket by another collection, if any. The cache
+// mutex must be held.
+func (c *Cache) evaluate(family, collection, id string, key Identifier, now time.Time, h *bufferedHash64) []string {
+	gates := c.evaluateTiers(family, collection, id, key, now, h)
+
+	n := 0
+	for _, gate := range gates {
+		if _, closed := c.closedPrerequisite(gateName{family, gate}, collection, id, key, now, h); !closed {
+			gates[n] = gate
+			n++
+		}
+	}
+
+	if n == 0 {
+		return nil
+	}
+	// Safe guard in case the program appends to the slice, it will force the
+	// reallocation and copy.
+	return gates[:n:n]
+}
+
+// evaluateTiers returns the sorted list of gates of a family that the tiers
+// open for an id, regardless of their prerequisites. The cache mutex must be
+// held.
+//
+// The hash is reset first, then carries its state from one gate to the next in
+// tier order, then in the order of the gates in each tier, which is how the
+// historical algorithm assigns ids to buckets (see openGate).
+func (c *Cache) evaluateTiers(family, collection, id string, key Identifier, now time.Time, h *bufferedHash64) []string {
+	h.reset()
+	disabled := make(map[string]struct{})
+	gates := make([]string, 0, 8)
+
 	for i := range c.tiers {
 		t := &c.tiers[i]
 		c := t.collections[collection]
@@ -100,13 +403,16 @@ func (c *Cache) LookupGates(family, collection, id string) []string {
 
 		for _, g := range t.gates[family] {
 			if g.collection == collection {
+				// Outside of their schedule, gates behave as if their volume
+				// was zero and their default state closed.
+				active := g.active(now)
 				if exists {
-					if openGate(id, g.salt, g.volume, h) {
+					if active && openGate(g.bucketKey(id, key), g.salt, g.volumeAt(now), g.buckets, g.hash, h) {
 						gates = append(gates, g.name)
 					} else {
 						disabled[g.name] = struct{}{}
 					}
-				} else if g.open {
+				} else if active && g.open {
 					gates = append(gates, g.name)
 				}
 			}
@@ -114,19 +420,86 @@ func (c *Cache) LookupGates(family, collection, id string) []string {
 	}
 
 	if len(gates) == 0 {
-		gates = nil
-	} else {
-		sort.Strings(gates)
-		gates = deduplicate(gates)
-		gates = strip(gates, disabled)
-		// Safe guard in case the program appends to the slice, it will force
-		// the reallocation and copy.
-		gates = gates[:len(gates):len(gates)]
+		return nil
 	}
 
+	sort.Strings(gates)
+	gates = deduplicate(gates)
+	gates = strip(gates, disabled)
 	return gates
 }
 
+// tierResult is the result of evaluating a gate for an id in one tier.
+type tierResult struct {
+	tier   *cachedTier
+	listed bool // the id is in the collection of the tier
+	open   bool
+}
+
+// evaluateGateTiers evaluates a gate for an id in each tier which has a
+// configuration for it, and calls fn with the results in tier order. The other
+// gates of the family are hashed in the same order as evaluateTiers, so the
+// results are the same as those of lookups.
+//
+// When subject is not nil, gates bucketing by another collection use the id of
+// the subject in that collection as bucketing key, like GateOpenSubject. The
+// cache mutex must be held.
+func (c *Cache) evaluateGateTiers(name gateName, collection, id string, key Identifier, subject Subject, now time.Time, h *bufferedHash64, fn func(tierResult)) {
+	h.reset()
+
+	for i := range c.tiers {
+		t := &c.tiers[i]
+		col := t.collections[collection]
+		exists := col != nil && col.contains(id)
+
+		for _, g := range t.gates[name.family] {
+			if g.collection != collection {
+				continue
+			}
+			active := g.active(now)
+			if exists {
+				if subject != nil {
+					key.Collection = g.bucketBy
+					key.ID, _ = subject.ID(g.bucketBy)
+				}
+				open := active && openGate(g.bucketKey(id, key), g.salt, g.volumeAt(now), g.buckets, g.hash, h)
+				if g.name == name.gate {
+					fn(tierResult{tier: t, listed: true, open: open})
+				}
+			} else if g.name == name.gate {
+				fn(tierResult{tier: t, open: active && g.open})
+			}
+		}
+	}
+}
+
+// closedPrerequisite returns the first prerequisite of a gate which is closed
+// for an id, and a boolean indicating whether one was found. Prerequisites are
+// evaluated recursively, which terminates because Load rejects cycles. The
+// cache mutex must be held.
+func (c *Cache) closedPrerequisite(name gateName, collection, id string, key Identifier, now time.Time, h *bufferedHash64) (gateName, bool) {
+	for i := range c.tiers {
+		for _, p := range c.tiers[i].prerequisites[name] {
+			if p = c.aliasOf(p); !c.evaluateGate(p, collection, id, key, now, h) {
+				return p, true
+			}
+		}
+	}
+	return gateName{}, false
+}
+
+// evaluateGate returns true if a gate and its prerequisites are open for an
+// id. The cache mutex must be held.
+func (c *Cache) evaluateGate(name gateName, collection, id string, key Identifier, now time.Time, h *bufferedHash64) bool {
+	gates := c.evaluateTiers(name.family, collection, id, key, now, h)
+	i := sort.SearchStrings(gates, name.gate)
+	if i == len(gates) || gates[i] != name.gate {
+		return false
+	}
+	_, closed := c.closedPrerequisite(name, collection, id, key, now, h)
+	return !closed
+}
+
 func deduplicate(s []string) []string {
 	n := 0
 
@@ -162,10 +535,20 @@ func strip(s []string, disabled map[string]struct{}) []string {
 }
 
 type cachedTier struct {
-	group       string
-	name        string
-	collections map[string]*collection
-	gates       map[string][]cachedGate
+	path          MountPoint
+	group         string
+	name          string
+	collections   map[string]*collection
+	gates         map[string][]cachedGate
+	expires       map[gateName]time.Time
+	states        map[gateName]GateState
+	aliases       map[gateName]gateName
+	prerequisites map[gateName][]gateName
+}
+
+type gateName struct {
+	family string
+	gate   string
 }
 
 type cachedGate struct {
@@ -174,14 +557,72 @@ type cachedGate struct {
 	salt       string
 	volume     float64
 	open       bool
+	start      time.Time
+	end        time.Time
+	ramp       Ramp
+	buckets    uint64
+	hash       HashFunc
+	bucketBy   string
+}
+
+// bucketKey returns the key that the gate computes the bucket of an id from,
+// which is the id of the bucketing key if the gate buckets by its collection,
+// or the id itself.
+func (g *cachedGate) bucketKey(id string, key Identifier) string {
+	if g.bucketBy != "" && g.bucketBy == key.Collection && key.ID != "" {
+		return key.ID
+	}
+	return id
+}
+
+func (g *cachedGate) active(now time.Time) bool {
+	return active(now, g.start, g.end)
+}
+
+func (g *cachedGate) volumeAt(now time.Time) float64 {
+	return g.ramp.VolumeAt(now, g.volume)
+}
+
+// level returns the number of buckets that the gate admits at time now, the
+// evaluation of the gate only changes when it changes. The computation must
+// match the one made by openGate.
+func (g *cachedGate) level(now time.Time) float64 {
+	return math.Floor(float64(g.buckets) * g.volumeAt(now))
+}
+
+// checkPrerequisites returns a *PrerequisiteCycleError if the prerequisites
+// of the gates of all tiers form a cycle, after resolving aliases.
+func (c *Cache) checkPrerequisites() error {
+	graph := make(map[gateName][]gateName)
+
+	for i := range c.tiers {
+		for name, prerequisites := range c.tiers[i].prerequisites {
+			for _, p := range prerequisites {
+				graph[name] = append(graph[name], c.aliasOf(p))
+			}
+		}
+	}
+
+	if cycle := findCycle(graph); cycle != nil {
+		return cycle
+	}
+	return nil
 }
 
 // The Load method loads the features at the mount point it is called on,
 // returning a Cache object exposing the state.
 //
+// When trusted keys are given, the database must have a manifest signed by one
+// of them (see MountPoint.Sign), otherwise loading fails with an error wrapping
+// a *SignatureError.
+//
+// When the database has a manifest, its files are verified against it, and
+// loading fails with an error wrapping a *ManifestError if they do not match
+// (see Manifest.Verify).
+//
 // The returned cache holds operating system resources and therefore must be
 // closed when the program does not need it anymore.
-func (path MountPoint) Load() (*Cache, error) {
+func (path MountPoint) Load(keys ...ed25519.PublicKey) (*Cache, error) {
 	// Resolves symlinks first so we know that the underlying directory
 	// structure will not change across reads from the file system when
 	// loading the cache.
@@ -190,6 +631,12 @@ func (path MountPoint) Load() (*Cache, error) {
 		return nil, err
 	}
 	path = MountPoint(p)
+
+	format, err := verifyManifest(path, keys)
+	if err != nil {
+		return nil, err
+	}
+
 	// To minimize the memory footprint of the cache, strings are deduplicated
 	// using this map, so we only retain only one copy of each string value.
 	strings := stringCache{}
@@ -205,10 +652,26 @@ func (path MountPoint) Load() (*Cache, error) {
 			defer t.Close()
 
 			c := cachedTier{
-				group:       strings.load(group),
-				name:        strings.load(tier),
-				collections: make(map[string]*collection),
-				gates:       make(map[string][]cachedGate),
+				path:          path,
+				group:         strings.load(group),
+				name:          strings.load(tier),
+				collections:   make(map[string]*collection),
+				gates:         make(map[string][]cachedGate),
+				expires:       make(map[gateName]time.Time),
+				states:        make(map[gateName]GateState),
+				aliases:       make(map[gateName]gateName),
+				prerequisites: make(map[gateName][]gateName),
+			}
+
+			aliases, err := t.ReadAliases()
+			if err != nil {
+				return err
+			}
+			for _, a := range aliases {
+				c.aliases[gateName{a.Family, a.Gate}] = gateName{
+					family: strings.load(a.TargetFamily),
+					gate:   strings.load(a.TargetGate),
+				}
 			}
 
 			if err := Scan(t.Families(), func(family string) error {
@@ -217,17 +680,68 @@ func (path MountPoint) Load() (*Cache, error) {
 					d := readdir(t.gatePath(family, gate))
 					defer d.close()
 
+					m, err := readMetadata(t.metadataPath(family, gate))
+					if err != nil {
+						return err
+					}
+					// The other metadata are not needed to evaluate gates, they
+					// are read when the program asks for them.
+					if !m.Expires.IsZero() {
+						c.expires[gateName{f, strings.load(gate)}] = m.Expires
+					}
+
+					state, err := readState(t.statePath(family, gate))
+					if err != nil {
+						return err
+					}
+					if state != "" {
+						c.states[gateName{f, strings.load(gate)}] = state
+					}
+
+					prerequisites, err := readPrerequisites(t.prerequisitesPath(family, gate))
+					if err != nil {
+						return err
+					}
+					if len(prerequisites) != 0 {
+						for i, p := range prerequisites {
+							prerequisites[i] = gateName{strings.load(p.family), strings.load(p.gate)}
+						}
+						c.prerequisites[gateName{f, strings.load(gate)}] = prerequisites
+					}
+
 					for d.next() {
-						open, salt, volume, err := t.ReadGate(family, gate, d.name())
+						path := t.gateCollectionPath(family, gate, d.name())
+						g, err := readGate(path)
 						if err != nil {
 							return err
 						}
+						hash, err := lookupHash(g.hash)
+						if err != nil {
+							// The program cannot compute the buckets of ids
+							// without the algorithm, the gate is evaluated as
+							// closed instead of failing to load the database.
+							// Validation reports the unknown algorithm.
+							g.open, g.volume, g.ramp = false, 0, Ramp{}
+						}
+						if hash == nil && g.bucketBy != "" {
+							// Bucketing keys are not part of the historical
+							// algorithm, the gate hashes them from a fresh
+							// state so they do not change the buckets of the
+							// next gates of the family (see evaluateTiers).
+							hash = fnv64aHash
+						}
 						c.gates[f] = append(c.gates[f], cachedGate{
 							name:       strings.load(gate),
 							collection: strings.load(d.name()),
-							salt:       salt,
-							volume:     volume,
-							open:       open,
+							salt:       g.salt,
+							volume:     g.volume,
+							open:       g.open,
+							start:      g.start,
+							end:        g.end,
+							ramp:       g.ramp,
+							buckets:    g.bucketCount(),
+							hash:       hash,
+							bucketBy:   g.bucketBy,
 						})
 					}
 
@@ -238,7 +752,7 @@ func (path MountPoint) Load() (*Cache, error) {
 			}
 
 			if err := Scan(t.Collections(), func(collection string) error {
-				col, err := mmapCollection(t.collectionPath(collection))
+				col, err := mmapCollection(t.collectionPath(collection), format >= 2)
 				if err != nil {
 					return err
 				}
@@ -263,7 +777,17 @@ func (path MountPoint) Load() (*Cache, error) {
 		}
 	}
 
-	return &Cache{tiers: tiers}, nil
+	c := &Cache{tiers: tiers, schedule: scheduleOf(tiers), ramps: rampsOf(tiers)}
+	if c.aliases, c.moved = aliasesOf(tiers); len(c.aliases) != 0 {
+		c.aliased = 1
+	}
+
+	if err := c.checkPrerequisites(); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
 }
 
 type slice struct {
@@ -297,7 +821,10 @@ func (col *collection) Len() int           { return len(col.index) }
 func (col *collection) Less(i, j int) bool { return string(col.at(i)) < string(col.at(j)) }
 func (col *collection) Swap(i, j int)      { col.index[i], col.index[j] = col.index[j], col.index[i] }
 
-func mmapCollection(path string) (*collection, error) {
+// mmapCollection maps the collection at path in memory and indexes its ids.
+// Collections of databases using format version 2 or later are known to be
+// sorted, which saves comparing every id with the next one when sorted is true.
+func mmapCollection(path string, sorted bool) (*collection, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -321,7 +848,7 @@ func mmapCollection(path string) (*collection, error) {
 	})
 
 	col := &collection{memory: m, index: index}
-	if !sort.IsSorted(col) {
+	if !sorted && !sort.IsSorted(col) {
 		sort.Sort(col)
 	}
 	return col, nil
@@ -352,15 +879,19 @@ func (c stringCache) load(s string) string {
 var lruCacheSeed = maphash.MakeSeed()
 
 type lruCacheKey struct {
-	family     string
-	collection string
-	id         string
+	family        string
+	collection    string
+	id            string
+	keyCollection string
+	key           string
 }
 
 func (k *lruCacheKey) hash(h *maphash.Hash) uint64 {
 	h.WriteString(k.family)
 	h.WriteString(k.collection)
 	h.WriteString(k.id)
+	h.WriteString(k.keyCollection)
+	h.WriteString(k.key)
 	return h.Sum64()
 }
 
@@ -373,10 +904,19 @@ type lruCache struct {
 	mutex sync.Mutex
 	queue list.List
 	cache map[uint64]*list.Element
+	epoch uint64 // incremented each time the cache is cleared
+}
+
+// generation returns the number of times the cache was cleared, which must be
+// read before computing a value to insert, so values computed from a state
+// that the cache was cleared of are rejected by insert.
+func (c *lruCache) generation() uint64 {
+	return atomic.LoadUint64(&c.epoch)
 }
 
 func (c *lruCache) clear() {
 	c.mutex.Lock()
+	atomic.AddUint64(&c.epoch, 1)
 	c.queue = list.List{}
 	for key := range c.cache {
 		delete(c.cache, key)
@@ -384,7 +924,9 @@ func (c *lruCache) clear() {
 	c.mutex.Unlock()
 }
 
-func (c *lruCache) insert(key lruCacheKey, gates []string, limit int) {
+// insert adds a value to the cache, unless the cache was cleared since the
+// generation was read.
+func (c *lruCache) insert(key lruCacheKey, gates []string, limit int, generation uint64) {
 	m := maphash.Hash{}
 	m.SetSeed(lruCacheSeed)
 	h := key.hash(&m)
@@ -397,6 +939,9 @@ func (c *lruCache) insert(key lruCacheKey, gates []string, limit int) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
+	if c.epoch != generation {
+		return
+	}
 	if c.cache == nil {
 		c.cache = make(map[uint64]*list.Element)
 	}
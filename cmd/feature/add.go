@@ -4,6 +4,7 @@ import "github.com/segmentio/feature"
 
 type addConfig struct {
 	commonConfig
+	revisionConfig
 }
 
 func add(config addConfig, group group, tier tier, collection collection, ids []id) error {
@@ -26,6 +27,6 @@ func add(config addConfig, group group, tier tier, collection collection, ids []
 			}
 		}
 
-		return c.Sync()
+		return c.CompareAndSync(config.IfRevision)
 	})
 }
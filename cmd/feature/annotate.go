@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/segmentio/cli/human"
+	"github.com/segmentio/feature"
+)
+
+type annotateConfig struct {
+	commonConfig
+	Description string   `flag:"-d,--description" help:"Description of the purpose of the gate"                                 default:"-"`
+	Owner       string   `flag:"-o,--owner"       help:"Team or person owning the gate"                                         default:"-"`
+	Link        string   `flag:"-l,--link"        help:"Link to the ticket or document tracking the gate"                       default:"-"`
+	Tags        []string `flag:"-t,--tag"         help:"Tag added to the gate, may be repeated"                                 default:"-"`
+	Untag       []string `flag:"--untag"          help:"Tag removed from the gate, may be repeated"                             default:"-"`
+	Expires     string   `flag:"-e,--expires"     help:"Expiry time of the gate, as a date, a relative time like 90d later, or never" default:"-"`
+	Clear       bool     `flag:"--clear"          help:"Clear the description, owner, link, tags, and expiry time first"`
+}
+
+// annotate only modifies the metadata passed on the command line, the others
+// are retained unless --clear is set.
+func annotate(config annotateConfig, group group, tier tier, family family, gate gate) error {
+	return config.mount(func(path feature.MountPoint) error {
+		t, err := path.OpenTier(string(group), string(tier))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s/%s: tier does not exist\n", group, tier)
+			}
+			return err
+		}
+		defer t.Close()
+
+		m, err := t.ReadGateMetadata(string(family), string(gate))
+		if err != nil {
+			return err
+		}
+
+		if config.Clear {
+			m.Description, m.Owner, m.Link, m.Tags, m.Expires = "", "", "", nil, time.Time{}
+		}
+		if config.Description != "" {
+			m.Description = config.Description
+		}
+		if config.Owner != "" {
+			m.Owner = config.Owner
+		}
+		if config.Link != "" {
+			m.Link = config.Link
+		}
+		if config.Expires != "" {
+			if m.Expires, err = parseExpiry(config.Expires); err != nil {
+				return err
+			}
+		}
+
+		untag := make(map[string]bool, len(config.Untag))
+		for _, tag := range config.Untag {
+			untag[tag] = true
+		}
+		tags := make([]string, 0, len(m.Tags)+len(config.Tags))
+		for _, tag := range append(m.Tags, config.Tags...) {
+			if !untag[tag] {
+				tags = append(tags, tag)
+			}
+		}
+		m.Tags = tags
+
+		if err := t.WriteGateMetadata(string(family), string(gate), m); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s/%s: gate does not exist in tier %s/%s", family, gate, group, tier)
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// parseExpiry parses dates, absolute or relative times supported by the human
+// package, and "never" which removes the expiry time.
+func parseExpiry(s string) (time.Time, error) {
+	if s == "never" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := human.ParseTime(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry time: %w", err)
+	}
+	return time.Time(t), nil
+}
@@ -3,7 +3,11 @@ package main
 import (
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/segmentio/feature"
 )
@@ -66,7 +70,11 @@ func describeTier(config describeTierConfig, group group, tier tier) error {
 			fmt.Fprint(w, "\nCollections:\n")
 
 			if err := feature.Scan(t.Collections(), func(collection string) error {
-				_, err := fmt.Fprintf(w, " - %s\n", collection)
+				rev, err := t.CollectionRevision(collection)
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintf(w, " - %s\t(revision: %s)\n", collection, rev)
 				return err
 			}); err != nil {
 				return err
@@ -79,12 +87,48 @@ func describeTier(config describeTierConfig, group group, tier tier) error {
 					fmt.Fprintf(w, "  %s/%s\n", family, gate)
 					defer fmt.Fprintln(w)
 
+					state, err := t.ReadGateState(family, gate)
+					if err != nil {
+						return err
+					}
+					if state != "" {
+						fmt.Fprintf(w, "    State:\t%s\n", state)
+					}
+
+					m, err := t.ReadGateMetadata(family, gate)
+					if err != nil {
+						return err
+					}
+					describeMetadata(w, m)
+
 					return feature.Scan(t.GatesCreated(family, gate), func(collection string) error {
-						open, _, volume, err := t.ReadGate(family, gate, collection)
+						open, _, volume, rev, err := t.ReadGateRevision(family, gate, collection)
+						if err != nil {
+							return err
+						}
+						start, end, err := t.ReadGateSchedule(family, gate, collection)
+						if err != nil {
+							return err
+						}
+						r, err := t.ReadGateRamp(family, gate, collection)
+						if err != nil {
+							return err
+						}
+						buckets, err := t.ReadGateBuckets(family, gate, collection)
+						if err != nil {
+							return err
+						}
+						hash, err := t.ReadGateHash(family, gate, collection)
 						if err != nil {
 							return err
 						}
-						fmt.Fprintf(w, "  - %s\t(%.0f%%, default: %s)\n", collection, volume*100, openFormat(open))
+						bucketBy, err := t.ReadGateBucketBy(family, gate, collection)
+						if err != nil {
+							return err
+						}
+						now := time.Now()
+						volume = r.VolumeAt(now, volume)
+						fmt.Fprintf(w, "  - %s\t(%s, default: %s, revision: %s%s%s%s%s%s)\n", collection, percentFormat(volume), openFormat(open), rev, bucketsFormat(buckets), hashFormat(hash), bucketByFormat(bucketBy), scheduleFormat{start, end}, rampFormat{r, now})
 						return nil
 					})
 				})
@@ -92,11 +136,89 @@ func describeTier(config describeTierConfig, group group, tier tier) error {
 				return err
 			}
 
+			aliases, err := t.ReadAliases()
+			if err != nil {
+				return err
+			}
+			if len(aliases) != 0 {
+				fmt.Fprint(w, "Aliases:\n")
+				for _, a := range aliases {
+					fmt.Fprintf(w, " - %s\n", a)
+				}
+			}
+
 			return nil
 		})
 	})
 }
 
+// rampFormat shows the interpolation mode of a ramp and its next step, the
+// volume of the gate is shown separately.
+type rampFormat struct {
+	ramp feature.Ramp
+	now  time.Time
+}
+
+func (r rampFormat) Format(w fmt.State, _ rune) {
+	if r.ramp.IsZero() {
+		return
+	}
+	mode := "steps"
+	if r.ramp.Linear {
+		mode = "linear"
+	}
+	if next, ok := r.ramp.NextStep(r.now); ok {
+		fmt.Fprintf(w, ", ramp: %s, next: %s at %s", mode, percentFormat(next.Volume), next.Time.Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(w, ", ramp: %s, done", mode)
+	}
+}
+
+// percentFormat shows volumes as percentages, with up to 4 decimals so volumes
+// of gates with more buckets than the default are shown accurately.
+type percentFormat float64
+
+func (p percentFormat) Format(w fmt.State, _ rune) {
+	v := math.Round(float64(p)*1e6) / 1e4
+	io.WriteString(w, strconv.FormatFloat(v, 'f', -1, 64))
+	io.WriteString(w, "%")
+}
+
+type bucketsFormat uint64
+
+func (b bucketsFormat) Format(w fmt.State, _ rune) {
+	if b != feature.DefaultBuckets {
+		fmt.Fprintf(w, ", buckets: %d", uint64(b))
+	}
+}
+
+type hashFormat string
+
+func (h hashFormat) Format(w fmt.State, _ rune) {
+	if h != feature.DefaultHash {
+		fmt.Fprintf(w, ", hash: %s", string(h))
+	}
+}
+
+type bucketByFormat string
+
+func (b bucketByFormat) Format(w fmt.State, _ rune) {
+	if b != "" {
+		fmt.Fprintf(w, ", bucket-by: %s", string(b))
+	}
+}
+
+type scheduleFormat struct{ start, end time.Time }
+
+func (s scheduleFormat) Format(w fmt.State, _ rune) {
+	if !s.start.IsZero() {
+		fmt.Fprintf(w, ", from: %s", s.start.Format(time.RFC3339))
+	}
+	if !s.end.IsZero() {
+		fmt.Fprintf(w, ", until: %s", s.end.Format(time.RFC3339))
+	}
+}
+
 type openFormat bool
 
 func (open openFormat) Format(w fmt.State, _ rune) {
@@ -106,3 +228,27 @@ func (open openFormat) Format(w fmt.State, _ rune) {
 		io.WriteString(w, "close")
 	}
 }
+
+func describeMetadata(w io.Writer, m feature.GateMetadata) {
+	if m.Description != "" {
+		fmt.Fprintf(w, "    Description:\t%s\n", m.Description)
+	}
+	if m.Owner != "" {
+		fmt.Fprintf(w, "    Owner:\t%s\n", m.Owner)
+	}
+	if len(m.Tags) != 0 {
+		fmt.Fprintf(w, "    Tags:\t%s\n", strings.Join(m.Tags, ", "))
+	}
+	if m.Link != "" {
+		fmt.Fprintf(w, "    Link:\t%s\n", m.Link)
+	}
+	if !m.Created.IsZero() {
+		fmt.Fprintf(w, "    Created:\t%s\n", m.Created.Format(time.RFC3339))
+	}
+	if !m.Expires.IsZero() {
+		fmt.Fprintf(w, "    Expires:\t%s\n", m.Expires.Format(time.RFC3339))
+	}
+	if !m.RolledOut.IsZero() {
+		fmt.Fprintf(w, "    Rolled out:\t%s\n", m.RolledOut.Format(time.RFC3339))
+	}
+}
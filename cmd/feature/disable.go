@@ -8,6 +8,7 @@ import (
 
 type disableConfig struct {
 	commonConfig
+	revisionConfig
 }
 
 func disable(config disableConfig, group group, tier tier, family family, gate gate, collection collection) error {
@@ -20,6 +21,6 @@ func disable(config disableConfig, group group, tier tier, family family, gate g
 			return err
 		}
 		defer t.Close()
-		return t.EnableGate(string(family), string(gate), string(collection), 0, false)
+		return t.CompareAndEnableGate(string(family), string(gate), string(collection), 0, false, config.IfRevision)
 	})
 }
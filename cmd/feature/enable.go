@@ -10,7 +10,11 @@ import (
 
 type enableConfig struct {
 	commonConfig
-	Open bool `flag:"-o,--open" help:"Sets the default state of the gate to open"`
+	revisionConfig
+	Open     bool   `flag:"-o,--open"    help:"Sets the default state of the gate to open"`
+	Buckets  uint64 `flag:"-b,--buckets" help:"Number of buckets used to evaluate the volume, e.g. 10000 for volumes in increments of 0.01%" default:"0"`
+	Hash     string `flag:"--hash"       help:"Name of the hash algorithm assigning ids to buckets (fnv64a, sha1, murmur3)" default:"-"`
+	BucketBy string `flag:"--bucket-by"  help:"Collection whose ids the gate buckets by when evaluated with a bucketing key, none to remove" default:"-"`
 }
 
 func enable(config enableConfig, group group, tier tier, family family, gate gate, collection collection, volume human.Ratio) error {
@@ -23,6 +27,22 @@ func enable(config enableConfig, group group, tier tier, family family, gate gat
 			return err
 		}
 		defer t.Close()
-		return t.EnableGate(string(family), string(gate), string(collection), float64(volume), config.Open)
+
+		if _, ok := feature.LookupHash(config.Hash); config.Hash != "" && !ok {
+			return fmt.Errorf("unknown hash algorithm: %q, expected one of %v", config.Hash, feature.Hashes())
+		}
+
+		c := feature.GateConfig{
+			Volume:  float64(volume),
+			Open:    config.Open,
+			Buckets: config.Buckets,
+			Hash:    config.Hash,
+		}
+		if config.BucketBy == "none" {
+			c.ClearBucketBy = true
+		} else {
+			c.BucketBy = config.BucketBy
+		}
+		return t.CompareAndConfigureGate(string(family), string(gate), string(collection), c, config.IfRevision)
 	})
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/segmentio/feature"
+)
+
+type explainConfig struct {
+	commonConfig
+	outputConfig
+}
+
+func explain(config explainConfig, family family, gate gate, collection collection, id id) error {
+	return config.mount(func(path feature.MountPoint) error {
+		c, err := path.Load()
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+
+		e := c.Explain(string(family), string(gate), string(collection), string(id))
+
+		return config.table(func(w io.Writer) error {
+			state := "closed"
+			if e.Open {
+				state = "open"
+			}
+			fmt.Fprintf(w, "Gate:\t%s/%s\n", e.Family, e.Gate)
+			fmt.Fprintf(w, "Collection:\t%s\n", e.Collection)
+			fmt.Fprintf(w, "ID:\t%s\n", e.ID)
+			fmt.Fprintf(w, "State:\t%s\n", state)
+			if e.Group != "" {
+				fmt.Fprintf(w, "Tier:\t%s/%s\n", e.Group, e.Tier)
+			} else {
+				fmt.Fprint(w, "Tier:\tnone, the gate has no configuration for the collection\n")
+			}
+			if e.Prerequisite != "" {
+				fmt.Fprintf(w, "Prerequisite:\t%s is closed\n", e.Prerequisite)
+			}
+			return nil
+		})
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/segmentio/feature"
+)
+
+type fsckConfig struct {
+	commonConfig
+	outputConfig
+	Fix bool `flag:"--fix" help:"Fix the problems that can be repaired automatically"`
+}
+
+// fsck exits with a non-zero status if problems remain in the database after
+// fixing them (when --fix is set).
+func fsck(config fsckConfig) (int, error) {
+	remaining := 0
+
+	err := config.mount(func(path feature.MountPoint) error {
+		problems, err := path.Validate()
+		if err != nil {
+			return err
+		}
+
+		return config.buffered(func(w io.Writer) error {
+			for _, p := range problems {
+				status := ""
+
+				if config.Fix && p.Fixable() {
+					if err := p.Fix(); err != nil {
+						status = fmt.Sprintf(" (fix failed: %s)", err)
+					} else {
+						status = " (fixed)"
+					}
+				}
+
+				if status != " (fixed)" {
+					remaining++
+				}
+
+				if _, err := fmt.Fprintf(w, "%s%s\n", p, status); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+
+	if err != nil || remaining != 0 {
+		return 1, err
+	}
+	return 0, nil
+}
@@ -143,6 +143,21 @@ func getGates(config getGatesConfig, collection collection, id id) error {
 				return nil
 			}
 
+			// Gates are only open if their prerequisites, which may be
+			// configured in other tiers, are open as well.
+			c, err := path.Load()
+			if err != nil {
+				return err
+			}
+			defer c.Close()
+
+			for name := range enabled {
+				i := strings.IndexByte(name, '/')
+				if c.Explain(name[:i], name[i+1:], string(collection), string(id)).Prerequisite != "" {
+					delete(enabled, name)
+				}
+			}
+
 			list := make([]string, 0, len(enabled))
 			for name := range enabled {
 				list = append(list, name)
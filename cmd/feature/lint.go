@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/segmentio/feature"
+)
+
+type lintConfig struct {
+	commonConfig
+	outputConfig
+	Rules    []string `flag:"-r,--rule"  help:"Rules to apply, may be repeated (all rules are applied by default)" default:"-"`
+	Severity []string `flag:"--severity" help:"Severity of a rule as rule=warning|error|off, may be repeated"     default:"-"`
+	Format   string   `flag:"--format"   help:"Output format, one of text or json"                                default:"text"`
+	List     bool     `flag:"--list"     help:"List the available rules and exit"`
+}
+
+// lintProblem is the representation of problems in the json output format,
+// where each problem is written as a JSON object on its own line.
+type lintProblem struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+}
+
+// lint exits with a non-zero status if any problem of error severity was
+// reported, so it can be used to gate publishing databases.
+func lint(config lintConfig) (int, error) {
+	if config.List {
+		return 0, config.table(func(w io.Writer) error {
+			fmt.Fprint(w, "RULE\tSEVERITY\tDESCRIPTION\n")
+			for _, rule := range feature.LintRules() {
+				if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", rule.Name, rule.Severity, rule.Description); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	lintConfig := feature.LintConfig{
+		Rules:    config.Rules,
+		Severity: make(map[string]feature.Severity, len(config.Severity)),
+	}
+
+	for _, s := range config.Severity {
+		i := strings.IndexByte(s, '=')
+		if i < 0 {
+			return 1, fmt.Errorf("malformed severity %q, expected rule=warning|error|off", s)
+		}
+		severity, err := feature.ParseSeverity(s[i+1:])
+		if err != nil {
+			return 1, err
+		}
+		lintConfig.Severity[s[:i]] = severity
+	}
+
+	var write func(io.Writer, feature.Problem) error
+	switch config.Format {
+	case "text":
+		write = func(w io.Writer, p feature.Problem) error {
+			_, err := fmt.Fprintln(w, p)
+			return err
+		}
+	case "json":
+		write = func(w io.Writer, p feature.Problem) error {
+			return json.NewEncoder(w).Encode(lintProblem{
+				Rule:     p.Rule,
+				Severity: p.Severity.String(),
+				Path:     p.Path,
+				Message:  p.Message,
+			})
+		}
+	default:
+		return 1, fmt.Errorf("unsupported output format: %q", config.Format)
+	}
+
+	failed := false
+	err := config.mount(func(path feature.MountPoint) error {
+		problems, err := path.Lint(lintConfig)
+		if err != nil {
+			return err
+		}
+		return config.buffered(func(w io.Writer) error {
+			for _, p := range problems {
+				if p.Severity == feature.Error {
+					failed = true
+				}
+				if err := write(w, p); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+
+	if err != nil || failed {
+		return 1, err
+	}
+	return 0, nil
+}
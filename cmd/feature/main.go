@@ -2,11 +2,14 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"text/tabwriter"
+	"time"
 
 	"github.com/segmentio/cli"
 	"github.com/segmentio/cli/human"
@@ -29,19 +32,40 @@ func main() {
 			"gates": cli.Command(getGates),
 			"tiers": cli.Command(getTiers),
 		},
-		"add":    cli.Command(add),
-		"remove": cli.Command(remove),
+		"rename": cli.CommandSet{
+			"gate": cli.Command(renameGate),
+		},
+		"add":      cli.Command(add),
+		"annotate": cli.Command(annotate),
+		"remove":   cli.Command(remove),
+		"ramp":     cli.Command(ramp),
+		"require":  cli.Command(require),
 		"describe": cli.CommandSet{
 			"tier":       cli.Command(describeTier),
 			"collection": cli.Command(describeCollection),
 		},
-		"enable":  cli.Command(enable),
-		"disable": cli.Command(disable),
+		"enable":   cli.Command(enable),
+		"explain":  cli.Command(explain),
+		"fsck":     cli.Command(fsck),
+		"lint":     cli.Command(lint),
+		"manifest": cli.Command(manifest),
+		"migrate":  cli.Command(migrate),
+		"sign":     cli.Command(sign),
+		"schedule": cli.Command(schedule),
+		"stale":    cli.Command(stale),
+		"state":    cli.Command(state),
+		"disable":  cli.Command(disable),
+		"publish":  cli.Command(publish),
+		"versions": cli.Command(listVersions),
+		"rollback": cli.Command(rollback),
+		"search":   cli.Command(search),
+		"simulate": cli.Command(simulate),
 	})
 }
 
 type commonConfig struct {
-	Path human.Path `flag:"-p,--path" help:"Path to the directory where the feature database is stored" default:"~/.feature"`
+	Path        human.Path     `flag:"-p,--path" help:"Path to the directory where the feature database is stored" default:"~/.feature"`
+	LockTimeout human.Duration `flag:"--lock-timeout" help:"Maximum time to wait for locks held by other writers" default:"10s"`
 }
 
 func (c *commonConfig) mount(do func(feature.MountPoint) error) error {
@@ -49,7 +73,25 @@ func (c *commonConfig) mount(do func(feature.MountPoint) error) error {
 	if err != nil {
 		return err
 	}
-	return do(p)
+	if c.LockTimeout > 0 {
+		feature.LockTimeout = time.Duration(c.LockTimeout)
+	}
+	err = do(p)
+
+	var lockErr *feature.LockError
+	if errors.As(err, &lockErr) {
+		holder := "another process"
+		if h := lockErr.Holder; h != nil {
+			holder = fmt.Sprintf("%q (pid %d, user %s, host %s) since %s",
+				h.Command, h.PID, h.User, h.Host, h.Time.Format(time.RFC3339))
+		}
+		err = fmt.Errorf("%s: locked by %s, retry later or increase --lock-timeout", lockErr.Path, holder)
+	}
+	return err
+}
+
+type revisionConfig struct {
+	IfRevision string `flag:"--if-revision" help:"Only apply the change if the revision shown by describe tier has not changed" default:"-"`
 }
 
 type outputConfig struct {
@@ -69,12 +111,43 @@ func (c *outputConfig) table(do func(io.Writer) error) error {
 
 type family string
 
+func (f *family) UnmarshalText(b []byte) error {
+	return unmarshalName((*string)(f), "family", b)
+}
+
 type group string
 
+func (g *group) UnmarshalText(b []byte) error {
+	return unmarshalName((*string)(g), "group", b)
+}
+
 type collection string
 
+func (c *collection) UnmarshalText(b []byte) error {
+	return unmarshalName((*string)(c), "collection", b)
+}
+
 type tier string
 
+func (t *tier) UnmarshalText(b []byte) error {
+	return unmarshalName((*string)(t), "tier", b)
+}
+
 type gate string
 
+func (g *gate) UnmarshalText(b []byte) error {
+	return unmarshalName((*string)(g), "gate", b)
+}
+
+// unmarshalName validates names passed on the command line, so commands reject
+// invalid names before touching the feature database.
+func unmarshalName(s *string, kind string, b []byte) error {
+	name := string(b)
+	if err := feature.ValidateName(kind, name); err != nil {
+		return err
+	}
+	*s = name
+	return nil
+}
+
 type id string
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/segmentio/feature"
+)
+
+type manifestConfig struct {
+	commonConfig
+	Producer    string   `flag:"--producer"    help:"Producer recorded in the manifest"                                      default:"-"`
+	Verify      bool     `flag:"--verify"      help:"Verify the database against its manifest instead of writing it"`
+	TrustedKeys []string `flag:"--trusted-key" help:"Path to a PEM encoded ed25519 public key that must have signed the manifest, may be repeated" default:"-"`
+}
+
+func manifest(config manifestConfig) error {
+	return config.mount(func(path feature.MountPoint) error {
+		if config.Verify {
+			keys, err := readTrustedKeys(config.TrustedKeys)
+			if err != nil {
+				return err
+			}
+			if len(keys) != 0 {
+				if err := path.VerifySignature(keys...); err != nil {
+					return err
+				}
+			}
+			m, err := path.ReadManifest()
+			if err != nil {
+				if os.IsNotExist(err) {
+					return fmt.Errorf("%s: feature database has no manifest", path)
+				}
+				return err
+			}
+			if err := m.Verify(path); err != nil {
+				return err
+			}
+			fmt.Printf("%s: %d files verified\n", path, len(m.Files))
+			return nil
+		}
+
+		m, err := path.WriteManifest(config.Producer)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Format:\t%d\n", m.Format)
+		fmt.Printf("Created:\t%s\n", m.Created.Format(time.RFC3339))
+		fmt.Printf("Producer:\t%s\n", m.Producer)
+		fmt.Printf("Files:\t%d\n", len(m.Files))
+		return nil
+	})
+}
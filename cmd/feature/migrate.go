@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/segmentio/cli/human"
+	"github.com/segmentio/feature"
+)
+
+type migrateConfig struct {
+	commonConfig
+	outputConfig
+	Key      human.Path `flag:"-k,--key"   help:"Path to the PEM encoded ed25519 private key used to sign the migrated database" default:"-"`
+	Producer string     `flag:"--producer" help:"Producer recorded in the manifest of the migrated database"                      default:"-"`
+	List     bool       `flag:"--list"     help:"List the supported format versions and exit"`
+}
+
+// migrate rebuilds the database with a builder seeded from its current
+// content, so readers observe either the previous or the migrated database.
+func migrate(config migrateConfig, versions []string) error {
+	if config.List {
+		return config.table(func(w io.Writer) error {
+			fmt.Fprint(w, "VERSION\tDESCRIPTION\n")
+			for _, f := range feature.Formats() {
+				if _, err := fmt.Fprintf(w, "%d\t%s\n", f.Version, f.Description); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	if len(versions) > 1 {
+		return fmt.Errorf("migrate expects at most one version, got %d", len(versions))
+	}
+
+	version := feature.FormatVersion
+	if len(versions) != 0 {
+		v, err := strconv.Atoi(versions[0])
+		if err != nil {
+			return fmt.Errorf("invalid format version: %q", versions[0])
+		}
+		version = v
+	}
+
+	return config.mount(func(path feature.MountPoint) error {
+		from, err := path.Format()
+		if err != nil {
+			return err
+		}
+
+		b, err := path.NewBuilderFrom(path)
+		if err != nil {
+			return err
+		}
+		defer b.Abort()
+
+		if err := b.SetFormat(version); err != nil {
+			return err
+		}
+		b.SetProducer(config.Producer)
+
+		if config.Key != "" {
+			k, err := ioutil.ReadFile(string(config.Key))
+			if err != nil {
+				return err
+			}
+			key, err := feature.ParsePrivateKey(k)
+			if err != nil {
+				return fmt.Errorf("%s: %w", config.Key, err)
+			}
+			b.SetSigningKey(key)
+		}
+
+		if err := b.Commit(); err != nil {
+			return err
+		}
+		fmt.Printf("%s: migrated from format version %d to %d\n", path, from, version)
+		return nil
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/segmentio/feature"
+)
+
+type versionsConfig struct {
+	commonConfig
+	Versions string `flag:"--versions" help:"Path to the directory where versions of the feature database are stored (default: <path>.versions)" default:"-"`
+}
+
+func (c *versionsConfig) versions(do func(*feature.Versions) error) error {
+	return c.mount(func(path feature.MountPoint) error {
+		return do(&feature.Versions{
+			Path: path,
+			Dir:  c.Versions,
+		})
+	})
+}
+
+type publishConfig struct {
+	versionsConfig
+	Retain int `flag:"--retain" help:"Number of versions retained after publishing" default:"10"`
+}
+
+func publish(config publishConfig, dir string) error {
+	return config.versions(func(v *feature.Versions) error {
+		v.Retain = config.Retain
+		ver, err := v.Publish(dir)
+		if err != nil {
+			return err
+		}
+		fmt.Println(ver.Name)
+		return nil
+	})
+}
+
+type listVersionsConfig struct {
+	versionsConfig
+	outputConfig
+}
+
+func listVersions(config listVersionsConfig) error {
+	return config.versions(func(v *feature.Versions) error {
+		list, err := v.List()
+		if err != nil {
+			return err
+		}
+		return config.table(func(w io.Writer) error {
+			fmt.Fprint(w, "VERSION\tPUBLISHED\tCURRENT\n")
+			for _, ver := range list {
+				current := ""
+				if ver.Current {
+					current = "*"
+				}
+				if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", ver.Name, ver.Time.Format("2006-01-02 15:04:05"), current); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+type rollbackConfig struct {
+	versionsConfig
+}
+
+func rollback(config rollbackConfig, versions []string) error {
+	if len(versions) > 1 {
+		return fmt.Errorf("rollback expects at most one version, got %d", len(versions))
+	}
+	return config.versions(func(v *feature.Versions) error {
+		name := ""
+		if len(versions) != 0 {
+			name = versions[0]
+		}
+		ver, err := v.Rollback(name)
+		if err != nil {
+			return err
+		}
+		fmt.Println(ver.Name)
+		return nil
+	})
+}
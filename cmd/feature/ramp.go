@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/segmentio/cli/human"
+	"github.com/segmentio/feature"
+)
+
+type rampConfig struct {
+	commonConfig
+	Linear bool `flag:"-l,--linear" help:"Interpolates the volume linearly between the steps of the ramp"`
+}
+
+// ramp replaces the ramp of a gate, passing no steps removes it.
+func ramp(config rampConfig, group group, tier tier, family family, gate gate, collection collection, steps []rampStep) error {
+	return config.mount(func(path feature.MountPoint) error {
+		t, err := path.OpenTier(string(group), string(tier))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s/%s: tier does not exist\n", group, tier)
+			}
+			return err
+		}
+		defer t.Close()
+
+		r := feature.Ramp{Linear: config.Linear}
+		for _, step := range steps {
+			r.Steps = append(r.Steps, feature.RampStep(step))
+		}
+
+		if err := t.RampGate(string(family), string(gate), string(collection), r); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s/%s: gate does not exist in tier %s/%s for collection %s", family, gate, group, tier, collection)
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// rampStep is a step of a ramp, as "volume@time" where the volume is a ratio
+// like 10%, and the time is parsed like the times of schedules.
+type rampStep feature.RampStep
+
+func (s *rampStep) UnmarshalText(b []byte) error {
+	str := string(b)
+	i := strings.IndexByte(str, '@')
+	if i < 0 {
+		return fmt.Errorf("malformed ramp step %q, expected volume@time", str)
+	}
+	volume, err := human.ParseRatio(str[:i])
+	if err != nil {
+		return fmt.Errorf("malformed ramp step %q: %w", str, err)
+	}
+	t, err := parseScheduleTime(str[i+1:])
+	if err != nil {
+		return fmt.Errorf("malformed ramp step %q: %w", str, err)
+	}
+	*s = rampStep{Time: t, Volume: float64(volume)}
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/segmentio/feature"
+)
+
+type renameGateConfig struct {
+	commonConfig
+}
+
+// renameGate renames the gate in all tiers, the former name remains usable by
+// programs evaluating the gate through the aliases left behind.
+func renameGate(config renameGateConfig, family family, gate gate, newFamily family, newGate gate) error {
+	return config.mount(func(path feature.MountPoint) error {
+		err := path.RenameGate(string(family), string(gate), string(newFamily), string(newGate))
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s/%s: gate does not exist in any tier", family, gate)
+		}
+		return err
+	})
+}
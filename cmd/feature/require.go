@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/segmentio/feature"
+)
+
+type requireConfig struct {
+	commonConfig
+}
+
+// require replaces the prerequisites of a gate, passing no prerequisites
+// removes them.
+func require(config requireConfig, group group, tier tier, family family, gate gate, prerequisites []gateName) error {
+	return config.mount(func(path feature.MountPoint) error {
+		t, err := path.OpenTier(string(group), string(tier))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s/%s: tier does not exist\n", group, tier)
+			}
+			return err
+		}
+		defer t.Close()
+
+		list := make([]string, len(prerequisites))
+		for i, p := range prerequisites {
+			list[i] = string(p)
+		}
+
+		if err := t.SetGatePrerequisites(string(family), string(gate), list); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s/%s: gate does not exist in tier %s/%s", family, gate, group, tier)
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// gateName is a gate name qualified by its family, as "family/gate".
+type gateName string
+
+func (g *gateName) UnmarshalText(b []byte) error {
+	s := string(b)
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return fmt.Errorf("malformed gate name %q, expected family/gate", s)
+	}
+	if err := feature.ValidateName("family", s[:i]); err != nil {
+		return err
+	}
+	if err := feature.ValidateName("gate", s[i+1:]); err != nil {
+		return err
+	}
+	*g = gateName(s)
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/segmentio/cli/human"
+	"github.com/segmentio/feature"
+)
+
+type scheduleConfig struct {
+	commonConfig
+	Start string `flag:"-s,--start" help:"Time at which the gate starts applying its configuration, or none" default:"-"`
+	End   string `flag:"-e,--end"   help:"Time at which the gate stops applying its configuration, or none"  default:"-"`
+}
+
+// schedule only modifies the times passed on the command line, so the start
+// and end of a schedule can be changed independently.
+func schedule(config scheduleConfig, group group, tier tier, family family, gate gate, collection collection) error {
+	return config.mount(func(path feature.MountPoint) error {
+		t, err := path.OpenTier(string(group), string(tier))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s/%s: tier does not exist\n", group, tier)
+			}
+			return err
+		}
+		defer t.Close()
+
+		start, end, err := t.ReadGateSchedule(string(family), string(gate), string(collection))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s/%s: gate does not exist in tier %s/%s for collection %s", family, gate, group, tier, collection)
+			}
+			return err
+		}
+		if config.Start != "" {
+			if start, err = parseScheduleTime(config.Start); err != nil {
+				return err
+			}
+		}
+		if config.End != "" {
+			if end, err = parseScheduleTime(config.End); err != nil {
+				return err
+			}
+		}
+		return t.ScheduleGate(string(family), string(gate), string(collection), start, end)
+	})
+}
+
+// parseScheduleTime parses RFC3339 times, dates, absolute or relative times
+// supported by the human package, and "none" which unbounds the schedule.
+func parseScheduleTime(s string) (time.Time, error) {
+	if s == "none" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := human.ParseTime(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid schedule time: %w", err)
+	}
+	return time.Time(t), nil
+}
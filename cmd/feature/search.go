@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/segmentio/feature"
+)
+
+type searchConfig struct {
+	commonConfig
+	outputConfig
+	Tags  []string `flag:"-t,--tag"   help:"Only list gates with this tag, may be repeated" default:"-"`
+	Owner string   `flag:"-o,--owner" help:"Only list gates owned by this team or person"    default:"-"`
+}
+
+// search lists the gates of all tiers matching the metadata passed on the
+// command line, gates must have all the tags to be listed.
+func search(config searchConfig) error {
+	return config.mount(func(path feature.MountPoint) error {
+		return config.table(func(w io.Writer) error {
+			fmt.Fprint(w, "GROUP\tTIER\tFAMILY\tGATE\tOWNER\tTAGS\tDESCRIPTION\n")
+			return feature.Scan(path.Groups(), func(group string) error {
+				return feature.Scan(path.Tiers(group), func(tier string) error {
+					t, err := path.OpenTier(group, tier)
+					if err != nil {
+						return err
+					}
+					defer t.Close()
+
+					return feature.Scan(t.Families(), func(family string) error {
+						return feature.Scan(t.Gates(family), func(gate string) error {
+							m, err := t.ReadGateMetadata(family, gate)
+							if err != nil {
+								return err
+							}
+							if config.Owner != "" && m.Owner != config.Owner {
+								return nil
+							}
+							for _, tag := range config.Tags {
+								if !m.HasTag(tag) {
+									return nil
+								}
+							}
+							_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+								group, tier, family, gate, m.Owner, strings.Join(m.Tags, ","), m.Description)
+							return err
+						})
+					})
+				})
+			})
+		})
+	})
+}
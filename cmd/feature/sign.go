@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/segmentio/cli/human"
+	"github.com/segmentio/feature"
+)
+
+type signConfig struct {
+	commonConfig
+	Key      human.Path `flag:"-k,--key"   help:"Path to the PEM encoded ed25519 private key used to sign the database"`
+	Producer string     `flag:"--producer" help:"Producer recorded in the manifest if the database has none" default:"-"`
+}
+
+// sign refuses to sign databases which do not match their manifest, since the
+// signature would vouch for content that was never verified.
+func sign(config signConfig) error {
+	b, err := ioutil.ReadFile(string(config.Key))
+	if err != nil {
+		return err
+	}
+	key, err := feature.ParsePrivateKey(b)
+	if err != nil {
+		return fmt.Errorf("%s: %w", config.Key, err)
+	}
+
+	return config.mount(func(path feature.MountPoint) error {
+		m, err := path.ReadManifest()
+		switch {
+		case os.IsNotExist(err):
+			m, err = path.WriteManifest(config.Producer)
+		case err == nil:
+			err = m.Verify(path)
+		}
+		if err != nil {
+			return err
+		}
+		if err := path.Sign(key); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d files signed\n", path, len(m.Files))
+		return nil
+	})
+}
+
+// readTrustedKeys reads the PEM encoded ed25519 public keys at the given paths.
+func readTrustedKeys(paths []string) ([]ed25519.PublicKey, error) {
+	keys := make([]ed25519.PublicKey, 0, len(paths))
+	for _, p := range paths {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		k, err := feature.ParsePublicKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
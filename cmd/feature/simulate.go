@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/segmentio/feature"
+)
+
+type simulateConfig struct {
+	commonConfig
+	outputConfig
+	Buckets uint64 `flag:"-b,--buckets" help:"Overrides the number of buckets of the gate" default:"0"`
+	Hash    string `flag:"--hash"       help:"Overrides the hash algorithm of the gate (fnv64a, sha1, murmur3)" default:"-"`
+}
+
+// simulate shows the buckets that a gate assigns ids to, and whether the gate
+// is open for them at its current volume. The ids are read from the standard
+// input, one per line, when none are passed on the command line.
+func simulate(config simulateConfig, group group, tier tier, family family, gate gate, collection collection, ids []id) error {
+	return config.mount(func(path feature.MountPoint) error {
+		t, err := path.OpenTier(string(group), string(tier))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s/%s: tier does not exist\n", group, tier)
+			}
+			return err
+		}
+		defer t.Close()
+
+		list := make([]string, len(ids))
+		for i, id := range ids {
+			list[i] = string(id)
+		}
+		if len(list) == 0 {
+			s := bufio.NewScanner(os.Stdin)
+			for s.Scan() {
+				if id := s.Text(); id != "" {
+					list = append(list, id)
+				}
+			}
+			if err := s.Err(); err != nil {
+				return err
+			}
+		}
+
+		simulations, err := t.SimulateGate(string(family), string(gate), string(collection), list, config.Hash, config.Buckets)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s/%s: gate does not exist in tier %s/%s for collection %s", family, gate, group, tier, collection)
+			}
+			return err
+		}
+
+		return config.table(func(w io.Writer) error {
+			fmt.Fprint(w, "ID\tBUCKET\tOPEN\n")
+			for _, s := range simulations {
+				if _, err := fmt.Fprintf(w, "%s\t%d\t%t\n", s.ID, s.Bucket, s.Open); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/segmentio/cli/human"
+	"github.com/segmentio/feature"
+)
+
+type staleConfig struct {
+	commonConfig
+	outputConfig
+	RolledOutFor human.Duration `flag:"--rolled-out-for" help:"Report gates fully rolled out for longer than this duration (0 to disable)" default:"90d"`
+}
+
+// stale lists gates which expired or have been fully rolled out for longer
+// than the threshold, a gate may be reported for both reasons.
+func stale(config staleConfig) error {
+	return config.mount(func(path feature.MountPoint) error {
+		now := time.Now()
+
+		gates, err := path.StaleGates(now, time.Duration(config.RolledOutFor))
+		if err != nil {
+			return err
+		}
+
+		return config.table(func(w io.Writer) error {
+			fmt.Fprint(w, "GROUP\tTIER\tFAMILY\tGATE\tREASON\n")
+			for _, g := range gates {
+				if !g.Expires.IsZero() {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\texpired on %s\n",
+						g.Group, g.Tier, g.Family, g.Gate, g.Expires.Format(time.RFC3339))
+				}
+				if !g.RolledOut.IsZero() {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\tfully rolled out for %v\n",
+						g.Group, g.Tier, g.Family, g.Gate, human.Duration(now.Sub(g.RolledOut)))
+				}
+			}
+			return nil
+		})
+	})
+}
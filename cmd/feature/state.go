@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/segmentio/feature"
+)
+
+type stateConfig struct {
+	commonConfig
+}
+
+// state changes the lifecycle state of a gate, transitions that are not
+// allowed from the current state are rejected.
+func state(config stateConfig, group group, tier tier, family family, gate gate, state gateState) error {
+	return config.mount(func(path feature.MountPoint) error {
+		t, err := path.OpenTier(string(group), string(tier))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s/%s: tier does not exist\n", group, tier)
+			}
+			return err
+		}
+		defer t.Close()
+
+		if err := t.SetGateState(string(family), string(gate), feature.GateState(state)); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%s/%s: gate does not exist in tier %s/%s", family, gate, group, tier)
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+type gateState feature.GateState
+
+func (s *gateState) UnmarshalText(b []byte) error {
+	state, err := feature.ParseGateState(string(b))
+	if err != nil {
+		return err
+	}
+	*s = gateState(state)
+	return nil
+}
@@ -2,9 +2,11 @@ package feature
 
 import (
 	"bufio"
+	"bytes"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -28,36 +30,59 @@ func (it *IDIter) Next() bool { return it.next() }
 
 func (it *IDIter) Name() string { return it.line }
 
+// Collection is a handle used to update collections of ids.
+//
+// Ids added to the collection are buffered in memory until the collection is
+// synced or closed, at which point the collection file is atomically replaced
+// with a new version containing the previous and added ids.
+//
+// Collections hold the lock of their tier while being rewritten, so
+// concurrent writers to the same collection do not lose updates.
 type Collection struct {
-	file *os.File
-	buf  *bufio.Writer
-	err  error
+	tier    *Tier
+	path    string
+	pending bytes.Buffer
+	err     error
 }
 
 func (col *Collection) Path() string {
-	if col.file != nil {
-		return col.file.Name()
-	}
-	return ""
+	return col.path
 }
 
 func (col *Collection) Close() error {
-	if col.buf != nil {
-		col.err = col.buf.Flush()
-		col.buf = nil
-	}
-	if col.file != nil {
-		col.file.Close()
-		col.file = nil
+	if col.path != "" {
+		col.Sync()
+		col.path = ""
 	}
 	return col.err
 }
 
+// Sync writes the ids added to the collection to the file system.
 func (col *Collection) Sync() error {
-	if col.buf != nil {
-		return col.buf.Flush()
+	return col.CompareAndSync("")
+}
+
+// Revision returns the current revision of the collection on the file system.
+func (col *Collection) Revision() (string, error) {
+	return revision(col.path)
+}
+
+// CompareAndSync is like Sync but fails with a *ConflictError if the revision
+// of the collection differs from the one passed as argument. An empty revision
+// matches any revision of the collection.
+//
+// On conflict, the ids added to the collection remain buffered, the program may
+// call CompareAndSync again with the new revision to retry.
+func (col *Collection) CompareAndSync(revision string) error {
+	if col.pending.Len() == 0 {
+		if col.err != nil || col.path == "" {
+			return col.err
+		}
+		// There is nothing to write, but the program must still learn that
+		// the revision it expected is stale.
+		return compareRevision(col.path, revision)
 	}
-	return nil
+	return col.update(revision, nil)
 }
 
 func (col *Collection) IDs() *IDIter {
@@ -65,30 +90,140 @@ func (col *Collection) IDs() *IDIter {
 }
 
 func (col *Collection) ids() file {
-	if col.file != nil {
-		return readfile(col.file.Name())
+	if col.path != "" {
+		return readfile(col.path)
 	}
 	return file{}
 }
 
 func (col *Collection) Add(id string) error {
-	if col.err == nil {
-		col.err = col.writeLine(id)
+	if col.err == nil && col.path != "" {
+		col.pending.WriteString(id)
+		col.pending.WriteByte('\n')
 	}
 	return col.err
 }
 
-func (col *Collection) writeLine(s string) error {
-	if col.file == nil {
+// Remove removes ids from the collection. Ids previously added to the
+// collection are synced first.
+func (col *Collection) Remove(ids ...string) error {
+	return col.CompareAndRemove("", ids...)
+}
+
+// CompareAndRemove is like Remove but fails with a *ConflictError if the
+// revision of the collection differs from the one passed as argument. An empty
+// revision matches any revision of the collection.
+func (col *Collection) CompareAndRemove(revision string, ids ...string) error {
+	if len(ids) == 0 {
+		return col.CompareAndSync(revision)
+	}
+
+	index := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		index[id] = struct{}{}
+	}
+
+	return col.update(revision, index)
+}
+
+// update rewrites the collection with the pending ids added, and the ids in
+// the skip set removed.
+//
+// Conflicts are not recorded as errors of the collection, so the program may
+// retry with a different revision.
+func (col *Collection) update(revision string, skip map[string]struct{}) error {
+	if col.err != nil || col.path == "" {
+		return col.err
+	}
+
+	err := col.rewrite(revision, func(w *bufio.Writer) error {
+		format, err := readFormat(string(col.tier.path))
+		if err != nil {
+			return err
+		}
+		if format >= 2 {
+			return col.mergeTo(w, skip)
+		}
+		if err := col.copyTo(w, skip); err != nil {
+			return err
+		}
+		for _, id := range strings.SplitAfter(col.pending.String(), "\n") {
+			if _, rm := skip[strings.TrimSuffix(id, "\n")]; !rm {
+				w.WriteString(id)
+			}
+		}
 		return nil
+	})
+
+	switch err.(type) {
+	case nil:
+		col.pending.Reset()
+	case *ConflictError:
+	default:
+		col.err = err
 	}
-	if col.buf == nil {
-		col.buf = bufio.NewWriter(col.file)
+
+	return err
+}
+
+// copyTo writes the ids of the collection to w, excluding those in the skip
+// set.
+func (col *Collection) copyTo(w *bufio.Writer, skip map[string]struct{}) error {
+	return Scan(col.IDs(), func(id string) error {
+		if _, rm := skip[id]; !rm {
+			w.WriteString(id)
+			w.WriteByte('\n')
+		}
+		return nil
+	})
+}
+
+// mergeTo is like copyTo but merges the pending ids with the ids of the
+// collection, which is expected to be sorted, so the collection remains sorted
+// and deduplicated as required by format version 2.
+func (col *Collection) mergeTo(w *bufio.Writer, skip map[string]struct{}) error {
+	pending := strings.Split(col.pending.String(), "\n")
+	sort.Strings(pending)
+
+	prev := ""
+	write := func(id string) {
+		if _, rm := skip[id]; !rm && id != "" && id != prev {
+			w.WriteString(id)
+			w.WriteByte('\n')
+			prev = id
+		}
 	}
-	if _, err := col.buf.WriteString(s); err != nil {
+
+	if err := Scan(col.IDs(), func(id string) error {
+		for len(pending) != 0 && pending[0] < id {
+			write(pending[0])
+			pending = pending[1:]
+		}
+		write(id)
+		return nil
+	}); err != nil {
 		return err
 	}
-	return col.buf.WriteByte('\n')
+
+	for _, id := range pending {
+		write(id)
+	}
+	return nil
+}
+
+func (col *Collection) rewrite(revision string, write func(*bufio.Writer) error) error {
+	return col.tier.update(col.path, func() error {
+		if err := compareRevision(col.path, revision); err != nil {
+			return err
+		}
+		return writeFile(col.path, func(f *os.File) error {
+			w := bufio.NewWriter(f)
+			if err := write(w); err != nil {
+				return err
+			}
+			return w.Flush()
+		})
+	})
 }
 
 type file struct {
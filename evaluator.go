@@ -0,0 +1,21 @@
+package feature
+
+// Evaluator is an interface implemented by types that evaluate the state of
+// feature gates.
+//
+// Both Cache and Store implement the interface, programs that only need to
+// test gates should depend on Evaluator rather than the concrete types so
+// they can substitute fakes in tests (see the featuretest package).
+type Evaluator interface {
+	// GateOpen returns true if a gate is opened for a given id.
+	GateOpen(family, gate, collection, id string) bool
+
+	// LookupGates returns the sorted list of open gates in a family for a
+	// given id. The returned slice must be treated as immutable.
+	LookupGates(family, collection, id string) []string
+}
+
+var (
+	_ Evaluator = (*Cache)(nil)
+	_ Evaluator = (*Store)(nil)
+)
@@ -0,0 +1,86 @@
+package feature
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Explanation describes how the state of a gate was determined for an id, as
+// returned by Cache.Explain.
+type Explanation struct {
+	// The canonical name of the gate, which differs from the name passed to
+	// Explain if it was an alias.
+	Family string
+	Gate   string
+
+	Collection string
+	ID         string
+	Open       bool
+
+	// Group and Tier are the names of the tier which determined the state of
+	// the gate, using the same rules as exposures. They are empty if none of
+	// the tiers had a configuration for the gate and collection.
+	Group string
+	Tier  string
+
+	// The prerequisite which closed the gate, in the "family/gate" form. It is
+	// empty if the gate is open, or closed by its own configuration.
+	Prerequisite string
+}
+
+// String returns a human-readable description of the explanation.
+func (e Explanation) String() string {
+	state := "closed"
+	if e.Open {
+		state = "open"
+	}
+
+	s := fmt.Sprintf("%s/%s is %s for %s %s", e.Family, e.Gate, state, e.Collection, e.ID)
+	switch {
+	case e.Prerequisite != "":
+		s += fmt.Sprintf(": prerequisite %s is closed", e.Prerequisite)
+	case e.Group != "":
+		s += fmt.Sprintf(": decided by tier %s/%s", e.Group, e.Tier)
+	default:
+		s += ": the gate has no configuration for the collection"
+	}
+	return s
+}
+
+// Explain evaluates a gate for an id, and returns a description of how its
+// state was determined. Unlike GateOpen, the evaluation is not reported to the
+// exposure listener.
+func (c *Cache) Explain(family, gate, collection, id string) Explanation {
+	family, gate = c.resolve(family, gate)
+
+	e := Explanation{
+		Family:     family,
+		Gate:       gate,
+		Collection: collection,
+		ID:         id,
+	}
+	e.Group, e.Tier, _, _ = c.decision(family, gate, collection, id, Identifier{}, nil)
+
+	h := acquireBufferedHash64()
+	defer releaseBufferedHash64(h)
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	now := c.now()
+	gates := c.evaluateTiers(family, collection, id, Identifier{}, now, h)
+	if i := sort.SearchStrings(gates, gate); i < len(gates) && gates[i] == gate {
+		if p, closed := c.closedPrerequisite(gateName{family, gate}, collection, id, Identifier{}, now, h); closed {
+			e.Prerequisite = p.family + "/" + p.gate
+		} else {
+			e.Open = true
+		}
+	}
+
+	return e
+}
+
+// Explain evaluates a gate for an id, see Cache.Explain.
+func (s *Store) Explain(family, gate, collection, id string) Explanation {
+	return s.cache.Explain(family, gate, collection, id)
+}
@@ -0,0 +1,279 @@
+package feature
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Exposure values are delivered to exposure listeners each time a gate is
+// evaluated for an id.
+type Exposure struct {
+	Family     string
+	Gate       string
+	Collection string
+	ID         string
+	Open       bool
+
+	// Key is the bucketing key the gate was evaluated with (see
+	// Cache.GateOpenKey), zero if none was passed. Exposures of subjects carry
+	// the identifiers of the subject instead, see Cache.GateOpenSubject.
+	Key Identifier
+
+	// Group and Tier are the names of the tier which determined the state of
+	// the gate. They are empty if none of the tiers had a configuration for
+	// the gate and collection.
+	Group string
+	Tier  string
+
+	// The prerequisite which closed the gate, in the "family/gate" form. It is
+	// empty if the gate is open, or closed by its own configuration.
+	Prerequisite string
+
+	// Generation is the version of the feature database that the exposure was
+	// evaluated against. It is incremented each time a Store reloads.
+	Generation uint64
+}
+
+// ExposureListener is an interface implemented by types that receive gate
+// exposures.
+//
+// The Expose method is called synchronously from the goroutine evaluating the
+// gate, implementations should offload expensive work (e.g. network calls) to
+// background goroutines.
+type ExposureListener interface {
+	Expose(Exposure)
+}
+
+// ExposureListenerFunc is an adapter to allow the use of ordinary functions as
+// exposure listeners.
+type ExposureListenerFunc func(Exposure)
+
+// Expose calls f(e).
+func (f ExposureListenerFunc) Expose(e Exposure) { f(e) }
+
+// ExposureConfig carries the configuration of exposure listeners installed on
+// Cache and Store values.
+type ExposureConfig struct {
+	// The listener receiving exposures, setting it to nil uninstalls the
+	// previous listener.
+	Listener ExposureListener
+
+	// Fraction of ids that exposures are reported for, between 0 and 1. The
+	// sampling is deterministic, a sampled id always has its exposures
+	// reported. Zero means that all exposures are reported.
+	SampleRate float64
+
+	// When non-zero, repeated exposures of the same gate, collection, and id
+	// with the same result are only reported once per window.
+	DedupWindow time.Duration
+}
+
+type exposureLogger struct {
+	listener ExposureListener
+	sample   uint64
+	window   time.Duration
+
+	mutex  sync.Mutex
+	rotate time.Time
+	recent map[string]bool
+	oldest map[string]bool
+}
+
+const exposureSampleBuckets = 1e6
+
+func newExposureLogger(config ExposureConfig) *exposureLogger {
+	x := &exposureLogger{
+		listener: config.Listener,
+		sample:   exposureSampleBuckets,
+		window:   config.DedupWindow,
+	}
+	if config.SampleRate > 0 && config.SampleRate < 1 {
+		x.sample = uint64(config.SampleRate * exposureSampleBuckets)
+	}
+	return x
+}
+
+func (x *exposureLogger) sampled(id string) bool {
+	if x.sample == exposureSampleBuckets {
+		return true
+	}
+	h := acquireBufferedHash64()
+	defer releaseBufferedHash64(h)
+	h.buffer.WriteString(id)
+	h.buffer.WriteTo(h.hash)
+	return (h.hash.Sum64() % exposureSampleBuckets) < x.sample
+}
+
+// duplicate returns true if the exposure was already reported within the
+// deduplication window. The method records the exposure as a side effect.
+func (x *exposureLogger) duplicate(e *Exposure, now time.Time) bool {
+	if x.window <= 0 {
+		return false
+	}
+
+	key := e.Family + "\x00" + e.Gate + "\x00" + e.Collection + "\x00" + e.ID + "\x00" + e.Key.Collection + "\x00" + e.Key.ID
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if now.Sub(x.rotate) >= x.window {
+		// Entries are retained for at least one window and at most two, which
+		// bounds the memory footprint without having to track the time of each
+		// exposure.
+		x.oldest, x.recent = x.recent, make(map[string]bool)
+		x.rotate = now
+	}
+
+	if open, ok := x.recent[key]; ok && open == e.Open {
+		return true
+	}
+	if open, ok := x.oldest[key]; ok && open == e.Open {
+		x.recent[key] = open
+		return true
+	}
+
+	x.recent[key] = e.Open
+	return false
+}
+
+// expose reports the exposure of a gate for an id, evaluated with a bucketing
+// key or, if subject is not nil, with the identifiers of the subject.
+func (x *exposureLogger) expose(c *Cache, family, gate, collection, id string, key Identifier, subject Subject, open bool) {
+	if !x.sampled(id) {
+		return
+	}
+
+	e := Exposure{
+		Family:     family,
+		Gate:       gate,
+		Collection: collection,
+		ID:         id,
+		Open:       open,
+		Key:        key,
+	}
+
+	if x.duplicate(&e, time.Now()) {
+		return
+	}
+
+	var p gateName
+	e.Group, e.Tier, p, e.Generation = c.decision(family, gate, collection, id, key, subject)
+	if p != (gateName{}) {
+		e.Prerequisite = p.family + "/" + p.gate
+	}
+	x.listener.Expose(e)
+}
+
+// SetExposureListener installs an exposure listener on the cache, replacing
+// the previous one.
+//
+// When no listeners are installed, gate evaluations do not incur any extra
+// costs.
+func (c *Cache) SetExposureListener(config ExposureConfig) {
+	var x *exposureLogger
+	if config.Listener != nil {
+		x = newExposureLogger(config)
+	}
+	c.exposure.Store(x)
+}
+
+// SetExposureListener installs an exposure listener on the store, replacing
+// the previous one. The listener remains installed when the store reloads.
+func (s *Store) SetExposureListener(config ExposureConfig) {
+	s.cache.SetExposureListener(config)
+}
+
+func (c *Cache) exposures() *exposureLogger {
+	x, _ := c.exposure.Load().(*exposureLogger)
+	return x
+}
+
+func (c *Cache) exposeGates(x *exposureLogger, family, collection, id string, key Identifier, open []string) {
+	for _, gate := range c.gateNames(family, collection) {
+		i := sort.SearchStrings(open, gate)
+		x.expose(c, family, gate, collection, id, key, nil, i < len(open) && open[i] == gate)
+	}
+}
+
+// gateNames returns the sorted list of gates of family which have a
+// configuration for collection in at least one tier.
+func (c *Cache) gateNames(family, collection string) []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	names := make([]string, 0, 8)
+	for i := range c.tiers {
+		for _, g := range c.tiers[i].gates[family] {
+			if g.collection == collection {
+				names = append(names, g.name)
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	sort.Strings(names)
+	return deduplicate(names)
+}
+
+// decision returns the group and name of the tier which determined the state
+// of a gate for an id, using the same precedence rules as LookupGates: tiers
+// that contain the id and close the gate win over the tiers that open it, and
+// tiers that contain the id win over the tiers applying their default state.
+//
+// When the configuration of the tiers opens the gate, the method also returns
+// the first prerequisite which closes it, if any.
+//
+// When subject is not nil, gates bucketing by another collection use the id of
+// the subject in that collection as bucketing key, like GateOpenSubject, and
+// prerequisites are evaluated for the subject.
+func (c *Cache) decision(family, gate, collection, id string, key Identifier, subject Subject) (group, tier string, prerequisite gateName, generation uint64) {
+	h := acquireBufferedHash64()
+	defer releaseBufferedHash64(h)
+
+	now := c.now()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var closed, opened, defaulted, configured *cachedTier
+
+	c.evaluateGateTiers(gateName{family, gate}, collection, id, key, subject, now, h, func(r tierResult) {
+		if configured == nil {
+			configured = r.tier
+		}
+		switch {
+		case r.listed && !r.open:
+			if closed == nil {
+				closed = r.tier
+			}
+		case r.listed:
+			if opened == nil {
+				opened = r.tier
+			}
+		case r.open:
+			if defaulted == nil {
+				defaulted = r.tier
+			}
+		}
+	})
+
+	if closed == nil && (opened != nil || defaulted != nil) {
+		name := gateName{family, gate}
+		if subject != nil {
+			prerequisite, _ = c.closedSubjectPrerequisite(name, subject, now, h)
+		} else {
+			prerequisite, _ = c.closedPrerequisite(name, collection, id, key, now, h)
+		}
+	}
+
+	for _, t := range [...]*cachedTier{closed, opened, defaulted, configured} {
+		if t != nil {
+			return t.group, t.name, prerequisite, c.generation
+		}
+	}
+	return "", "", prerequisite, c.generation
+}
@@ -0,0 +1,295 @@
+package feature_test
+
+import (
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/segmentio/feature"
+)
+
+func TestExposure(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, *feature.Cache)
+	}{
+		{
+			scenario: "exposures are reported with the tier which determined the gate state",
+			function: testExposureReported,
+		},
+
+		{
+			scenario: "looking up gates reports an exposure for each gate of the family",
+			function: testExposureLookupGates,
+		},
+
+		{
+			scenario: "repeated exposures are deduplicated within the window",
+			function: testExposureDeduplicated,
+		},
+
+		{
+			scenario: "exposures are not reported for ids which are not sampled",
+			function: testExposureSampled,
+		},
+
+		{
+			scenario: "evaluating gates without listeners does not allocate memory",
+			function: testExposureNoAllocs,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "feature")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+			path := feature.MountPoint(tmp)
+
+			tier1 := createTier(t, path, "standard", "1")
+			tier2 := createTier(t, path, "standard", "2")
+
+			defer tier1.Close()
+			defer tier2.Close()
+
+			col1 := createCollection(t, tier1, "workspaces")
+			defer col1.Close()
+			populateCollection(t, col1, []string{"id-1"})
+
+			createGate(t, tier1, "family-A", "gate-1", "workspaces", 1234)
+			createGate(t, tier1, "family-A", "gate-2", "workspaces", 2345)
+			createGate(t, tier2, "family-A", "gate-1", "workspaces", 1234)
+
+			enableGate(t, tier1, "family-A", "gate-1", "workspaces", 1.0, false)
+			enableGate(t, tier1, "family-A", "gate-2", "workspaces", 0.0, false)
+			enableGate(t, tier2, "family-A", "gate-1", "workspaces", 0.0, true)
+
+			cache, err := path.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cache.Close()
+
+			test.function(t, cache)
+		})
+	}
+}
+
+func testExposureReported(t *testing.T, cache *feature.Cache) {
+	var exposures []feature.Exposure
+	cache.SetExposureListener(feature.ExposureConfig{
+		Listener: feature.ExposureListenerFunc(func(e feature.Exposure) {
+			exposures = append(exposures, e)
+		}),
+	})
+
+	cache.GateOpen("family-A", "gate-1", "workspaces", "id-1")
+	cache.GateOpen("family-A", "gate-1", "workspaces", "id-2")
+	cache.GateOpen("family-A", "gate-2", "workspaces", "id-1")
+
+	expectExposures(t, exposures, []feature.Exposure{
+		{Family: "family-A", Gate: "gate-1", Collection: "workspaces", ID: "id-1", Open: true, Group: "standard", Tier: "1"},
+		{Family: "family-A", Gate: "gate-1", Collection: "workspaces", ID: "id-2", Open: true, Group: "standard", Tier: "2"},
+		{Family: "family-A", Gate: "gate-2", Collection: "workspaces", ID: "id-1", Open: false, Group: "standard", Tier: "1"},
+	})
+}
+
+func testExposureLookupGates(t *testing.T, cache *feature.Cache) {
+	var exposures []feature.Exposure
+	cache.SetExposureListener(feature.ExposureConfig{
+		Listener: feature.ExposureListenerFunc(func(e feature.Exposure) {
+			exposures = append(exposures, e)
+		}),
+	})
+
+	cache.LookupGates("family-A", "workspaces", "id-1")
+
+	expectExposures(t, exposures, []feature.Exposure{
+		{Family: "family-A", Gate: "gate-1", Collection: "workspaces", ID: "id-1", Open: true, Group: "standard", Tier: "1"},
+		{Family: "family-A", Gate: "gate-2", Collection: "workspaces", ID: "id-1", Open: false, Group: "standard", Tier: "1"},
+	})
+}
+
+func testExposureDeduplicated(t *testing.T, cache *feature.Cache) {
+	var exposures []feature.Exposure
+	cache.SetExposureListener(feature.ExposureConfig{
+		Listener: feature.ExposureListenerFunc(func(e feature.Exposure) {
+			exposures = append(exposures, e)
+		}),
+		DedupWindow: time.Hour,
+	})
+
+	for i := 0; i < 10; i++ {
+		cache.GateOpen("family-A", "gate-1", "workspaces", "id-1")
+		cache.GateOpen("family-A", "gate-1", "workspaces", "id-2")
+	}
+
+	expectExposures(t, exposures, []feature.Exposure{
+		{Family: "family-A", Gate: "gate-1", Collection: "workspaces", ID: "id-1", Open: true, Group: "standard", Tier: "1"},
+		{Family: "family-A", Gate: "gate-1", Collection: "workspaces", ID: "id-2", Open: true, Group: "standard", Tier: "2"},
+	})
+}
+
+func testExposureSampled(t *testing.T, cache *feature.Cache) {
+	count := 0
+	cache.SetExposureListener(feature.ExposureConfig{
+		Listener: feature.ExposureListenerFunc(func(e feature.Exposure) {
+			count++
+		}),
+		SampleRate: 0.5,
+	})
+
+	const N = 1000
+	for i := 0; i < N; i++ {
+		cache.GateOpen("family-A", "gate-1", "workspaces", "id-"+strconv.Itoa(i))
+	}
+
+	if count == 0 || count == N {
+		t.Errorf("exposures were not sampled: %d/%d", count, N)
+	}
+}
+
+func testExposureNoAllocs(t *testing.T, cache *feature.Cache) {
+	cache.SetExposureListener(feature.ExposureConfig{
+		Listener: feature.ExposureListenerFunc(func(feature.Exposure) {}),
+	})
+	cache.SetExposureListener(feature.ExposureConfig{})
+	cache.GateOpen("family-A", "gate-1", "workspaces", "id-1")
+
+	allocs := testing.AllocsPerRun(100, func() {
+		cache.GateOpen("family-A", "gate-1", "workspaces", "id-1")
+	})
+
+	if allocs != 0 {
+		t.Errorf("gate evaluation allocated memory: %g allocs/op", allocs)
+	}
+}
+
+func TestExposureBuckets(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	path := feature.MountPoint(tmp)
+
+	// gate-2 is open for all ids in tier 0, so tier 1 determines its state
+	// whenever it closes the gate.
+	tier0 := createTier(t, path, "standard", "0")
+	tier1 := createTier(t, path, "standard", "1")
+	defer tier0.Close()
+	defer tier1.Close()
+
+	ids := makeIDs("id-%03d", 100)
+	populateCollection(t, createCollection(t, tier0, "workspaces"), ids)
+	populateCollection(t, createCollection(t, tier1, "workspaces"), ids)
+
+	createGate(t, tier0, "family-A", "gate-2", "workspaces", 2345)
+	enableGate(t, tier0, "family-A", "gate-2", "workspaces", 1, false)
+	createGate(t, tier1, "family-A", "gate-1", "workspaces", 1234)
+	enableGate(t, tier1, "family-A", "gate-1", "workspaces", 0.5, false)
+	createGate(t, tier1, "family-A", "gate-2", "workspaces", 2345)
+	enableGate(t, tier1, "family-A", "gate-2", "workspaces", 0.5, false)
+
+	cache, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	exposures := make(map[string]feature.Exposure)
+	cache.SetExposureListener(feature.ExposureConfig{
+		Listener: feature.ExposureListenerFunc(func(e feature.Exposure) {
+			exposures[e.Gate+"/"+e.ID] = e
+		}),
+	})
+
+	for _, id := range ids {
+		// The historical algorithm hashes the ids of the gates evaluated
+		// before gate-2 in the same lookup, the buckets must not change.
+		bucket1 := fnv64a(id+"1234") % 100
+		bucket2 := fnv64a(id+"1234"+id+"2345") % 100
+
+		var gates []string
+		if bucket1 < 50 {
+			gates = append(gates, "gate-1")
+		}
+		if bucket2 < 50 {
+			gates = append(gates, "gate-2")
+		}
+		expectGateLookup(t, cache, "family-A", "workspaces", id, gates)
+
+		open := cache.GateOpen("family-A", "gate-2", "workspaces", id)
+		tier := "1"
+		if open {
+			tier = "0"
+		}
+		if e := exposures["gate-2/"+id]; e.Open != open || e.Tier != tier {
+			t.Errorf("%s: exposure mismatch: want open=%t tier=%s, got open=%t tier=%s", id, open, tier, e.Open, e.Tier)
+		}
+	}
+}
+
+func TestExposurePrerequisite(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	path := feature.MountPoint(tmp)
+
+	tier := createTier(t, path, "standard", "1")
+	defer tier.Close()
+
+	populateCollection(t, createCollection(t, tier, "workspaces"), []string{"id-1"})
+	createGate(t, tier, "family-A", "gate-1", "workspaces", 1234)
+	enableGate(t, tier, "family-A", "gate-1", "workspaces", 1, false)
+	createGate(t, tier, "family-B", "gate-2", "workspaces", 2345)
+	enableGate(t, tier, "family-B", "gate-2", "workspaces", 0, false)
+	setPrerequisites(t, tier, "family-A", "gate-1", "family-B/gate-2")
+
+	cache, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	var exposures []feature.Exposure
+	cache.SetExposureListener(feature.ExposureConfig{
+		Listener: feature.ExposureListenerFunc(func(e feature.Exposure) {
+			exposures = append(exposures, e)
+		}),
+	})
+
+	cache.GateOpen("family-A", "gate-1", "workspaces", "id-1")
+	cache.GateOpenSubject("family-A", "gate-1", feature.Subject{{Collection: "workspaces", ID: "id-1"}})
+	cache.GateOpen("family-B", "gate-2", "workspaces", "id-1")
+
+	expectExposures(t, exposures, []feature.Exposure{
+		{Family: "family-A", Gate: "gate-1", Collection: "workspaces", ID: "id-1", Open: false, Group: "standard", Tier: "1", Prerequisite: "family-B/gate-2"},
+		{Family: "family-A", Gate: "gate-1", Collection: "workspaces", ID: "id-1", Open: false, Group: "standard", Tier: "1", Prerequisite: "family-B/gate-2"},
+		{Family: "family-B", Gate: "gate-2", Collection: "workspaces", ID: "id-1", Open: false, Group: "standard", Tier: "1"},
+	})
+}
+
+func fnv64a(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+func expectExposures(t testing.TB, found, exposures []feature.Exposure) {
+	t.Helper()
+
+	if !reflect.DeepEqual(found, exposures) {
+		t.Error("exposures mismatch")
+		t.Logf("want: %+v", exposures)
+		t.Logf("got:  %+v", found)
+	}
+}
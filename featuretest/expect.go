@@ -0,0 +1,46 @@
+package featuretest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/feature"
+)
+
+// ExpectGateOpened reports a test error if the gate is not open for id.
+func ExpectGateOpened(t testing.TB, e feature.Evaluator, family, gate, collection, id string) {
+	t.Helper()
+	expectGateIsEnabled(t, e, family, gate, collection, id, true)
+}
+
+// ExpectGateClosed reports a test error if the gate is not closed for id.
+func ExpectGateClosed(t testing.TB, e feature.Evaluator, family, gate, collection, id string) {
+	t.Helper()
+	expectGateIsEnabled(t, e, family, gate, collection, id, false)
+}
+
+func expectGateIsEnabled(t testing.TB, e feature.Evaluator, family, gate, collection, id string, open bool) {
+	t.Helper()
+
+	if e.GateOpen(family, gate, collection, id) != open {
+		t.Errorf("gate state mismatch for %s/%s (%s=%s)", family, gate, collection, id)
+		t.Logf("want: %t", open)
+		t.Logf("got:  %t", !open)
+	}
+}
+
+// ExpectGateLookup reports a test error if the list of open gates in family
+// for id does not match gates.
+func ExpectGateLookup(t testing.TB, e feature.Evaluator, family, collection, id string, gates []string) {
+	t.Helper()
+
+	if len(gates) == 0 {
+		gates = nil
+	}
+
+	if found := e.LookupGates(family, collection, id); !reflect.DeepEqual(found, gates) {
+		t.Errorf("gates mismatch for %s (%s=%s)", family, collection, id)
+		t.Logf("want: %q", gates)
+		t.Logf("got:  %q", found)
+	}
+}
@@ -0,0 +1,136 @@
+// Package featuretest provides an in-memory implementation of
+// feature.Evaluator, and helpers to test programs that depend on feature gates
+// without having to create a feature database on the file system.
+package featuretest
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/segmentio/feature"
+)
+
+// Fake is an in-memory implementation of the feature.Evaluator interface.
+//
+// Gates are declared on the fake with a default state, and optional lists of
+// ids that the gate is explicitly opened or closed for. The state of ids that
+// are listed always takes precedence over the default.
+//
+// Fake values are safe to use concurrently from multiple goroutines, including
+// when gates are modified while being evaluated.
+type Fake struct {
+	mutex sync.RWMutex
+	gates map[gateKey]*fakeGate
+}
+
+type gateKey struct {
+	family     string
+	gate       string
+	collection string
+}
+
+type fakeGate struct {
+	open bool
+	ids  map[string]bool
+}
+
+var _ feature.Evaluator = (*Fake)(nil)
+
+// New constructs a new Fake with no gates.
+func New() *Fake {
+	return &Fake{gates: make(map[gateKey]*fakeGate)}
+}
+
+// Open declares a gate in a default open state. The method returns f so calls
+// can be chained.
+func (f *Fake) Open(family, gate, collection string) *Fake {
+	f.update(family, gate, collection, func(g *fakeGate) { g.open = true })
+	return f
+}
+
+// Closed declares a gate in a default closed state. The method returns f so
+// calls can be chained.
+func (f *Fake) Closed(family, gate, collection string) *Fake {
+	f.update(family, gate, collection, func(g *fakeGate) { g.open = false })
+	return f
+}
+
+// Enable opens a gate for the list of ids. The gate is declared in a default
+// closed state if it did not exist. The method returns f so calls can be
+// chained.
+func (f *Fake) Enable(family, gate, collection string, ids ...string) *Fake {
+	f.update(family, gate, collection, func(g *fakeGate) { g.set(ids, true) })
+	return f
+}
+
+// Disable closes a gate for the list of ids. The gate is declared in a default
+// closed state if it did not exist. The method returns f so calls can be
+// chained.
+func (f *Fake) Disable(family, gate, collection string, ids ...string) *Fake {
+	f.update(family, gate, collection, func(g *fakeGate) { g.set(ids, false) })
+	return f
+}
+
+// Delete removes a gate from f. The method returns f so calls can be chained.
+func (f *Fake) Delete(family, gate, collection string) *Fake {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.gates, gateKey{family: family, gate: gate, collection: collection})
+	return f
+}
+
+// GateOpen returns true if a gate is opened for a given id.
+func (f *Fake) GateOpen(family, gate, collection, id string) bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	g := f.gates[gateKey{family: family, gate: gate, collection: collection}]
+	return g != nil && g.openFor(id)
+}
+
+// LookupGates returns the sorted list of open gates in a family for a given
+// id, or nil if no gates were open.
+func (f *Fake) LookupGates(family, collection, id string) []string {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	var gates []string
+	for k, g := range f.gates {
+		if k.family == family && k.collection == collection && g.openFor(id) {
+			gates = append(gates, k.gate)
+		}
+	}
+
+	sort.Strings(gates)
+	return gates
+}
+
+func (f *Fake) update(family, gate, collection string, do func(*fakeGate)) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.gates == nil {
+		f.gates = make(map[gateKey]*fakeGate)
+	}
+
+	k := gateKey{family: family, gate: gate, collection: collection}
+	g := f.gates[k]
+	if g == nil {
+		g = &fakeGate{ids: make(map[string]bool)}
+		f.gates[k] = g
+	}
+
+	do(g)
+}
+
+func (g *fakeGate) set(ids []string, open bool) {
+	for _, id := range ids {
+		g.ids[id] = open
+	}
+}
+
+func (g *fakeGate) openFor(id string) bool {
+	if open, ok := g.ids[id]; ok {
+		return open
+	}
+	return g.open
+}
@@ -0,0 +1,96 @@
+package featuretest_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/segmentio/feature"
+	"github.com/segmentio/feature/featuretest"
+)
+
+func TestFake(t *testing.T) {
+	f := featuretest.New().
+		Open("family-A", "gate-1", "workspaces").
+		Disable("family-A", "gate-1", "workspaces", "id-3").
+		Enable("family-A", "gate-2", "workspaces", "id-1", "id-2")
+
+	testFixture(t, f)
+
+	f.Delete("family-A", "gate-1", "workspaces")
+	featuretest.ExpectGateClosed(t, f, "family-A", "gate-1", "workspaces", "id-1")
+	featuretest.ExpectGateLookup(t, f, "family-A", "workspaces", "id-1", []string{"gate-2"})
+}
+
+func TestLoad(t *testing.T) {
+	for _, path := range []string{
+		"testdata/gates.yaml",
+		"testdata/gates.json",
+	} {
+		t.Run(path, func(t *testing.T) {
+			testFixture(t, featuretest.MustLoad(t, path))
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "featuretest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	path := feature.MountPoint(tmp)
+
+	tier, err := path.CreateTier("standard", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tier.Close()
+
+	col, err := tier.CreateCollection("workspaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"id-1", "id-2", "id-3"} {
+		col.Add(id)
+	}
+	if err := col.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, gate := range []string{"gate-1", "gate-2"} {
+		if err := tier.CreateGate("family-A", gate, "workspaces", 1234); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tier.EnableGate("family-A", "gate-1", "workspaces", 1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	featuretest.ExpectGateOpened(t, cache, "family-A", "gate-1", "workspaces", "id-1")
+	featuretest.ExpectGateClosed(t, cache, "family-A", "gate-2", "workspaces", "id-1")
+	featuretest.ExpectGateLookup(t, cache, "family-A", "workspaces", "id-2", []string{"gate-1"})
+	featuretest.ExpectGateLookup(t, cache, "family-B", "workspaces", "id-2", nil)
+}
+
+func testFixture(t *testing.T, e feature.Evaluator) {
+	t.Helper()
+
+	featuretest.ExpectGateOpened(t, e, "family-A", "gate-1", "workspaces", "id-1")
+	featuretest.ExpectGateOpened(t, e, "family-A", "gate-1", "workspaces", "whatever")
+	featuretest.ExpectGateClosed(t, e, "family-A", "gate-1", "workspaces", "id-3")
+	featuretest.ExpectGateClosed(t, e, "family-A", "gate-1", "sources", "id-1")
+
+	featuretest.ExpectGateOpened(t, e, "family-A", "gate-2", "workspaces", "id-1")
+	featuretest.ExpectGateClosed(t, e, "family-A", "gate-2", "workspaces", "id-3")
+
+	featuretest.ExpectGateLookup(t, e, "family-A", "workspaces", "id-1", []string{"gate-1", "gate-2"})
+	featuretest.ExpectGateLookup(t, e, "family-A", "workspaces", "id-3", nil)
+	featuretest.ExpectGateLookup(t, e, "family-B", "workspaces", "id-1", nil)
+}
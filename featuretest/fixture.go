@@ -0,0 +1,121 @@
+package featuretest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Fixture is the representation of gates loaded from YAML or JSON files.
+//
+// Here is an example of YAML fixture:
+//
+//	gates:
+//	  - family: family-A
+//	    gate: gate-1
+//	    collection: workspaces
+//	    open: true
+//	    disabled: [id-3]
+//	  - family: family-A
+//	    gate: gate-2
+//	    collection: workspaces
+//	    enabled: [id-1, id-2]
+//
+type Fixture struct {
+	Gates []FixtureGate `json:"gates" yaml:"gates"`
+}
+
+// FixtureGate represents a single gate in a Fixture.
+type FixtureGate struct {
+	Family     string   `json:"family"     yaml:"family"`
+	Gate       string   `json:"gate"       yaml:"gate"`
+	Collection string   `json:"collection" yaml:"collection"`
+	Open       bool     `json:"open"       yaml:"open"`
+	Enabled    []string `json:"enabled"    yaml:"enabled"`
+	Disabled   []string `json:"disabled"   yaml:"disabled"`
+}
+
+// Fake constructs a Fake from the gates of the fixture.
+func (x *Fixture) Fake() (*Fake, error) {
+	f := New()
+
+	for i, g := range x.Gates {
+		if g.Family == "" || g.Gate == "" || g.Collection == "" {
+			return nil, fmt.Errorf("gate at index %d: family, gate, and collection must be set", i)
+		}
+		if g.Open {
+			f.Open(g.Family, g.Gate, g.Collection)
+		} else {
+			f.Closed(g.Family, g.Gate, g.Collection)
+		}
+		f.Enable(g.Family, g.Gate, g.Collection, g.Enabled...)
+		f.Disable(g.Family, g.Gate, g.Collection, g.Disabled...)
+	}
+
+	return f, nil
+}
+
+// ParseJSON constructs a Fake from a JSON fixture.
+func ParseJSON(b []byte) (*Fake, error) {
+	x := new(Fixture)
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(x); err != nil {
+		return nil, err
+	}
+	return x.Fake()
+}
+
+// ParseYAML constructs a Fake from a YAML fixture.
+func ParseYAML(b []byte) (*Fake, error) {
+	x := new(Fixture)
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	d.KnownFields(true)
+	if err := d.Decode(x); err != nil {
+		return nil, err
+	}
+	return x.Fake()
+}
+
+// Load constructs a Fake from the fixture at path. The format of the fixture
+// is determined by the file extension, which must be one of .json, .yaml, or
+// .yml.
+func Load(path string) (*Fake, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f *Fake
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+		f, err = ParseJSON(b)
+	case ".yaml", ".yml":
+		f, err = ParseYAML(b)
+	default:
+		return nil, fmt.Errorf("%s: unsupported fixture format: %q", path, ext)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("%s: %w", path, err)
+	}
+	return f, err
+}
+
+// MustLoad is like Load but aborts the test if the fixture could not be
+// loaded.
+func MustLoad(t testing.TB, path string) *Fake {
+	t.Helper()
+
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
@@ -0,0 +1,255 @@
+package feature
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	// FormatVersion is the latest version of the on-disk layout of feature
+	// databases, which this package understands and writes by default.
+	FormatVersion = 3
+
+	// MinFormatVersion is the oldest version of the on-disk layout of feature
+	// databases supported by this package.
+	MinFormatVersion = 1
+)
+
+// Format describes a version of the on-disk layout of feature databases.
+type Format struct {
+	// The version number of the layout.
+	Version int
+
+	// A description of the changes introduced by this version.
+	Description string
+
+	// upgrade converts the database at root from the previous version, and
+	// downgrade converts it back. Nil functions mean that the content of the
+	// database does not need to be modified.
+	upgrade   func(root string) error
+	downgrade func(root string) error
+}
+
+// Formats returns the list of layout versions supported by the package, sorted
+// by version number.
+func Formats() []Format {
+	formats := make([]Format, len(formatVersions))
+	copy(formats, formatVersions)
+	return formats
+}
+
+var formatVersions = []Format{
+	{
+		Version:     1,
+		Description: "original layout",
+	},
+	{
+		Version:     2,
+		Description: "collections are sorted and do not contain duplicate ids",
+		upgrade:     sortCollections,
+	},
+	{
+		Version:     3,
+		Description: "gates may use the start, end, ramp, buckets, hash, and bucket-by keys",
+		downgrade:   rejectGateKeys(3),
+	},
+}
+
+// gateKeyFormats maps the gate keys introduced after the original layout to
+// the version which introduced them. Databases declaring an older version must
+// not use these keys, since the programs reading them would ignore the keys.
+var gateKeyFormats = map[string]int{
+	"start":     3,
+	"end":       3,
+	"ramp":      3,
+	"buckets":   3,
+	"hash":      3,
+	"bucket-by": 3,
+}
+
+// FormatError is returned when a feature database uses a layout version which
+// is not supported by the package.
+type FormatError struct {
+	// The path of the feature database.
+	Path string
+
+	// The version declared by the feature database.
+	Version int
+}
+
+// Error satisfies the error interface.
+func (e *FormatError) Error() string {
+	return e.Path + ": " + e.reason()
+}
+
+func (e *FormatError) reason() string {
+	if e.Version > FormatVersion {
+		return fmt.Sprintf("feature database uses format version %d, but this program only supports versions up to %d, upgrade the program or downgrade the database with feature migrate",
+			e.Version, FormatVersion)
+	}
+	return fmt.Sprintf("feature database uses format version %d, but this program only supports versions %d to %d",
+		e.Version, MinFormatVersion, FormatVersion)
+}
+
+// Format returns the layout version of the database at the mount point, which
+// is declared in its manifest. Databases without a manifest use the original
+// layout (version 1).
+func (path MountPoint) Format() (int, error) {
+	return readFormat(string(path))
+}
+
+// readFormat reads the format version of the database at root from its
+// manifest. Only the first lines of the manifest are read, so the function is
+// cheap enough to be called by each write to the database.
+func readFormat(root string) (int, error) {
+	f, err := os.Open(filepath.Join(root, manifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return MinFormatVersion, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		k, v := splitKeyValue(bytes.TrimSpace(s.Bytes()))
+		switch string(k) {
+		case "format":
+			version, err := strconv.Atoi(string(v))
+			if err != nil {
+				return 0, fmt.Errorf("%s: invalid format version: %q", f.Name(), v)
+			}
+			return version, nil
+		case "file":
+			// The format is declared before the list of files, there is no
+			// need to read the rest of the manifest.
+			return MinFormatVersion, nil
+		}
+	}
+	return MinFormatVersion, s.Err()
+}
+
+// checkFormat returns a *FormatError if version is not supported.
+func checkFormat(path string, version int) error {
+	if version < MinFormatVersion || version > FormatVersion {
+		return &FormatError{Path: path, Version: version}
+	}
+	return nil
+}
+
+// migrate converts the content of the database at root from one layout
+// version to another, applying the upgrades or downgrades of each version in
+// between. The manifest is not modified.
+func migrate(root string, from, to int) error {
+	if err := checkFormat(root, from); err != nil {
+		return err
+	}
+	if err := checkFormat(root, to); err != nil {
+		return err
+	}
+
+	for v := from; v < to; v++ {
+		if up := formatVersions[v].upgrade; up != nil {
+			if err := up(root); err != nil {
+				return fmt.Errorf("upgrading feature database at %s to format version %d: %w", root, v+1, err)
+			}
+		}
+	}
+
+	for v := from; v > to; v-- {
+		if down := formatVersions[v-1].downgrade; down != nil {
+			if err := down(root); err != nil {
+				return fmt.Errorf("downgrading feature database at %s to format version %d: %w", root, v-1, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sortCollections sorts and deduplicates all the collections of the database
+// at root which are not already sorted.
+func sortCollections(root string) error {
+	path := MountPoint(root)
+	return Scan(path.Groups(), func(group string) error {
+		return Scan(path.Tiers(group), func(tier string) error {
+			t := &Tier{path: path, group: group, name: tier}
+			return Scan(t.Collections(), func(collection string) error {
+				p := t.collectionPath(collection)
+				sorted, err := isSortedCollection(p)
+				if err != nil || sorted {
+					return err
+				}
+				return sortCollection(p)
+			})
+		})
+	})
+}
+
+// isSortedCollection returns true if the collection at path is sorted and
+// does not contain duplicate ids.
+func isSortedCollection(path string) (bool, error) {
+	it := IDIter{readfile(path)}
+	defer it.Close()
+
+	prev, first := "", true
+	for it.Next() {
+		id := it.Name()
+		if !first && id <= prev {
+			return false, it.Close()
+		}
+		prev, first = id, false
+	}
+	return true, it.Close()
+}
+
+// rejectGateKeys returns a function which fails if a gate of the database at
+// root uses one of the keys introduced by version, which cannot be converted
+// to the previous version without changing the behavior of the gate.
+func rejectGateKeys(version int) func(root string) error {
+	return func(root string) error {
+		path := MountPoint(root)
+		return Scan(path.Groups(), func(group string) error {
+			return Scan(path.Tiers(group), func(tier string) error {
+				t := &Tier{path: path, group: group, name: tier}
+				return Scan(t.Families(), func(family string) error {
+					return Scan(t.Gates(family), func(gate string) error {
+						return Scan(t.GatesCreated(family, gate), func(collection string) error {
+							p := t.gateCollectionPath(family, gate, collection)
+							g, err := readGate(p)
+							if err != nil {
+								return err
+							}
+							if v, key := g.format(); v >= version {
+								return fmt.Errorf("%s: the %q key is not supported by format version %d, remove it before migrating", p, key, version-1)
+							}
+							return nil
+						})
+					})
+				})
+			})
+		})
+	}
+}
+
+// checkGateFormat returns an error if the gate uses keys which are not
+// supported by the format version of the database.
+func (path MountPoint) checkGateFormat(file string, g gate) error {
+	v, key := g.format()
+	if v == MinFormatVersion {
+		return nil
+	}
+	format, err := readFormat(string(path))
+	if err != nil {
+		return err
+	}
+	if format < v {
+		return fmt.Errorf("%s: the %q key requires format version %d, but the feature database uses version %d, upgrade it with feature migrate", file, key, v, format)
+	}
+	return nil
+}
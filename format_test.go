@@ -0,0 +1,297 @@
+package feature_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/feature"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, feature.MountPoint)
+	}{
+		{
+			scenario: "databases without a manifest use the original layout",
+			function: testFormatLegacy,
+		},
+
+		{
+			scenario: "migrating to version 2 sorts and deduplicates collections",
+			function: testFormatUpgrade,
+		},
+
+		{
+			scenario: "collections of version 2 databases remain sorted when modified",
+			function: testFormatSortedWrites,
+		},
+
+		{
+			scenario: "migrating back to version 1 only changes the declared version",
+			function: testFormatDowngrade,
+		},
+
+		{
+			scenario: "databases using a newer layout are refused",
+			function: testFormatNewer,
+		},
+
+		{
+			scenario: "gate keys introduced by version 3 require the database to use it",
+			function: testFormatGateKeys,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "feature")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+			path := feature.MountPoint(tmp)
+
+			tier, err := path.CreateTier("standard", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tier.Close()
+
+			col := createCollection(t, tier, "workspaces")
+			populateCollection(t, col, []string{"id-2", "id-1", "id-2"})
+			col.Close()
+
+			test.function(t, path)
+		})
+	}
+}
+
+func testFormatLegacy(t *testing.T, path feature.MountPoint) {
+	expectFormat(t, path, 1)
+
+	tier := openTier(t, path)
+	defer tier.Close()
+	expectIDs(t, tier, "workspaces", []string{"id-1", "id-2", "id-2"})
+}
+
+func testFormatUpgrade(t *testing.T, path feature.MountPoint) {
+	migrateFormat(t, path, 2)
+	expectFormat(t, path, 2)
+
+	tier := openTier(t, path)
+	defer tier.Close()
+	expectIDs(t, tier, "workspaces", []string{"id-1", "id-2"})
+}
+
+func testFormatSortedWrites(t *testing.T, path feature.MountPoint) {
+	migrateFormat(t, path, 2)
+
+	tier := openTier(t, path)
+	defer tier.Close()
+
+	col, err := tier.OpenCollection("workspaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	populateCollection(t, col, []string{"id-3", "id-0", "id-1"})
+	if err := col.Remove("id-2"); err != nil {
+		t.Fatal(err)
+	}
+	col.Close()
+
+	expectIDs(t, tier, "workspaces", []string{"id-0", "id-1", "id-3"})
+	if problems := validate(t, path); len(problems) != 0 {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+}
+
+func testFormatDowngrade(t *testing.T, path feature.MountPoint) {
+	migrateFormat(t, path, 2)
+	migrateFormat(t, path, 1)
+	expectFormat(t, path, 1)
+
+	tier := openTier(t, path)
+	defer tier.Close()
+
+	col, err := tier.OpenCollection("workspaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	populateCollection(t, col, []string{"id-1"})
+	col.Close()
+
+	// Version 1 databases do not require collections to be deduplicated.
+	expectIDs(t, tier, "workspaces", []string{"id-1", "id-1", "id-2"})
+}
+
+func testFormatNewer(t *testing.T, path feature.MountPoint) {
+	migrateFormat(t, path, feature.FormatVersion)
+
+	manifest := filepath.Join(string(path), ".manifest")
+	b, err := ioutil.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newer := feature.FormatVersion + 1
+	b = []byte(strings.Replace(string(b), "format\t"+strconv.Itoa(feature.FormatVersion), "format\t"+strconv.Itoa(newer), 1))
+	if err := ioutil.WriteFile(manifest, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := path.Load()
+	if err == nil {
+		c.Close()
+		t.Fatal("loading the database did not fail")
+	}
+
+	formatErr := new(feature.FormatError)
+	if !errors.As(err, &formatErr) {
+		t.Fatalf("expected a format error, got %v", err)
+	}
+	if formatErr.Version != newer {
+		t.Errorf("version mismatch: want %d, got %d", newer, formatErr.Version)
+	}
+
+	if _, err := path.NewBuilderFrom(path); !errors.As(err, &formatErr) {
+		t.Errorf("expected a format error when seeding a builder, got %v", err)
+	}
+}
+
+func testFormatGateKeys(t *testing.T, path feature.MountPoint) {
+	tests := []struct {
+		key   string
+		set   func(*feature.Tier) error
+		unset func(*feature.Tier) error
+	}{
+		{
+			key: "start",
+			set: func(tier *feature.Tier) error {
+				return tier.ScheduleGate("family-A", "gate-1", "workspaces", scheduleStart, time.Time{})
+			},
+			unset: func(tier *feature.Tier) error {
+				return tier.ScheduleGate("family-A", "gate-1", "workspaces", time.Time{}, time.Time{})
+			},
+		},
+
+		{
+			key: "ramp",
+			set: func(tier *feature.Tier) error {
+				ramp := feature.Ramp{Steps: []feature.RampStep{{Time: scheduleStart, Volume: 0.5}}}
+				return tier.RampGate("family-A", "gate-1", "workspaces", ramp)
+			},
+			unset: func(tier *feature.Tier) error {
+				return tier.RampGate("family-A", "gate-1", "workspaces", feature.Ramp{})
+			},
+		},
+
+		{
+			key: "buckets",
+			set: func(tier *feature.Tier) error {
+				return tier.SetGateBuckets("family-A", "gate-1", "workspaces", 10000)
+			},
+			unset: func(tier *feature.Tier) error {
+				return tier.SetGateBuckets("family-A", "gate-1", "workspaces", feature.DefaultBuckets)
+			},
+		},
+
+		{
+			key: "hash",
+			set: func(tier *feature.Tier) error {
+				return tier.SetGateHash("family-A", "gate-1", "workspaces", "sha1")
+			},
+			unset: func(tier *feature.Tier) error {
+				return tier.SetGateHash("family-A", "gate-1", "workspaces", feature.DefaultHash)
+			},
+		},
+
+		{
+			key: "bucket-by",
+			set: func(tier *feature.Tier) error {
+				return tier.SetGateBucketBy("family-A", "gate-1", "workspaces", "users")
+			},
+			unset: func(tier *feature.Tier) error {
+				return tier.SetGateBucketBy("family-A", "gate-1", "workspaces", "")
+			},
+		},
+	}
+
+	tier := openTier(t, path)
+	defer tier.Close()
+	createGate(t, tier, "family-A", "gate-1", "workspaces", 1234)
+
+	for _, test := range tests {
+		migrateFormat(t, path, 2)
+		if err := test.set(tier); err == nil || !strings.Contains(err.Error(), strconv.Quote(test.key)) {
+			t.Errorf("%s: expected an error indicating that the key requires format version 3, got %v", test.key, err)
+		}
+
+		// Readers which only support version 2 refuse the database as soon as
+		// gates use the key, instead of ignoring it.
+		migrateFormat(t, path, 3)
+		if err := test.set(tier); err != nil {
+			t.Fatal(err)
+		}
+		expectFormat(t, path, 3)
+		if err := tryMigrateFormat(path, 2); err == nil || !strings.Contains(err.Error(), strconv.Quote(test.key)) {
+			t.Errorf("%s: expected an error indicating that the database cannot be downgraded, got %v", test.key, err)
+		}
+		expectFormat(t, path, 3)
+
+		if err := test.unset(tier); err != nil {
+			t.Fatal(err)
+		}
+		migrateFormat(t, path, 2)
+		expectFormat(t, path, 2)
+	}
+}
+
+func openTier(t testing.TB, path feature.MountPoint) *feature.Tier {
+	t.Helper()
+
+	tier, err := path.OpenTier("standard", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tier
+}
+
+func migrateFormat(t testing.TB, path feature.MountPoint, version int) {
+	t.Helper()
+
+	if err := tryMigrateFormat(path, version); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tryMigrateFormat(path feature.MountPoint, version int) error {
+	b, err := path.NewBuilderFrom(path)
+	if err != nil {
+		return err
+	}
+	defer b.Abort()
+
+	if err := b.SetFormat(version); err != nil {
+		return err
+	}
+	return b.Commit()
+}
+
+func expectFormat(t testing.TB, path feature.MountPoint, version int) {
+	t.Helper()
+
+	format, err := path.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != version {
+		t.Errorf("format mismatch: want %d, got %d", version, format)
+	}
+}
@@ -3,8 +3,10 @@ package feature
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // Iter is an interface implemented by the iterator types exposed by this
@@ -41,16 +43,28 @@ func Mount(path string) (MountPoint, error) {
 }
 
 func (path MountPoint) CreateTier(group, name string) (*Tier, error) {
-	if err := mkdir(path.groupPath(group)); err != nil {
-		return nil, fmt.Errorf("creating tier group %q: %w", group, err)
+	if err := validateTierNames(group, name); err != nil {
+		return nil, err
 	}
-	if err := mkdir(path.tierPath(group, name)); err != nil {
-		return nil, fmt.Errorf("creating tier %q of group %q: %w", name, group, err)
+	err := path.lock(true, func() error {
+		if err := mkdir(path.groupPath(group)); err != nil {
+			return fmt.Errorf("creating tier group %q: %w", group, err)
+		}
+		if err := mkdir(path.tierPath(group, name)); err != nil {
+			return fmt.Errorf("creating tier %q of group %q: %w", name, group, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return &Tier{path: path, group: group, name: name}, nil
 }
 
 func (path MountPoint) OpenTier(group, name string) (*Tier, error) {
+	if err := validateTierNames(group, name); err != nil {
+		return nil, err
+	}
 	_, err := os.Stat(path.tierPath(group, name))
 	if err != nil {
 		return nil, err
@@ -59,11 +73,27 @@ func (path MountPoint) OpenTier(group, name string) (*Tier, error) {
 }
 
 func (path MountPoint) DeleteTier(group, name string) error {
-	return rmdir(path.tierPath(group, name))
+	if err := validateTierNames(group, name); err != nil {
+		return err
+	}
+	return path.lock(true, func() error {
+		if err := rmdir(path.tierPath(group, name)); err != nil {
+			return err
+		}
+		return path.updateManifest(path.tierPath(group, name))
+	})
 }
 
 func (path MountPoint) DeleteGroup(group string) error {
-	return rmdir(path.groupPath(group))
+	if err := ValidateName("group", group); err != nil {
+		return err
+	}
+	return path.lock(true, func() error {
+		if err := rmdir(path.groupPath(group)); err != nil {
+			return err
+		}
+		return path.updateManifest(path.groupPath(group))
+	})
 }
 
 func (path MountPoint) Tiers(group string) *TierIter {
@@ -106,27 +136,30 @@ func (d *dir) close() error {
 }
 
 func (d *dir) next() bool {
-	if d.file == nil {
-		return false
-	}
-
-	if d.index++; d.index < len(d.names) {
-		return true
-	}
+	for d.file != nil {
+		if d.index++; d.index < len(d.names) {
+			// Hidden files are reserved for internal use, for example the
+			// temporary files used to apply atomic updates.
+			if !isHidden(d.names[d.index]) {
+				return true
+			}
+			continue
+		}
 
-	names, err := d.file.Readdirnames(100)
-	switch err {
-	case nil:
-		d.names, d.index = names, 0
-		return true
-	case io.EOF:
-		d.names, d.index = nil, 0
-		return false
-	default:
-		d.err = err
-		d.close()
-		return false
+		names, err := d.file.Readdirnames(100)
+		switch err {
+		case nil:
+			d.names, d.index = names, -1
+		case io.EOF:
+			d.names, d.index = nil, 0
+			return false
+		default:
+			d.err = err
+			d.close()
+			return false
+		}
 	}
+	return false
 }
 
 func (d *dir) name() string {
@@ -140,12 +173,20 @@ func (d *dir) read() dir {
 	return readdir(filepath.Join(d.path, d.name()))
 }
 
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
 func mkdir(path string) error {
 	err := os.Mkdir(path, 0755)
-	if err != nil && os.IsExist(err) {
-		err = nil
+	if err != nil {
+		if os.IsExist(err) {
+			err = nil
+		}
+		return err
 	}
-	return err
+	// Sync the parent directory so the creation is durable.
+	return syncDir(filepath.Dir(path))
 }
 
 func readdir(path string) dir {
@@ -174,11 +215,42 @@ func unlink(path string) error {
 	return err
 }
 
+// writeFile atomically replaces the file at path with the content produced by
+// the write function. The content is written to a temporary file which is
+// synced and renamed to path, so readers either see the previous content or
+// the new one, never a partial write.
 func writeFile(path string, write func(*os.File) error) error {
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	dir, base := filepath.Split(path)
+	f, err := ioutil.TempFile(dir, "."+base+".tmp-")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(f.Name())
 	defer f.Close()
-	return write(f)
+
+	if err := f.Chmod(0644); err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
 }
@@ -120,6 +120,19 @@ func testMountPointDeleteGroupNotExist(t *testing.T, path feature.MountPoint) {
 	deleteGroup(t, path, "group-A")
 }
 
+// createDatabase commits an empty database at path, which declares the latest
+// format version in its manifest.
+func createDatabase(t testing.TB, path feature.MountPoint) {
+	t.Helper()
+
+	b, err := path.NewBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Abort()
+	commitBuilder(t, b)
+}
+
 func createTier(t testing.TB, path feature.MountPoint, group, name string) *feature.Tier {
 	t.Helper()
 
@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"sync"
+	"time"
 	"unicode"
 )
 
@@ -86,11 +87,23 @@ func (it *GateEnabledIter) Next() bool {
 					return false
 				}
 
+				now := time.Now()
+				if !active(now, g.start, g.end) {
+					continue
+				}
+
 				if it.id == "" {
 					if g.open {
 						return true
 					}
-				} else if openGate(it.id, g.salt, g.volume, it.hash) {
+					continue
+				}
+
+				hash, err := lookupHash(g.hash)
+				if err != nil {
+					continue // closed to programs which did not register the hash
+				}
+				if openGate(it.id, g.salt, g.ramp.VolumeAt(now, g.volume), g.bucketCount(), hash, it.hash) {
 					return true
 				}
 			}
@@ -169,7 +182,13 @@ func (it *GateDisabledIter) Next() bool {
 					return false
 				}
 
-				if !openGate(it.id, g.salt, g.volume, it.hash) {
+				hash, err := lookupHash(g.hash)
+				if err != nil {
+					return true // closed to programs which did not register the hash
+				}
+
+				now := time.Now()
+				if !active(now, g.start, g.end) || !openGate(it.id, g.salt, g.ramp.VolumeAt(now, g.volume), g.bucketCount(), hash, it.hash) {
 					return true
 				}
 			}
@@ -199,9 +218,18 @@ func (it *GateDisabledIter) Name() string {
 	return it.Family() + "/" + it.Gate()
 }
 
+// DefaultBuckets is the number of buckets that ids are hashed into to evaluate
+// the volume of gates, unless their gate files select a different number.
+const DefaultBuckets = 100
+
 // openGate is an algorithm we used historically in internal feature gating
 // systems. We adopted it here for interoperability purposes.
-func openGate(id, salt string, volume float64, h *bufferedHash64) bool {
+//
+// The ids are hashed into a number of buckets, which limits the granularity of
+// volumes (e.g. with 100 buckets, the volume is rounded down to a multiple of
+// 1%). With DefaultBuckets and DefaultHash, the algorithm is the historical
+// one, a nil hash selects DefaultHash.
+func openGate(id, salt string, volume float64, buckets uint64, hash HashFunc, h *bufferedHash64) bool {
 	if volume <= 0 {
 		return false
 	}
@@ -210,17 +238,150 @@ func openGate(id, salt string, volume float64, h *bufferedHash64) bool {
 		return true
 	}
 
+	if hash != nil {
+		return openBucket(hash(id, salt, buckets), buckets, volume)
+	}
+
+	// The historical algorithm does not reset the hash between the gates of a
+	// family evaluated for an id, the bucket depends on the gates hashed
+	// before this one. Changing it would reassign the ids of every partial
+	// rollout, callers replay the same order instead (see evaluateTiers).
 	h.buffer.WriteString(id)
 	h.buffer.WriteString(salt)
 	h.buffer.WriteTo(h.hash)
 
-	return (float64(h.hash.Sum64()%100) + 1) <= (100 * volume)
+	return openBucket(h.hash.Sum64()%buckets, buckets, volume)
+}
+
+// openBucket returns true if ids assigned to bucket are admitted at volume.
+func openBucket(bucket, buckets uint64, volume float64) bool {
+	if volume <= 0 {
+		return false
+	}
+	if volume >= 1 {
+		return true
+	}
+	return (float64(bucket) + 1) <= (float64(buckets) * volume)
 }
 
 type gate struct {
 	open   bool
 	salt   string
 	volume float64
+
+	// The optional window of time during which the gate applies its
+	// configuration, zero values leave the window unbounded on that side.
+	start time.Time
+	end   time.Time
+
+	// The optional ramp progressively changing the volume of the gate.
+	ramp Ramp
+
+	// The number of buckets used to evaluate the volume, zero means that the
+	// gate uses DefaultBuckets.
+	buckets uint64
+
+	// The name of the hash algorithm assigning ids to buckets, empty means
+	// that the gate uses DefaultHash.
+	hash string
+
+	// The optional name of the collection whose ids the gate buckets by, when
+	// evaluated with a bucketing key (see Cache.GateOpenKey).
+	bucketBy string
+
+	// The lines of the gate file in their original order, so unknown keys and
+	// comments are preserved when the gate is rewritten. Lines of known keys
+	// only hold the key, their value is taken from the fields above.
+	lines []gateLine
+}
+
+// gateLine represents a line of a gate file, comments have an empty key and
+// their text in the value.
+type gateLine struct {
+	key   string
+	value string
+}
+
+// bucketCount returns the number of buckets used to evaluate the volume of the
+// gate.
+func (g *gate) bucketCount() uint64 {
+	if g.buckets == 0 {
+		return DefaultBuckets
+	}
+	return g.buckets
+}
+
+// hashName returns the name of the hash algorithm assigning ids to buckets.
+func (g *gate) hashName() string {
+	if g.hash == "" {
+		return DefaultHash
+	}
+	return g.hash
+}
+
+func parseBuckets(s string) (uint64, error) {
+	buckets, err := strconv.ParseUint(s, 10, 64)
+	if err == nil && buckets == 0 {
+		err = fmt.Errorf("invalid number of buckets: %q", s)
+	}
+	return buckets, err
+}
+
+// gateKeys lists the keys interpreted by the package, in the order they are
+// written to new gate files.
+var gateKeys = [...]string{"open", "salt", "volume", "start", "end", "ramp", "buckets", "hash", "bucket-by"}
+
+// isGateKey returns true if key is one of the keys interpreted by the package.
+func isGateKey(key string) bool {
+	switch key {
+	case "open", "salt", "volume", "start", "end", "ramp", "buckets", "hash", "bucket-by":
+		return true
+	default:
+		return false
+	}
+}
+
+// attributes returns the unknown keys of the gate, in the order they appear
+// in the gate file.
+func (g *gate) attributes() []Attribute {
+	attrs := make([]Attribute, 0, len(g.lines))
+	for _, line := range g.lines {
+		if line.key != "" && !isGateKey(line.key) {
+			attrs = append(attrs, Attribute{Key: line.key, Value: line.value})
+		}
+	}
+	return attrs
+}
+
+// set sets the value of an unknown key, replacing the first line where the key
+// appears and removing the others, or appending it if the key did not exist.
+func (g *gate) set(key, value string) {
+	found := false
+	lines := g.lines[:0]
+	for _, line := range g.lines {
+		if line.key == key {
+			if found {
+				continue
+			}
+			line.value, found = value, true
+		}
+		lines = append(lines, line)
+	}
+	if !found {
+		lines = append(lines, gateLine{key: key, value: value})
+	}
+	g.lines = lines
+}
+
+// unset removes all the lines where an unknown key appears.
+func (g *gate) unset(key string) {
+	lines := g.lines[:0]
+	for _, line := range g.lines {
+		if line.key != key {
+			lines = append(lines, line)
+		}
+	}
+	g.lines = lines
 }
 
 func readGate(path string) (gate, error) {
@@ -242,7 +403,15 @@ func readGate(path string) (gate, error) {
 		if err != nil {
 			return
 		}
-		k, v := splitKeyValue(bytes.TrimSpace(b[i : i+n]))
+		line := bytes.TrimSpace(b[i : i+n])
+		switch {
+		case len(line) == 0:
+			return
+		case line[0] == '#':
+			g.lines = append(g.lines, gateLine{value: string(line)})
+			return
+		}
+		k, v := splitKeyValue(line)
 		switch string(k) {
 		case "open":
 			g.open, err = strconv.ParseBool(string(v))
@@ -250,7 +419,23 @@ func readGate(path string) (gate, error) {
 			g.salt = string(v)
 		case "volume":
 			g.volume, err = strconv.ParseFloat(string(v), 64)
+		case "start":
+			g.start, err = time.Parse(time.RFC3339, string(v))
+		case "end":
+			g.end, err = time.Parse(time.RFC3339, string(v))
+		case "ramp":
+			g.ramp, err = parseRamp(string(v))
+		case "buckets":
+			g.buckets, err = parseBuckets(string(v))
+		case "hash":
+			g.hash = string(v)
+		case "bucket-by":
+			g.bucketBy = string(v)
+		default:
+			g.lines = append(g.lines, gateLine{key: string(k), value: string(v)})
+			return
 		}
+		g.lines = append(g.lines, gateLine{key: string(k)})
 	})
 
 	if err != nil {
@@ -260,22 +445,84 @@ func readGate(path string) (gate, error) {
 	return g, err
 }
 
+// values returns the known keys written to the file of the gate, and their
+// values.
+func (gate *gate) values() map[string]interface{} {
+	values := map[string]interface{}{
+		"open":   gate.open,
+		"salt":   gate.salt,
+		"volume": gate.volume,
+	}
+	// The schedule is only written when it is set, so gates which do not have
+	// one keep the same file contents.
+	if !gate.start.IsZero() {
+		values["start"] = gate.start.Format(time.RFC3339)
+	}
+	if !gate.end.IsZero() {
+		values["end"] = gate.end.Format(time.RFC3339)
+	}
+	if !gate.ramp.IsZero() {
+		values["ramp"] = gate.ramp
+	}
+	if gate.buckets != 0 && gate.buckets != DefaultBuckets {
+		values["buckets"] = gate.buckets
+	}
+	if gate.hash != "" && gate.hash != DefaultHash {
+		values["hash"] = gate.hash
+	}
+	if gate.bucketBy != "" {
+		values["bucket-by"] = gate.bucketBy
+	}
+	return values
+}
+
+// format returns the oldest layout version supporting the keys written to the
+// file of the gate, and the key which requires it.
+func (gate *gate) format() (version int, key string) {
+	values := gate.values()
+	version = MinFormatVersion
+	for _, k := range gateKeys {
+		if _, ok := values[k]; ok && gateKeyFormats[k] > version {
+			version, key = gateKeyFormats[k], k
+		}
+	}
+	return version, key
+}
+
 func writeGate(path string, gate gate) error {
 	b := new(bytes.Buffer)
-
-	for _, e := range [...]struct {
-		key   string
-		value interface{}
-	}{
-		{key: "open", value: gate.open},
-		{key: "salt", value: gate.salt},
-		{key: "volume", value: gate.volume},
-	} {
-		if err := writeKeyValue(b, e.key, e.value); err != nil {
+	values := gate.values()
+
+	for _, line := range gate.lines {
+		var err error
+		switch {
+		case line.key == "":
+			_, err = fmt.Fprintf(b, "%s\n", line.value)
+		case isGateKey(line.key):
+			// Known keys are written once, at the position where they first
+			// appeared in the file.
+			if v, ok := values[line.key]; ok {
+				err = writeKeyValue(b, line.key, v)
+				delete(values, line.key)
+			}
+		default:
+			err = writeKeyValue(b, line.key, line.value)
+		}
+		if err != nil {
 			return err
 		}
 	}
 
+	// Known keys which did not appear in the file (e.g. when the gate is
+	// created) are written in a consistent order.
+	for _, key := range gateKeys {
+		if v, ok := values[key]; ok {
+			if err := writeKeyValue(b, key, v); err != nil {
+				return err
+			}
+		}
+	}
+
 	return writeFile(path, func(f *os.File) error {
 		_, err := b.WriteTo(f)
 		return err
@@ -308,12 +555,18 @@ func acquireBufferedHash64() *bufferedHash64 {
 		h = &bufferedHash64{hash: fnv.New64a()}
 		h.buffer.Grow(128)
 	} else {
-		h.buffer.Reset()
-		h.hash.Reset()
+		h.reset()
 	}
 	return h
 }
 
+// reset discards the state of the hash, so the next gates are evaluated as if
+// they were the first of their family.
+func (h *bufferedHash64) reset() {
+	h.buffer.Reset()
+	h.hash.Reset()
+}
+
 func releaseBufferedHash64(h *bufferedHash64) {
 	hashes.Put(h)
 }
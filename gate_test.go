@@ -1,8 +1,11 @@
 package feature_test
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"testing"
@@ -11,10 +14,7 @@ import (
 )
 
 func TestGate(t *testing.T) {
-	tests := []struct {
-		scenario string
-		function func(*testing.T, feature.MountPoint, *feature.Tier)
-	}{
+	tests := []gateTest{
 		{
 			scenario: "enabled gates are exposed when listing gates for a tier",
 			function: testTierGateEnabled,
@@ -29,8 +29,41 @@ func TestGate(t *testing.T) {
 			scenario: "deleted gates are not exposed when listing gates for a tier",
 			function: testTierGateDelete,
 		},
+
+		{
+			scenario: "attributes and comments are preserved when enabling gates",
+			function: testTierGatePreserveAttributes,
+		},
+
+		{
+			scenario: "gate attributes can be set, read, and deleted",
+			function: testTierGateAttributes,
+		},
+
+		{
+			scenario: "gates with more buckets can be opened for volumes below 1%",
+			function: testTierGateBuckets,
+		},
+
+		{
+			scenario: "configuring a gate writes its volume and bucketing settings at once",
+			function: testTierGateConfigure,
+		},
 	}
 
+	runGateTests(t, tests, nil)
+}
+
+// gateTest is a scenario of the tests running against a tier, see
+// runGateTests.
+type gateTest struct {
+	scenario string
+	function func(*testing.T, feature.MountPoint, *feature.Tier)
+}
+
+// runGateTests runs each test against a new database with a single tier,
+// standard/1, which setup populates first unless it is nil.
+func runGateTests(t *testing.T, tests []gateTest, setup func(testing.TB, feature.MountPoint, *feature.Tier)) {
 	for _, test := range tests {
 		t.Run(test.scenario, func(t *testing.T) {
 			tmp, err := ioutil.TempDir("", "feature")
@@ -39,13 +72,14 @@ func TestGate(t *testing.T) {
 			}
 			defer os.RemoveAll(tmp)
 			path := feature.MountPoint(tmp)
+			createDatabase(t, path)
 
-			tier, err := path.CreateTier("standard", "1")
-			if err != nil {
-				t.Fatal(err)
-			}
+			tier := createTier(t, path, "standard", "1")
 			defer tier.Close()
 
+			if setup != nil {
+				setup(t, path, tier)
+			}
 			test.function(t, path, tier)
 		})
 	}
@@ -158,3 +192,191 @@ func expectGatesEnabled(t testing.TB, tier *feature.Tier, collection, id string,
 		t.Logf("got:  %+v", found)
 	}
 }
+
+func testTierGatePreserveAttributes(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	if err := tier.CreateGate("family-A", "gate-1", "collection", 1234); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(string(path), "standard", "1", "gates", "family-A", "gate-1", "collection")
+	if err := ioutil.WriteFile(file, []byte("# owned by the growth team\nopen\tfalse\nticket\tGROWTH-42\nsalt\t1234\nvolume\t0\ncolor\tred\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tier.EnableGate("family-A", "gate-1", "collection", 0.5, true); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# owned by the growth team\nopen\ttrue\nticket\tGROWTH-42\nsalt\t1234\nvolume\t0.5\ncolor\tred\n"
+	if string(b) != want {
+		t.Error("gate file mismatch")
+		t.Logf("want: %q", want)
+		t.Logf("got:  %q", b)
+	}
+}
+
+func testTierGateAttributes(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	if err := tier.CreateGate("family-A", "gate-1", "collection", 1234); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, attr := range []feature.Attribute{
+		{Key: "owner", Value: "growth"},
+		{Key: "ticket", Value: "GROWTH-42"},
+		{Key: "owner", Value: "platform team"},
+	} {
+		if err := tier.SetGateAttribute("family-A", "gate-1", "collection", attr.Key, attr.Value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	attrs, err := tier.ReadGateAttributes("family-A", "gate-1", "collection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []feature.Attribute{
+		{Key: "owner", Value: "platform team"},
+		{Key: "ticket", Value: "GROWTH-42"},
+	}
+	if !reflect.DeepEqual(attrs, want) {
+		t.Error("attributes mismatch")
+		t.Logf("want: %+v", want)
+		t.Logf("got:  %+v", attrs)
+	}
+
+	if err := tier.DeleteGateAttribute("family-A", "gate-1", "collection", "owner"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := tier.ReadGateAttribute("family-A", "gate-1", "collection", "owner"); err != nil || ok {
+		t.Errorf("attribute was not deleted: ok=%t err=%v", ok, err)
+	}
+
+	if err := tier.SetGateAttribute("family-A", "gate-1", "collection", "volume", "1"); err == nil {
+		t.Error("setting a reserved key did not fail")
+	}
+	if _, _, volume, err := tier.ReadGate("family-A", "gate-1", "collection"); err != nil || volume != 0 {
+		t.Errorf("gate was modified: volume=%g err=%v", volume, err)
+	}
+}
+
+func testTierGateBuckets(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	ids := make([]string, 10000)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("id-%05d", i)
+	}
+	populateCollection(t, createCollection(t, tier, "collection"), ids)
+
+	for _, gate := range []string{"gate-1", "gate-2", "gate-3"} {
+		createGate(t, tier, "family-A", gate, "collection", 1234)
+		enableGate(t, tier, "family-A", gate, "collection", 0.001, false)
+	}
+	for gate, buckets := range map[string]uint64{"gate-2": feature.DefaultBuckets, "gate-3": 10000} {
+		if err := tier.SetGateBuckets("family-A", gate, "collection", buckets); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tier.SetGateBuckets("family-A", "gate-1", "collection", 0); err == nil {
+		t.Error("setting zero buckets did not fail")
+	}
+
+	// Setting the default number of buckets does not change the gate file, so
+	// the gate remains interoperable with programs which do not support it.
+	for _, gate := range []string{"gate-1", "gate-2"} {
+		b, err := ioutil.ReadFile(filepath.Join(string(path), "standard", "1", "gates", "family-A", gate, "collection"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(b); s != "open\tfalse\nsalt\t1234\nvolume\t0.001\n" {
+			t.Errorf("gate file mismatch:\n%s", s)
+		}
+	}
+
+	buckets, err := tier.ReadGateBuckets("family-A", "gate-3", "collection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buckets != 10000 {
+		t.Errorf("buckets mismatch: want 10000, got %d", buckets)
+	}
+
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	count := make(map[string]int)
+	for _, id := range ids {
+		for _, gate := range c.LookupGates("family-A", "collection", id) {
+			count[gate]++
+		}
+	}
+
+	// With 100 buckets, volumes below 1% are rounded down to 0%.
+	if n := count["gate-1"] + count["gate-2"]; n != 0 {
+		t.Errorf("gates with 100 buckets are open for %d ids at 0.1%%", n)
+	}
+	if n := count["gate-3"]; n == 0 || n > 50 {
+		t.Errorf("gate with 10000 buckets is open for %d ids out of 10000 at 0.1%%", n)
+	}
+}
+
+func testTierGateConfigure(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	createGate(t, tier, "family-A", "gate-1", "collection", 1234)
+	gatePath := filepath.Join(string(path), "standard", "1", "gates", "family-A", "gate-1", "collection")
+
+	_, _, _, rev, err := tier.ReadGateRevision("family-A", "gate-1", "collection")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := feature.GateConfig{Volume: 0.001, Buckets: 10000, Hash: "sha1", BucketBy: "workspaces"}
+	if err := tier.CompareAndConfigureGate("family-A", "gate-1", "collection", config, rev); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(gatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "open\tfalse\nsalt\t1234\nvolume\t0.001\nbuckets\t10000\nhash\tsha1\nbucket-by\tworkspaces\n" {
+		t.Errorf("gate file mismatch:\n%s", s)
+	}
+
+	// The revision is compared once for all the changes, none of them are
+	// written when it is stale.
+	config = feature.GateConfig{Volume: 0.5, Buckets: 100, ClearBucketBy: true}
+	var conflict *feature.ConflictError
+	if err := tier.CompareAndConfigureGate("family-A", "gate-1", "collection", config, rev); !errors.As(err, &conflict) {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+	if b2, err := ioutil.ReadFile(gatePath); err != nil {
+		t.Fatal(err)
+	} else if string(b2) != string(b) {
+		t.Errorf("the gate file was modified:\n%s", b2)
+	}
+
+	// Zero values leave the settings unchanged.
+	if err := tier.CompareAndConfigureGate("family-A", "gate-1", "collection", config, ""); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = ioutil.ReadFile(gatePath); err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "open\tfalse\nsalt\t1234\nvolume\t0.5\nhash\tsha1\n" {
+		t.Errorf("gate file mismatch:\n%s", s)
+	}
+
+	for _, config := range []feature.GateConfig{
+		{Hash: "no-such-hash"},
+		{BucketBy: "../workspaces"},
+		{BucketBy: "workspaces", ClearBucketBy: true},
+	} {
+		if err := tier.CompareAndConfigureGate("family-A", "gate-1", "collection", config, ""); err == nil {
+			t.Errorf("invalid configuration did not fail: %+v", config)
+		}
+	}
+}
@@ -5,6 +5,5 @@ go 1.18
 require (
 	github.com/segmentio/cli v0.5.0
 	github.com/segmentio/fs v1.0.0
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
-
-require gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
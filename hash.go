@@ -0,0 +1,235 @@
+package feature
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultHash is the name of the hash algorithm used to assign ids to buckets,
+// unless the gate files select a different algorithm.
+const DefaultHash = "fnv64a"
+
+// HashFunc is the signature of functions assigning ids to buckets when
+// evaluating the volume of gates. The function must return the same bucket for
+// the same arguments, in the range [0, buckets).
+type HashFunc func(id, salt string, buckets uint64) uint64
+
+var hashRegistry = struct {
+	sync.RWMutex
+	funcs map[string]HashFunc
+}{
+	funcs: map[string]HashFunc{
+		DefaultHash: fnv64aHash,
+		"sha1":      sha1Hash,
+		"murmur3":   murmur3Hash,
+	},
+}
+
+// RegisterHash registers a hash algorithm under name, so gates can select it
+// in their gate files. This allows migrating gates from other systems while
+// retaining the assignment of ids to buckets.
+//
+// Programs must register the algorithms before loading databases which use
+// them, which usually means calling RegisterHash from an init function. The
+// function panics if name is empty or already registered.
+func RegisterHash(name string, hash HashFunc) {
+	if name == "" {
+		panic("feature.RegisterHash: empty hash name")
+	}
+	if hash == nil {
+		panic("feature.RegisterHash: nil hash function")
+	}
+	hashRegistry.Lock()
+	defer hashRegistry.Unlock()
+	if hashRegistry.funcs[name] != nil {
+		panic("feature.RegisterHash: hash registered twice: " + name)
+	}
+	hashRegistry.funcs[name] = hash
+}
+
+// LookupHash returns the hash algorithm registered under name, and a boolean
+// indicating whether it was found.
+//
+// The built-in algorithms are:
+//
+//	fnv64a  (default) FNV-1a 64 bits of the id followed by the salt
+//	sha1    the first 8 bytes of the SHA-1 of the id followed by the salt, as a
+//	        big-endian integer
+//	murmur3 MurmurHash3 x86 32 bits with seed 0 of the id followed by the salt
+//
+// The hash values are reduced modulo the number of buckets.
+func LookupHash(name string) (HashFunc, bool) {
+	hashRegistry.RLock()
+	defer hashRegistry.RUnlock()
+	hash := hashRegistry.funcs[name]
+	return hash, hash != nil
+}
+
+// Hashes returns the sorted list of names of the registered hash algorithms.
+func Hashes() []string {
+	hashRegistry.RLock()
+	defer hashRegistry.RUnlock()
+	names := make([]string, 0, len(hashRegistry.funcs))
+	for name := range hashRegistry.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupHash returns the hash function used to evaluate gates using the named
+// algorithm, which is nil for the default algorithm so the evaluation can use
+// its optimized implementation.
+func lookupHash(name string) (HashFunc, error) {
+	if name == "" || name == DefaultHash {
+		return nil, nil
+	}
+	hash, ok := LookupHash(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown hash algorithm: %q", name)
+	}
+	return hash, nil
+}
+
+func fnv64aHash(id, salt string, buckets uint64) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	h.Write([]byte(salt))
+	return h.Sum64() % buckets
+}
+
+func sha1Hash(id, salt string, buckets uint64) uint64 {
+	sum := sha1.Sum([]byte(id + salt))
+	return binary.BigEndian.Uint64(sum[:8]) % buckets
+}
+
+func murmur3Hash(id, salt string, buckets uint64) uint64 {
+	return uint64(murmur3([]byte(id+salt), 0)) % buckets
+}
+
+// murmur3 is the x86 32 bits variant of MurmurHash3.
+func murmur3(b []byte, seed uint32) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+
+	h := seed
+	n := len(b) / 4
+
+	for i := 0; i < n; i++ {
+		k := binary.LittleEndian.Uint32(b[4*i:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k uint32
+	switch tail := b[4*n:]; len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(b))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+// SetGateHash sets the name of the hash algorithm assigning ids to buckets
+// when evaluating the volume of a gate, which must have been registered (see
+// RegisterHash). Setting DefaultHash restores the historical algorithm.
+//
+// Changing the hash algorithm of a gate changes which ids are admitted at a
+// given volume, it is best done before the gate is rolled out.
+func (tier *Tier) SetGateHash(family, name, collection, hash string) error {
+	if _, ok := LookupHash(hash); !ok {
+		return fmt.Errorf("%s/%s: unknown hash algorithm: %q", family, name, hash)
+	}
+	return tier.updateGate(family, name, collection, func(g *gate) { g.hash = hash })
+}
+
+// ReadGateHash returns the name of the hash algorithm assigning ids to buckets
+// when evaluating the volume of a gate.
+func (tier *Tier) ReadGateHash(family, name, collection string) (string, error) {
+	if err := validateGateNames(family, name, collection); err != nil {
+		return "", err
+	}
+	g, err := readGate(tier.gateCollectionPath(family, name, collection))
+	return g.hashName(), err
+}
+
+// Simulation is the assignment of an id to a bucket of a gate, as returned by
+// SimulateGate.
+type Simulation struct {
+	ID     string
+	Bucket uint64
+	Open   bool
+}
+
+// SimulateGate computes the buckets that ids are assigned to by a gate, and
+// whether the gate is open for them at its current volume, regardless of
+// whether they are part of the collection.
+//
+// A non-empty hash or non-zero number of buckets overrides those of the gate,
+// which allows verifying that a gate migrated from another system assigns ids
+// to the same buckets, or previewing the effect of changing them.
+//
+// The buckets are those of the gate evaluated alone. With DefaultHash, lookups
+// also hash the ids of the gates of the family evaluated before it, see the
+// Compatibility section of the README.
+func (tier *Tier) SimulateGate(family, name, collection string, ids []string, hash string, buckets uint64) ([]Simulation, error) {
+	if err := validateGateNames(family, name, collection); err != nil {
+		return nil, err
+	}
+	g, err := readGate(tier.gateCollectionPath(family, name, collection))
+	if err != nil {
+		return nil, err
+	}
+	if hash != "" {
+		g.hash = hash
+	}
+	if buckets != 0 {
+		g.buckets = buckets
+	}
+	f, ok := LookupHash(g.hashName())
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: unknown hash algorithm: %q", family, name, g.hashName())
+	}
+
+	volume := g.ramp.VolumeAt(time.Now(), g.volume)
+	simulations := make([]Simulation, len(ids))
+
+	for i, id := range ids {
+		bucket := f(id, g.salt, g.bucketCount())
+		simulations[i] = Simulation{
+			ID:     id,
+			Bucket: bucket,
+			Open:   openBucket(bucket, g.bucketCount(), volume),
+		}
+	}
+
+	return simulations, nil
+}
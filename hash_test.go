@@ -0,0 +1,207 @@
+package feature_test
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/feature"
+)
+
+func init() {
+	feature.RegisterHash("test-length", func(id, salt string, buckets uint64) uint64 {
+		return uint64(len(id)) % buckets
+	})
+}
+
+func TestGateHash(t *testing.T) {
+	tests := []gateTest{
+		{
+			scenario: "hash algorithms written to a tier can be read back",
+			function: testGateHashReadWrite,
+		},
+
+		{
+			scenario: "the built-in hash algorithms compute the expected buckets",
+			function: testGateHashBuiltins,
+		},
+
+		{
+			scenario: "caches evaluate gates with their hash algorithm",
+			function: testGateHashCache,
+		},
+
+		{
+			scenario: "gates using unknown hash algorithms are reported and fail to load",
+			function: testGateHashUnknown,
+		},
+	}
+
+	runGateTests(t, tests, func(t testing.TB, path feature.MountPoint, tier *feature.Tier) {
+		populateCollection(t, createCollection(t, tier, "workspaces"), makeIDs("id-%03d", 200))
+		createGate(t, tier, "family-A", "gate-1", "workspaces", 1234)
+		enableGate(t, tier, "family-A", "gate-1", "workspaces", 0.5, false)
+	})
+}
+
+func testGateHashReadWrite(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	gatePath := filepath.Join(string(path), "standard", "1", "gates", "family-A", "gate-1", "workspaces")
+
+	expectGateHash(t, tier, feature.DefaultHash)
+
+	for _, hash := range []string{"sha1", "murmur3", "test-length"} {
+		if err := tier.SetGateHash("family-A", "gate-1", "workspaces", hash); err != nil {
+			t.Fatal(err)
+		}
+		expectGateHash(t, tier, hash)
+	}
+
+	b, err := ioutil.ReadFile(gatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "open\tfalse\nsalt\t1234\nvolume\t0.5\nhash\ttest-length\n" {
+		t.Errorf("gate file mismatch:\n%s", s)
+	}
+
+	if err := tier.SetGateHash("family-A", "gate-1", "workspaces", "no-such-hash"); err == nil {
+		t.Error("setting an unknown hash algorithm did not fail")
+	}
+
+	// Setting the default hash restores the original gate file, so the gate
+	// remains interoperable with programs which do not support it.
+	if err := tier.SetGateHash("family-A", "gate-1", "workspaces", feature.DefaultHash); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = ioutil.ReadFile(gatePath); err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "open\tfalse\nsalt\t1234\nvolume\t0.5\n" {
+		t.Errorf("gate file mismatch:\n%s", s)
+	}
+
+	if hashes := feature.Hashes(); !reflect.DeepEqual(hashes, []string{"fnv64a", "murmur3", "sha1", "test-length"}) {
+		t.Errorf("registered hashes mismatch: %q", hashes)
+	}
+}
+
+func testGateHashBuiltins(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	h := fnv.New64a()
+	h.Write([]byte("id-0011234"))
+
+	// The known results of SHA-1 and MurmurHash3 are obtained by setting the
+	// salt of the gate to the end of their test inputs.
+	for _, test := range []struct {
+		hash    string
+		salt    string
+		id      string
+		buckets uint64
+		bucket  uint64
+	}{
+		{"fnv64a", "1234", "id-001", math.MaxUint64, h.Sum64() % math.MaxUint64},
+		{"fnv64a", "1234", "id-001", 100, h.Sum64() % 100},
+		{"sha1", "c", "ab", math.MaxUint64, 0xa9993e364706816a},
+		{"sha1", "c", "ab", 100, 0xa9993e364706816a % 100},
+		{"murmur3", "dog", "The quick brown fox jumps over the lazy ", 1 << 32, 0x2e4ff723},
+		{"murmur3", "", "", 1 << 32, 0},
+		{"murmur3", "o", "hell", 1 << 32, 0x248bfa47},
+	} {
+		writeGateFile(t, path, fmt.Sprintf("open\tfalse\nsalt\t%s\nvolume\t0.5\n", test.salt))
+
+		s, err := tier.SimulateGate("family-A", "gate-1", "workspaces", []string{test.id}, test.hash, test.buckets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s) != 1 || s[0].ID != test.id || s[0].Bucket != test.bucket {
+			t.Errorf("%s: bucket mismatch for %q with %d buckets: want %d, got %+v", test.hash, test.id+test.salt, test.buckets, test.bucket, s)
+		}
+	}
+}
+
+func testGateHashCache(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	ids := make([]string, 200)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("id-%03d", i)
+	}
+
+	admitted := make(map[string][]string)
+
+	for _, hash := range []string{feature.DefaultHash, "sha1", "murmur3"} {
+		if err := tier.SetGateHash("family-A", "gate-1", "workspaces", hash); err != nil {
+			t.Fatal(err)
+		}
+
+		simulations, err := tier.SimulateGate("family-A", "gate-1", "workspaces", ids, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := path.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, s := range simulations {
+			expectGateIsEnabled(t, c, "family-A", "gate-1", "workspaces", s.ID, s.Open)
+			if s.Open {
+				admitted[hash] = append(admitted[hash], s.ID)
+			}
+		}
+
+		c.Close()
+	}
+
+	if reflect.DeepEqual(admitted["sha1"], admitted["murmur3"]) || reflect.DeepEqual(admitted[feature.DefaultHash], admitted["sha1"]) {
+		t.Error("different hash algorithms admitted the same ids")
+	}
+}
+
+func testGateHashUnknown(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	writeGateFile(t, path, "open\tfalse\nsalt\t1234\nvolume\t0.5\nhash\tno-such-hash\n")
+
+	expectProblems(t, string(path), validate(t, path), []string{
+		`standard/1/gates/family-A/gate-1/workspaces:4: warning: unknown hash algorithm "no-such-hash", the gate is closed in programs which did not register it`,
+	})
+
+	// The other gates of the database can still be evaluated.
+	createGate(t, tier, "family-A", "gate-2", "workspaces", 1234)
+	enableGate(t, tier, "family-A", "gate-2", "workspaces", 1, false)
+
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, id := range []string{"id-000", "id-001", "id-002"} {
+		expectGateIsEnabled(t, c, "family-A", "gate-1", "workspaces", id, false)
+		expectGateIsEnabled(t, c, "family-A", "gate-2", "workspaces", id, true)
+		expectGateLookup(t, c, "family-A", "workspaces", id, []string{"gate-2"})
+	}
+}
+
+func expectGateHash(t testing.TB, tier *feature.Tier, hash string) {
+	t.Helper()
+
+	found, err := tier.ReadGateHash("family-A", "gate-1", "workspaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != hash {
+		t.Errorf("hash mismatch: want %q, got %q", hash, found)
+	}
+}
+
+func writeGateFile(t testing.TB, path feature.MountPoint, content string) {
+	t.Helper()
+
+	p := filepath.Join(string(path), "standard", "1", "gates", "family-A", "gate-1", "workspaces")
+	if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	refreshManifest(t, path)
+}
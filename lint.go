@@ -0,0 +1,350 @@
+package feature
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Off is a severity used to disable lint rules in LintConfig.
+const Off Severity = -1
+
+// ParseSeverity parses the name of a severity ("warning", "error", or "off").
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(s) {
+	case "warning":
+		return Warning, nil
+	case "error":
+		return Error, nil
+	case "off":
+		return Off, nil
+	default:
+		return Off, fmt.Errorf("invalid severity: %q", s)
+	}
+}
+
+// LintRule describes a rule applied by Lint.
+type LintRule struct {
+	// The name of the rule, which is used to select rules and configure their
+	// severity in LintConfig.
+	Name string
+
+	// A description of the configurations that the rule reports.
+	Description string
+
+	// The severity of problems reported by the rule when it is not configured.
+	Severity Severity
+
+	check func(*linter)
+}
+
+// LintRules returns the list of rules applied by Lint, sorted by name.
+func LintRules() []LintRule {
+	rules := make([]LintRule, len(lintRules))
+	copy(rules, lintRules)
+	return rules
+}
+
+var lintRules = []LintRule{
+	{
+		Name:        "dead-gate",
+		Description: "gates with volume 0 and closed by default in every tier, which are never open",
+		Severity:    Warning,
+		check:       lintDeadGate,
+	},
+	{
+		Name:        "empty-collection",
+		Description: "collections which contain no ids",
+		Severity:    Warning,
+		check:       lintEmptyCollection,
+	},
+	{
+		Name:        "imprecise-volume",
+		Description: "gates with volumes finer than the granularity of their buckets, which are rounded down",
+		Severity:    Warning,
+		check:       lintImpreciseVolume,
+	},
+	{
+		Name:        "inconsistent-salt",
+		Description: "gates with different salts in different tiers, which bucket ids inconsistently",
+		Severity:    Warning,
+		check:       lintInconsistentSalt,
+	},
+	{
+		Name:        "open-contradicts-volume",
+		Description: "gates open by default but only partially open for the ids of their collection",
+		Severity:    Warning,
+		check:       lintOpenContradictsVolume,
+	},
+	{
+		Name:        "single-tier-gate",
+		Description: "gates present in only one tier of a group which has multiple tiers",
+		Severity:    Warning,
+		check:       lintSingleTierGate,
+	},
+}
+
+// LintConfig configures the rules applied by Lint.
+type LintConfig struct {
+	// The names of rules to apply, all rules are applied when empty.
+	Rules []string
+
+	// Overrides the default severity of rules, the Off severity disables the
+	// rule.
+	Severity map[string]Severity
+}
+
+// Lint reports configurations of the feature database which are legal, but
+// likely to be mistakes. The Rule field of the returned problems is set to
+// the name of the rule that reported them, and the problems are not fixable.
+//
+// The returned error is non-nil if the database could not be loaded, or the
+// configuration refers to rules that do not exist.
+func (path MountPoint) Lint(config LintConfig) ([]Problem, error) {
+	selected := make(map[string]bool, len(config.Rules))
+	for _, name := range config.Rules {
+		selected[name] = true
+	}
+
+	for name := range selected {
+		if !isLintRule(name) {
+			return nil, fmt.Errorf("unknown lint rule: %q", name)
+		}
+	}
+	for name := range config.Severity {
+		if !isLintRule(name) {
+			return nil, fmt.Errorf("unknown lint rule: %q", name)
+		}
+	}
+
+	root, err := filepath.EvalSymlinks(string(path))
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := MountPoint(root).Load()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	// Tiers are sorted so the problems are always reported in the same order.
+	tiers := append([]cachedTier{}, c.tiers...)
+	sort.Slice(tiers, func(i, j int) bool {
+		if tiers[i].group != tiers[j].group {
+			return tiers[i].group < tiers[j].group
+		}
+		return tiers[i].name < tiers[j].name
+	})
+
+	l := &linter{root: root, tiers: tiers}
+
+	for _, rule := range lintRules {
+		if len(selected) != 0 && !selected[rule.Name] {
+			continue
+		}
+		severity, ok := config.Severity[rule.Name]
+		if !ok {
+			severity = rule.Severity
+		}
+		if severity == Off {
+			continue
+		}
+		l.rule, l.severity = rule.Name, severity
+		rule.check(l)
+	}
+
+	return l.problems, nil
+}
+
+func isLintRule(name string) bool {
+	for _, rule := range lintRules {
+		if rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type linter struct {
+	root     string
+	tiers    []cachedTier
+	rule     string
+	severity Severity
+	problems []Problem
+}
+
+func (l *linter) report(path string, msg string, args ...interface{}) {
+	l.problems = append(l.problems, Problem{
+		Path:     path,
+		Severity: l.severity,
+		Rule:     l.rule,
+		Message:  fmt.Sprintf(msg, args...),
+	})
+}
+
+func (l *linter) gatePath(tier *cachedTier, family string, gate *cachedGate) string {
+	return filepath.Join(l.root, tier.group, tier.name, "gates", family, gate.name, gate.collection)
+}
+
+// lintGateKey identifies a gate across tiers.
+type lintGateKey struct {
+	family     string
+	gate       string
+	collection string
+}
+
+// forEachGate calls do for each gate of each tier, in a deterministic order.
+func (l *linter) forEachGate(do func(*cachedTier, string, *cachedGate)) {
+	for i := range l.tiers {
+		t := &l.tiers[i]
+		l.forEachTierGate(t, func(family string, g *cachedGate) { do(t, family, g) })
+	}
+}
+
+func lintDeadGate(l *linter) {
+	type state struct {
+		path string
+		dead bool
+	}
+	gates := make(map[lintGateKey]*state)
+	order := make([]lintGateKey, 0)
+
+	l.forEachGate(func(t *cachedTier, family string, g *cachedGate) {
+		k := lintGateKey{family, g.name, g.collection}
+		s := gates[k]
+		if s == nil {
+			s = &state{path: l.gatePath(t, family, g), dead: true}
+			gates[k] = s
+			order = append(order, k)
+		}
+		if g.open || g.volume > 0 {
+			s.dead = false
+		}
+	})
+
+	for _, k := range order {
+		if gates[k].dead {
+			l.report(gates[k].path, "gate %s/%s is closed for all %s in every tier", k.family, k.gate, k.collection)
+		}
+	}
+}
+
+func lintEmptyCollection(l *linter) {
+	for i := range l.tiers {
+		t := &l.tiers[i]
+		names := make([]string, 0, len(t.collections))
+		for name, col := range t.collections {
+			if len(col.index) == 0 {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			l.report(filepath.Join(l.root, t.group, t.name, "collections", name), "collection is empty")
+		}
+	}
+}
+
+func lintInconsistentSalt(l *linter) {
+	type state struct {
+		salt string
+		tier string
+	}
+	salts := make(map[lintGateKey]state)
+
+	l.forEachGate(func(t *cachedTier, family string, g *cachedGate) {
+		k := lintGateKey{family, g.name, g.collection}
+		s, ok := salts[k]
+		if !ok {
+			salts[k] = state{salt: g.salt, tier: t.group + "/" + t.name}
+			return
+		}
+		if s.salt != g.salt {
+			l.report(l.gatePath(t, family, g), "salt %s differs from salt %s of the same gate in tier %s, ids are bucketed inconsistently",
+				g.salt, s.salt, s.tier)
+		}
+	})
+}
+
+func lintImpreciseVolume(l *linter) {
+	l.forEachGate(func(t *cachedTier, family string, g *cachedGate) {
+		if g.volume <= 0 || g.volume >= 1 {
+			return
+		}
+		// Volumes are parsed from decimal representations, tolerate rounding
+		// errors of the conversion.
+		n := float64(g.buckets) * g.volume
+		if n-math.Floor(n) > 1e-9 && math.Ceil(n)-n > 1e-9 {
+			l.report(l.gatePath(t, family, g), "volume %g%% is rounded down to %g%% with %d buckets",
+				g.volume*100, math.Floor(n)*100/float64(g.buckets), g.buckets)
+		}
+	})
+}
+
+func lintOpenContradictsVolume(l *linter) {
+	l.forEachGate(func(t *cachedTier, family string, g *cachedGate) {
+		if g.open && g.volume < 1 {
+			l.report(l.gatePath(t, family, g), "gate is open by default but only open for %.0f%% of the ids of the collection", g.volume*100)
+		}
+	})
+}
+
+func lintSingleTierGate(l *linter) {
+	type gateKey struct {
+		group  string
+		family string
+		gate   string
+	}
+	tiers := make(map[string]int)
+	gates := make(map[gateKey][]string)
+	order := make([]gateKey, 0)
+
+	for i := range l.tiers {
+		t := &l.tiers[i]
+		tiers[t.group]++
+		seen := make(map[gateKey]bool)
+
+		l.forEachTierGate(t, func(family string, g *cachedGate) {
+			k := gateKey{t.group, family, g.name}
+			if seen[k] {
+				return
+			}
+			seen[k] = true
+			if gates[k] == nil {
+				order = append(order, k)
+			}
+			gates[k] = append(gates[k], filepath.Join(l.root, t.group, t.name, "gates", family, g.name))
+		})
+	}
+
+	for _, k := range order {
+		if paths := gates[k]; len(paths) == 1 && tiers[k.group] > 1 {
+			l.report(paths[0], "gate %s/%s only exists in one of the %d tiers of group %s", k.family, k.gate, tiers[k.group], k.group)
+		}
+	}
+}
+
+func (l *linter) forEachTierGate(t *cachedTier, do func(string, *cachedGate)) {
+	families := make([]string, 0, len(t.gates))
+	for family := range t.gates {
+		families = append(families, family)
+	}
+	sort.Strings(families)
+
+	for _, family := range families {
+		gates := append([]cachedGate{}, t.gates[family]...)
+		sort.Slice(gates, func(i, j int) bool {
+			if gates[i].name != gates[j].name {
+				return gates[i].name < gates[j].name
+			}
+			return gates[i].collection < gates[j].collection
+		})
+		for j := range gates {
+			do(family, &gates[j])
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package feature_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/segmentio/feature"
+)
+
+func TestLint(t *testing.T) {
+	files := map[string]string{
+		"standard/1/collections/workspaces":           "id-1\n",
+		"standard/1/collections/users":                "",
+		"standard/1/gates/family-A/gate-1/workspaces": "open\tfalse\nsalt\t1234\nvolume\t0\n",
+		"standard/1/gates/family-A/gate-2/workspaces": "open\ttrue\nsalt\t1234\nvolume\t0.5\n",
+		"standard/2/collections/workspaces":           "id-2\n",
+		"standard/2/gates/family-A/gate-1/workspaces": "open\tfalse\nsalt\t1234\nvolume\t0\n",
+		"standard/2/gates/family-A/gate-2/workspaces": "open\ttrue\nsalt\t5678\nvolume\t1\n",
+		"standard/2/gates/family-A/gate-3/workspaces": "open\tfalse\nsalt\t1234\nvolume\t1\n",
+		"standard/1/gates/family-A/gate-4/workspaces": "open\tfalse\nsalt\t1234\nvolume\t0.005\n",
+		"standard/2/gates/family-A/gate-4/workspaces": "open\tfalse\nsalt\t1234\nvolume\t0.005\nbuckets\t1000\n",
+	}
+
+	tests := []struct {
+		scenario string
+		config   feature.LintConfig
+		problems []string
+	}{
+		{
+			scenario: "all rules are applied by default",
+			problems: []string{
+				`standard/1/gates/family-A/gate-1/workspaces: warning: gate family-A/gate-1 is closed for all workspaces in every tier [dead-gate]`,
+				`standard/1/collections/users: warning: collection is empty [empty-collection]`,
+				`standard/1/gates/family-A/gate-4/workspaces: warning: volume 0.5% is rounded down to 0% with 100 buckets [imprecise-volume]`,
+				`standard/2/gates/family-A/gate-2/workspaces: warning: salt 5678 differs from salt 1234 of the same gate in tier standard/1, ids are bucketed inconsistently [inconsistent-salt]`,
+				`standard/1/gates/family-A/gate-2/workspaces: warning: gate is open by default but only open for 50% of the ids of the collection [open-contradicts-volume]`,
+				`standard/2/gates/family-A/gate-3: warning: gate family-A/gate-3 only exists in one of the 2 tiers of group standard [single-tier-gate]`,
+			},
+		},
+
+		{
+			scenario: "rules can be selected and their severity configured",
+			config: feature.LintConfig{
+				Rules: []string{"dead-gate", "empty-collection", "single-tier-gate"},
+				Severity: map[string]feature.Severity{
+					"dead-gate":        feature.Error,
+					"empty-collection": feature.Off,
+				},
+			},
+			problems: []string{
+				`standard/1/gates/family-A/gate-1/workspaces: error: gate family-A/gate-1 is closed for all workspaces in every tier [dead-gate]`,
+				`standard/2/gates/family-A/gate-3: warning: gate family-A/gate-3 only exists in one of the 2 tiers of group standard [single-tier-gate]`,
+			},
+		},
+	}
+
+	tmp, err := ioutil.TempDir("", "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if tmp, err = filepath.EvalSymlinks(tmp); err != nil {
+		t.Fatal(err)
+	}
+	path := feature.MountPoint(tmp)
+
+	for name, content := range files {
+		p := filepath.Join(tmp, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			problems, err := path.Lint(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectProblems(t, tmp, problems, test.problems)
+		})
+	}
+
+	t.Run("unknown rules are rejected", func(t *testing.T) {
+		if _, err := path.Lint(feature.LintConfig{Rules: []string{"no-such-rule"}}); err == nil {
+			t.Error("expected an error for an unknown rule")
+		}
+	})
+}
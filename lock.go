@@ -0,0 +1,189 @@
+package feature
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LockTimeout is the maximum amount of time that write operations wait to
+// acquire advisory locks on a feature database.
+//
+// Write operations on tiers and collections acquire a shared lock on the
+// database and an exclusive lock on the tier they modify, operations that
+// create or delete tiers and groups, or replace the database, acquire an
+// exclusive lock on the database.
+//
+// The locks are advisory, they only serialize programs that use this package
+// to modify the database. On platforms which do not support flock(2), locking
+// is a no-op.
+var LockTimeout = 10 * time.Second
+
+// LockError is returned by write operations that could not acquire a lock
+// before LockTimeout expired.
+type LockError struct {
+	// The path to the lock file.
+	Path string
+
+	// The holder of the lock, which is nil if the lock is held in shared mode
+	// or the holder could not be determined.
+	Holder *LockHolder
+}
+
+// Error satisfies the error interface.
+func (e *LockError) Error() string {
+	if e.Holder == nil {
+		return fmt.Sprintf("%s: timed out waiting for lock held by another process", e.Path)
+	}
+	return fmt.Sprintf("%s: timed out waiting for lock held by %s", e.Path, e.Holder)
+}
+
+// LockHolder describes the process holding an exclusive lock.
+type LockHolder struct {
+	PID     int
+	Host    string
+	User    string
+	Command string
+	Time    time.Time
+}
+
+// String returns a human-readable representation of h.
+func (h *LockHolder) String() string {
+	return fmt.Sprintf("pid %d on %s (user: %s, command: %q) since %s",
+		h.PID, h.Host, h.User, h.Command, h.Time.Format(time.RFC3339))
+}
+
+func currentLockHolder() []byte {
+	host, _ := os.Hostname()
+	b := new(bytes.Buffer)
+	writeKeyValue(b, "pid", os.Getpid())
+	writeKeyValue(b, "host", host)
+	writeKeyValue(b, "user", os.Getenv("USER"))
+	writeKeyValue(b, "command", strings.Join(os.Args, " "))
+	writeKeyValue(b, "time", time.Now().UTC().Format(time.RFC3339))
+	return b.Bytes()
+}
+
+func parseLockHolder(b []byte) *LockHolder {
+	h := &LockHolder{}
+
+	forEachLine(b, func(i, n int) {
+		k, v := splitKeyValue(bytes.TrimSpace(b[i : i+n]))
+		switch string(k) {
+		case "pid":
+			h.PID, _ = strconv.Atoi(string(v))
+		case "host":
+			h.Host = string(v)
+		case "user":
+			h.User = string(v)
+		case "command":
+			h.Command = string(v)
+		case "time":
+			h.Time, _ = time.Parse(time.RFC3339, string(v))
+		}
+	})
+
+	if h.PID == 0 {
+		return nil
+	}
+	return h
+}
+
+type lockFile struct {
+	file *os.File
+}
+
+// acquireLock opens the lock file at path and locks it in shared or exclusive
+// mode, waiting at most LockTimeout.
+func acquireLock(path string, exclusive bool) (*lockFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(LockTimeout)
+	backoff := time.Millisecond
+
+	for {
+		locked, err := flock(f, exclusive)
+		if err != nil {
+			f.Close()
+			return nil, &os.PathError{Op: "flock", Path: path, Err: err}
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			b, _ := readLockFile(f)
+			f.Close()
+			return nil, &LockError{Path: path, Holder: parseLockHolder(b)}
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > 10*time.Millisecond {
+			backoff = 10 * time.Millisecond
+		}
+	}
+
+	if exclusive {
+		// Record information about the lock holder, so other processes can
+		// report it when they fail to acquire the lock.
+		if err := f.Truncate(0); err == nil {
+			f.WriteAt(currentLockHolder(), 0)
+		}
+	}
+
+	return &lockFile{file: f}, nil
+}
+
+func (l *lockFile) release() error {
+	if l.file == nil {
+		return nil
+	}
+	l.file.Truncate(0)
+	err := funlock(l.file)
+	l.file.Close()
+	l.file = nil
+	return err
+}
+
+func readLockFile(f *os.File) ([]byte, error) {
+	s, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, s.Size())
+	n, err := f.ReadAt(b, 0)
+	return b[:n], err
+}
+
+func withLock(path string, exclusive bool, do func() error) error {
+	l, err := acquireLock(path, exclusive)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// The directory holding the lock file does not exist, there is
+			// nothing to protect; let the operation report the error (or
+			// succeed when deleting).
+			return do()
+		}
+		return err
+	}
+	defer l.release()
+	return do()
+}
+
+// lock calls do while holding a lock on the database.
+func (path MountPoint) lock(exclusive bool, do func() error) error {
+	return withLock(filepath.Join(string(path), ".lock"), exclusive, do)
+}
+
+// lock calls do while holding an exclusive lock on the tier, and a shared lock
+// on the database.
+func (tier *Tier) lock(do func() error) error {
+	return tier.path.lock(false, func() error {
+		return withLock(tier.pathTo(".lock"), true, do)
+	})
+}
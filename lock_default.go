@@ -0,0 +1,14 @@
+//go:build !darwin && !linux
+// +build !darwin,!linux
+
+package feature
+
+import "os"
+
+func flock(*os.File, bool) (bool, error) {
+	return true, nil
+}
+
+func funlock(*os.File) error {
+	return nil
+}
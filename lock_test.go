@@ -0,0 +1,168 @@
+//go:build darwin || linux
+// +build darwin linux
+
+package feature_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/segmentio/feature"
+)
+
+func TestLock(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, feature.MountPoint, *feature.Tier)
+	}{
+		{
+			scenario: "concurrent writers to a collection do not lose updates",
+			function: testLockConcurrentCollectionWriters,
+		},
+
+		{
+			scenario: "writers time out when the tier is locked and report the lock holder",
+			function: testLockTierTimeout,
+		},
+
+		{
+			scenario: "creating tiers times out when the database is locked",
+			function: testLockDatabaseTimeout,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "feature")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+			path := feature.MountPoint(tmp)
+
+			tier, err := path.CreateTier("standard", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tier.Close()
+			test.function(t, path, tier)
+		})
+	}
+}
+
+func testLockConcurrentCollectionWriters(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	createCollection(t, tier, "workspaces").Close()
+
+	const N = 20
+	ids := make([]string, N)
+	wg := sync.WaitGroup{}
+
+	for i := range ids {
+		ids[i] = fmt.Sprintf("id-%02d", i)
+		wg.Add(1)
+
+		go func(id string) {
+			defer wg.Done()
+			c, err := tier.OpenCollection("workspaces")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			c.Add(id)
+			if err := c.Close(); err != nil {
+				t.Error(err)
+			}
+		}(ids[i])
+	}
+
+	wg.Wait()
+
+	found := readAll(t, tier.IDs("workspaces"))
+	sort.Strings(found)
+	if !reflect.DeepEqual(found, ids) {
+		t.Error("ids mismatch")
+		t.Logf("want: %q", ids)
+		t.Logf("got:  %q", found)
+	}
+}
+
+func testLockTierTimeout(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	holder := "pid\t42\nhost\tlocalhost\nuser\tbob\ncommand\tfeature enable\ntime\t2021-01-02T03:04:05Z\n"
+	unlock := holdLock(t, filepath.Join(string(path), "standard", "1", ".lock"), holder)
+	defer unlock()
+
+	defer setLockTimeout(50 * time.Millisecond)()
+
+	err := tier.CreateGate("family-A", "gate-1", "workspaces", 1234)
+
+	lockErr := new(feature.LockError)
+	if !errors.As(err, &lockErr) {
+		t.Fatalf("expected a lock error, got %v", err)
+	}
+	if lockErr.Holder == nil {
+		t.Fatal("lock error does not report the lock holder")
+	}
+	if lockErr.Holder.PID != 42 || lockErr.Holder.User != "bob" || lockErr.Holder.Command != "feature enable" {
+		t.Errorf("lock holder mismatch: %+v", lockErr.Holder)
+	}
+
+	unlock()
+
+	if err := tier.CreateGate("family-A", "gate-1", "workspaces", 1234); err != nil {
+		t.Error(err)
+	}
+}
+
+func testLockDatabaseTimeout(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	unlock := holdLock(t, filepath.Join(string(path), ".lock"), "")
+	defer unlock()
+
+	defer setLockTimeout(50 * time.Millisecond)()
+
+	_, err := path.CreateTier("standard", "2")
+
+	lockErr := new(feature.LockError)
+	if !errors.As(err, &lockErr) {
+		t.Fatalf("expected a lock error, got %v", err)
+	}
+	if lockErr.Holder != nil {
+		t.Errorf("unexpected lock holder: %+v", lockErr.Holder)
+	}
+}
+
+func holdLock(t testing.TB, path, holder string) (unlock func()) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(holder); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+
+	return func() {
+		if f != nil {
+			f.Close()
+			f = nil
+		}
+	}
+}
+
+func setLockTimeout(timeout time.Duration) (reset func()) {
+	prev := feature.LockTimeout
+	feature.LockTimeout = timeout
+	return func() { feature.LockTimeout = prev }
+}
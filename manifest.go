@@ -0,0 +1,407 @@
+package feature
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// manifestFile is the name of the manifest at the root of feature
+	// databases.
+	manifestFile = ".manifest"
+
+	// manifestLockFile is the lock serializing incremental updates of the
+	// manifest by writers modifying the database in place.
+	manifestLockFile = ".manifest.lock"
+)
+
+// DefaultProducer is the producer recorded in manifests written by Builder and
+// the write APIs of MountPoint and Tier.
+var DefaultProducer = filepath.Base(os.Args[0]) + " (github.com/segmentio/feature)"
+
+// Manifest represents the root metadata of a feature database.
+//
+// The manifest is optional, it is stored in a hidden file at the root of the
+// database and lists the content hash of every file in the tree. When it is
+// present, Load refuses databases where files are missing, modified, or not
+// listed in the manifest.
+type Manifest struct {
+	// The version of the layout of the database (see FormatVersion).
+	Format int
+
+	// The time at which the manifest was created.
+	Created time.Time
+
+	// A description of the program that produced the database.
+	Producer string
+
+	// The content hashes of the files in the database, indexed by their path
+	// relative to the root, using forward slashes as separators. Hashes are
+	// formatted as "sha256:<hex>".
+	Files map[string]string
+}
+
+// ManifestError is returned when the content of a feature database does not
+// match its manifest.
+type ManifestError struct {
+	// The path of the file relative to the root of the database.
+	Path string
+
+	// A description of the inconsistency.
+	Reason string
+}
+
+// Error satisfies the error interface.
+func (e *ManifestError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+}
+
+// ReadManifest reads the manifest of the database at the mount point. If the
+// database has no manifest, the error satisfies os.IsNotExist.
+func (path MountPoint) ReadManifest() (*Manifest, error) {
+	return readManifest(filepath.Join(string(path), manifestFile))
+}
+
+// WriteManifest computes the content hashes of all the files of the database
+// at the mount point, and writes the manifest recording them. The format
+// version declared by the previous manifest is retained, databases that had no
+// manifest are declared to use the original layout (version 1).
+//
+// Programs modifying the database through the write APIs of this package do
+// not need to call WriteManifest again, the manifest is updated incrementally
+// when it exists.
+func (path MountPoint) WriteManifest(producer string) (*Manifest, error) {
+	format, err := path.Format()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFormat(string(path), format); err != nil {
+		return nil, err
+	}
+	return path.writeManifest(producer, format)
+}
+
+func (path MountPoint) writeManifest(producer string, format int) (*Manifest, error) {
+	if producer == "" {
+		producer = DefaultProducer
+	}
+
+	m := &Manifest{
+		Format:   format,
+		Created:  time.Now().UTC(),
+		Producer: producer,
+		Files:    make(map[string]string),
+	}
+
+	err := withLock(filepath.Join(string(path), manifestLockFile), true, func() error {
+		if err := m.add(string(path), string(path)); err != nil {
+			return err
+		}
+		return writeManifest(filepath.Join(string(path), manifestFile), m)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Verify checks that the files of the database at the mount point match the
+// manifest, returning a *ManifestError describing the first inconsistency, or
+// a *FormatError if the manifest declares a format version which is not
+// supported.
+func (m *Manifest) Verify(path MountPoint) error {
+	if err := checkFormat(string(path), m.Format); err != nil {
+		return err
+	}
+	var first error
+	err := m.check(string(path), func(e *ManifestError) {
+		if first == nil {
+			first = e
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return first
+}
+
+func (m *Manifest) check(root string, report func(*ManifestError)) error {
+	found := make(map[string]string)
+	if err := walkFiles(root, root, func(name string, hash string) {
+		found[name] = hash
+	}); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(m.Files)+len(found))
+	for name := range m.Files {
+		names = append(names, name)
+	}
+	for name := range found {
+		if _, ok := m.Files[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		want, listed := m.Files[name]
+		got, exists := found[name]
+		switch {
+		case !exists:
+			report(&ManifestError{Path: name, Reason: "file listed in the manifest does not exist"})
+		case !listed:
+			report(&ManifestError{Path: name, Reason: "file is not listed in the manifest"})
+		case want != got:
+			report(&ManifestError{Path: name, Reason: fmt.Sprintf("content hash mismatch, expected %s but found %s", want, got)})
+		}
+	}
+
+	return nil
+}
+
+// add records the hashes of the files at or under path.
+func (m *Manifest) add(root, path string) error {
+	return walkFiles(root, path, func(name, hash string) {
+		m.Files[name] = hash
+	})
+}
+
+// remove deletes the entries of the files at or under path.
+func (m *Manifest) remove(root, path string) error {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+	for name := range m.Files {
+		if name == rel || strings.HasPrefix(name, rel+"/") {
+			delete(m.Files, name)
+		}
+	}
+	return nil
+}
+
+// manifestedFiles is the set of hidden file names which hold data of the
+// database, and therefore are listed in the manifest.
+var manifestedFiles = map[string]bool{
+	metadataFile:      true,
+	stateFile:         true,
+	aliasesFile:       true,
+	prerequisitesFile: true,
+}
+
+// walkFiles calls do with the path relative to root and the content hash of
+// each regular file at or under path, hidden files are skipped unless they are
+// in manifestedFiles.
+func walkFiles(root, path string, do func(name, hash string)) error {
+	// The root may be a symbolic link (e.g. the mount point of versioned
+	// databases), which filepath.Walk does not follow.
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return err
+	}
+	path = filepath.Join(root, rel)
+
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if p != root && isHidden(info.Name()) && !manifestedFiles[info.Name()] {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		hash, err := hashFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		do(filepath.ToSlash(rel), hash)
+		return nil
+	})
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// updateManifest updates the entries of the files at or under the given paths
+// in the manifest of the database, if it has one.
+//
+// Write APIs call this function after modifying the database, while holding
+// the lock of the tier they modified.
+func (path MountPoint) updateManifest(paths ...string) error {
+	root := string(path)
+	file := filepath.Join(root, manifestFile)
+
+	if _, err := os.Lstat(file); os.IsNotExist(err) {
+		return nil
+	}
+
+	return withLock(filepath.Join(root, manifestLockFile), true, func() error {
+		m, err := readManifest(file)
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			if err := m.remove(root, p); err != nil {
+				return err
+			}
+			if err := m.add(root, p); err != nil {
+				return err
+			}
+		}
+		return writeManifest(file, m)
+	})
+}
+
+// update calls do while holding the lock of the tier, then updates the entries
+// of the files at or under path in the manifest of the database.
+func (tier *Tier) update(path string, do func() error) error {
+	return tier.lock(func() error {
+		if err := do(); err != nil {
+			return err
+		}
+		return tier.path.updateManifest(path)
+	})
+}
+
+// verifyManifest verifies the database at path against its manifest, if it
+// has one, and returns the format version that the database declares. When
+// trusted keys are given, the manifest is required and must be signed by one
+// of them before the files are verified against it.
+func verifyManifest(path MountPoint, keys []ed25519.PublicKey) (int, error) {
+	file := filepath.Join(string(path), manifestFile)
+
+	// The manifest is read once so the content that the signature is verified
+	// against is the same as the content that the files are verified against.
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return 0, err
+		}
+		if len(keys) == 0 {
+			return MinFormatVersion, nil
+		}
+		err = &SignatureError{Path: string(path), Reason: "feature database has no manifest"}
+	}
+
+	var m *Manifest
+	if err == nil {
+		m, err = parseManifest(file, b)
+	}
+	if err == nil {
+		// Databases using a newer layout are refused before anything else, so
+		// the error tells the operator which program needs to be upgraded.
+		if err := checkFormat(string(path), m.Format); err != nil {
+			return 0, err
+		}
+		if len(keys) != 0 {
+			err = verifySignature(path, b, keys)
+		}
+		if err == nil {
+			err = m.Verify(path)
+		}
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("verifying manifest of feature database at %s: %w", path, err)
+	}
+	return m.Format, nil
+}
+
+func readManifest(path string) (*Manifest, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseManifest(path, b)
+}
+
+func parseManifest(path string, b []byte) (*Manifest, error) {
+	var err error
+	m := &Manifest{Files: make(map[string]string)}
+	line := 0
+
+	forEachLine(b, func(i, n int) {
+		if line++; err != nil {
+			return
+		}
+		k, v := splitKeyValue(bytes.TrimSpace(b[i : i+n]))
+		switch string(k) {
+		case "format":
+			m.Format, err = strconv.Atoi(string(v))
+		case "created":
+			m.Created, err = time.Parse(time.RFC3339Nano, string(v))
+		case "producer":
+			m.Producer = string(v)
+		case "file":
+			j := bytes.LastIndexByte(v, '\t')
+			if j < 0 {
+				err = fmt.Errorf("malformed file entry: %q", v)
+			} else {
+				m.Files[string(v[:j])] = string(v[j+1:])
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	})
+
+	return m, err
+}
+
+func writeManifest(path string, m *Manifest) error {
+	names := make([]string, 0, len(m.Files))
+	for name := range m.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return writeFile(path, func(f *os.File) error {
+		w := bufio.NewWriter(f)
+		writeKeyValue(w, "format", m.Format)
+		writeKeyValue(w, "created", m.Created.Format(time.RFC3339Nano))
+		writeKeyValue(w, "producer", m.Producer)
+		for _, name := range names {
+			writeKeyValue(w, "file", name+"\t"+m.Files[name])
+		}
+		return w.Flush()
+	})
+}
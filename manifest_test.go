@@ -0,0 +1,192 @@
+package feature_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/segmentio/feature"
+)
+
+func TestManifest(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, feature.MountPoint)
+	}{
+		{
+			scenario: "committing a builder writes the manifest of the database",
+			function: testManifestBuilder,
+		},
+
+		{
+			scenario: "modifying the database in place updates the manifest",
+			function: testManifestUpdate,
+		},
+
+		{
+			scenario: "loading a database with a modified file fails",
+			function: testManifestModified,
+		},
+
+		{
+			scenario: "loading a database with files not listed in the manifest fails",
+			function: testManifestNotListed,
+		},
+
+		{
+			scenario: "loading a database with files missing from the tree fails",
+			function: testManifestMissing,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "feature")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+			path := feature.MountPoint(filepath.Join(tmp, "features"))
+
+			b := newBuilder(t, path)
+			defer b.Abort()
+			b.SetProducer("feature-test")
+			buildGate(t, b, "standard", "1", "family-A", "gate-1", "workspaces", 1.0, []string{"id-1"})
+			commitBuilder(t, b)
+
+			test.function(t, path)
+		})
+	}
+}
+
+func testManifestBuilder(t *testing.T, path feature.MountPoint) {
+	m := readManifest(t, path)
+
+	if m.Format != feature.FormatVersion {
+		t.Errorf("format mismatch: want %d, got %d", feature.FormatVersion, m.Format)
+	}
+	if m.Producer != "feature-test" {
+		t.Errorf("producer mismatch: want feature-test, got %s", m.Producer)
+	}
+	if m.Created.IsZero() {
+		t.Error("creation time is not set")
+	}
+
+	expectManifestFiles(t, m, []string{
+		"standard/1/collections/workspaces",
+		"standard/1/gates/family-A/gate-1/.metadata",
+		"standard/1/gates/family-A/gate-1/workspaces",
+	})
+}
+
+func testManifestUpdate(t *testing.T, path feature.MountPoint) {
+	tier, err := path.OpenTier("standard", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tier.Close()
+
+	col := createCollection(t, tier, "users")
+	populateCollection(t, col, []string{"id-2"})
+	col.Close()
+
+	if err := tier.CreateGate("family-A", "gate-1", "users", 42); err != nil {
+		t.Fatal(err)
+	}
+	if err := tier.EnableGate("family-A", "gate-1", "workspaces", 0.5, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := tier.DeleteCollection("workspaces"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectManifestFiles(t, readManifest(t, path), []string{
+		"standard/1/collections/users",
+		"standard/1/gates/family-A/gate-1/.metadata",
+		"standard/1/gates/family-A/gate-1/users",
+		"standard/1/gates/family-A/gate-1/workspaces",
+	})
+	expectCacheGateOpened(t, path, "family-A", "gate-1", "users", "id-2", false)
+}
+
+func testManifestModified(t *testing.T, path feature.MountPoint) {
+	f := filepath.Join(string(path), "standard", "1", "collections", "workspaces")
+	if err := ioutil.WriteFile(f, []byte("id-1\nid-2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectManifestError(t, path, "standard/1/collections/workspaces")
+}
+
+func testManifestNotListed(t *testing.T, path feature.MountPoint) {
+	f := filepath.Join(string(path), "standard", "1", "collections", "users")
+	if err := ioutil.WriteFile(f, []byte("id-1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectManifestError(t, path, "standard/1/collections/users")
+}
+
+func testManifestMissing(t *testing.T, path feature.MountPoint) {
+	if err := os.RemoveAll(filepath.Join(string(path), "standard", "1", "gates")); err != nil {
+		t.Fatal(err)
+	}
+	expectManifestError(t, path, "standard/1/gates/family-A/gate-1/.metadata")
+}
+
+// refreshManifest rewrites the manifest of the database at path, for tests
+// which modify its files without using the package.
+func refreshManifest(t testing.TB, path feature.MountPoint) {
+	t.Helper()
+
+	if _, err := path.WriteManifest(""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readManifest(t testing.TB, path feature.MountPoint) *feature.Manifest {
+	t.Helper()
+
+	m, err := path.ReadManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func expectManifestFiles(t testing.TB, m *feature.Manifest, files []string) {
+	t.Helper()
+
+	found := make([]string, 0, len(m.Files))
+	for name := range m.Files {
+		found = append(found, name)
+	}
+	sort.Strings(found)
+
+	if !reflect.DeepEqual(found, files) {
+		t.Error("manifest files mismatch")
+		t.Logf("want: %q", files)
+		t.Logf("got:  %q", found)
+	}
+}
+
+func expectManifestError(t testing.TB, path feature.MountPoint, file string) {
+	t.Helper()
+
+	c, err := path.Load()
+	if err == nil {
+		c.Close()
+		t.Fatal("loading the database did not fail")
+	}
+
+	manifestErr := new(feature.ManifestError)
+	if !errors.As(err, &manifestErr) {
+		t.Fatalf("expected a manifest error, got %v", err)
+	}
+	if manifestErr.Path != file {
+		t.Errorf("path mismatch: want %s, got %s", file, manifestErr.Path)
+	}
+}
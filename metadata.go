@@ -0,0 +1,265 @@
+package feature
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// metadataFile is the name of the file holding the metadata of a gate, in the
+// gate directory.
+const metadataFile = ".metadata"
+
+// GateMetadata carries information describing a gate, which is not used to
+// evaluate the gate but helps operators understand why it exists.
+//
+// The metadata are stored in a hidden file of the gate directory, so they are
+// shared by all the collections that the gate applies to in a tier.
+type GateMetadata struct {
+	// A human-readable description of the purpose of the gate.
+	Description string
+
+	// The team or person owning the gate.
+	Owner string
+
+	// Tags used to search and group gates, sorted and deduplicated.
+	Tags []string
+
+	// A link to the ticket or document tracking the gate.
+	Link string
+
+	// The time at which the gate was created, set by CreateGate.
+	Created time.Time
+
+	// The time after which the gate is expected to be removed, zero if the
+	// gate does not expire.
+	Expires time.Time
+
+	// The time at which the gate was opened for all the ids of all its
+	// collections, recorded by EnableGate and cleared when the volume of one
+	// of its collections is lowered. Zero if the gate is not fully rolled out.
+	RolledOut time.Time
+
+	// Lines of the metadata file which are not interpreted by the package,
+	// preserved when the metadata are rewritten.
+	lines []gateLine
+}
+
+// HasTag returns true if the metadata contain the given tag.
+func (m *GateMetadata) HasTag(tag string) bool {
+	i := sort.SearchStrings(m.Tags, tag)
+	return i < len(m.Tags) && m.Tags[i] == tag
+}
+
+// IsZero returns true if none of the metadata are set.
+func (m *GateMetadata) IsZero() bool {
+	return m.Description == "" && m.Owner == "" && len(m.Tags) == 0 && m.Link == "" && m.Created.IsZero() && m.Expires.IsZero() && m.RolledOut.IsZero()
+}
+
+// Expired returns true if the gate has an expiry time which is not after now.
+func (m *GateMetadata) Expired(now time.Time) bool {
+	return !m.Expires.IsZero() && !m.Expires.After(now)
+}
+
+func (m *GateMetadata) setTags(tags []string) {
+	list := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			list = append(list, tag)
+		}
+	}
+	if len(list) == 0 {
+		m.Tags = nil
+		return
+	}
+	sort.Strings(list)
+	m.Tags = deduplicate(list)
+}
+
+// ReadGateMetadata returns the metadata of a gate. If the metadata were never
+// written, the returned value is zero.
+func (tier *Tier) ReadGateMetadata(family, name string) (GateMetadata, error) {
+	if err := validateFamilyGateNames(family, name); err != nil {
+		return GateMetadata{}, err
+	}
+	return readMetadata(tier.metadataPath(family, name))
+}
+
+// WriteGateMetadata replaces the metadata of a gate, which must have been
+// created in the tier. The creation and rollout times are retained if the
+// Created and RolledOut fields are zero. Line breaks are not allowed in the metadata, and tags must not contain
+// commas.
+func (tier *Tier) WriteGateMetadata(family, name string, metadata GateMetadata) error {
+	if err := validateFamilyGateNames(family, name); err != nil {
+		return err
+	}
+	if err := validateMetadata(metadata); err != nil {
+		return err
+	}
+	path := tier.metadataPath(family, name)
+	return tier.update(path, func() error {
+		if _, err := os.Stat(tier.gatePath(family, name)); err != nil {
+			return err
+		}
+		// Lines of the current file that are not interpreted by the package
+		// are retained, since the program may not have read them.
+		prev, err := readMetadata(path)
+		if err != nil {
+			return err
+		}
+		if metadata.Created.IsZero() {
+			metadata.Created = prev.Created
+		}
+		if metadata.RolledOut.IsZero() {
+			metadata.RolledOut = prev.RolledOut
+		}
+		metadata.setTags(metadata.Tags)
+		metadata.lines = prev.lines
+		return writeMetadata(path, metadata)
+	})
+}
+
+func (tier *Tier) metadataPath(family, name string) string {
+	return filepath.Join(tier.gatePath(family, name), metadataFile)
+}
+
+func validateMetadata(m GateMetadata) error {
+	for _, f := range []struct {
+		key   string
+		value string
+	}{
+		{"description", m.Description},
+		{"owner", m.Owner},
+		{"link", m.Link},
+		{"tags", strings.Join(m.Tags, "")},
+	} {
+		if strings.ContainsAny(f.value, "\r\n") {
+			return fmt.Errorf("invalid gate metadata: %s must not contain line breaks", f.key)
+		}
+	}
+	for _, tag := range m.Tags {
+		if strings.Contains(tag, ",") {
+			return fmt.Errorf("invalid gate metadata: tag %q must not contain commas", tag)
+		}
+	}
+	return nil
+}
+
+func isMetadataKey(key string) bool {
+	switch key {
+	case "description", "owner", "tags", "link", "created", "expires", "rolled-out":
+		return true
+	default:
+		return false
+	}
+}
+
+func readMetadata(path string) (GateMetadata, error) {
+	var m GateMetadata
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return m, err
+	}
+
+	line := 0
+	forEachLine(b, func(i, n int) {
+		if line++; err != nil {
+			return
+		}
+		s := bytes.TrimSpace(b[i : i+n])
+		switch {
+		case len(s) == 0:
+			return
+		case s[0] == '#':
+			m.lines = append(m.lines, gateLine{value: string(s)})
+			return
+		}
+		k, v := splitKeyValue(s)
+		switch string(k) {
+		case "description":
+			m.Description = string(v)
+		case "owner":
+			m.Owner = string(v)
+		case "tags":
+			m.setTags(strings.Split(string(v), ","))
+		case "link":
+			m.Link = string(v)
+		case "created":
+			if m.Created, err = time.Parse(time.RFC3339, string(v)); err != nil {
+				err = fmt.Errorf("%s:%d: invalid creation time: %q", path, line, v)
+			}
+		case "expires":
+			if m.Expires, err = time.Parse(time.RFC3339, string(v)); err != nil {
+				err = fmt.Errorf("%s:%d: invalid expiry time: %q", path, line, v)
+			}
+		case "rolled-out":
+			if m.RolledOut, err = time.Parse(time.RFC3339, string(v)); err != nil {
+				err = fmt.Errorf("%s:%d: invalid rollout time: %q", path, line, v)
+			}
+		default:
+			m.lines = append(m.lines, gateLine{key: string(k), value: string(v)})
+			return
+		}
+		m.lines = append(m.lines, gateLine{key: string(k)})
+	})
+
+	return m, err
+}
+
+func writeMetadata(path string, m GateMetadata) error {
+	b := new(bytes.Buffer)
+
+	values := map[string]string{
+		"description": m.Description,
+		"owner":       m.Owner,
+		"tags":        strings.Join(m.Tags, ","),
+		"link":        m.Link,
+	}
+	if !m.Created.IsZero() {
+		values["created"] = m.Created.UTC().Format(time.RFC3339)
+	}
+	if !m.Expires.IsZero() {
+		values["expires"] = m.Expires.UTC().Format(time.RFC3339)
+	}
+	if !m.RolledOut.IsZero() {
+		values["rolled-out"] = m.RolledOut.UTC().Format(time.RFC3339)
+	}
+
+	write := func(key string) {
+		if v, ok := values[key]; ok {
+			if v != "" {
+				writeKeyValue(b, key, v)
+			}
+			delete(values, key)
+		}
+	}
+
+	for _, line := range m.lines {
+		switch {
+		case line.key == "":
+			fmt.Fprintf(b, "%s\n", line.value)
+		case isMetadataKey(line.key):
+			write(line.key)
+		default:
+			writeKeyValue(b, line.key, line.value)
+		}
+	}
+
+	for _, key := range [...]string{"description", "owner", "tags", "link", "created", "expires", "rolled-out"} {
+		write(key)
+	}
+
+	return writeFile(path, func(f *os.File) error {
+		_, err := b.WriteTo(f)
+		return err
+	})
+}
@@ -0,0 +1,208 @@
+package feature_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/feature"
+)
+
+func TestGateMetadata(t *testing.T) {
+	tests := []gateTest{
+		{
+			scenario: "creating a gate records its creation time",
+			function: testGateMetadataCreated,
+		},
+
+		{
+			scenario: "metadata written to a tier are exposed by the tier and the cache",
+			function: testGateMetadataReadWrite,
+		},
+
+		{
+			scenario: "unknown keys of the metadata file are preserved",
+			function: testGateMetadataPreserve,
+		},
+
+		{
+			scenario: "gates past their expiry time are reported by the cache",
+			function: testGateMetadataExpired,
+		},
+
+		{
+			scenario: "metadata of gates which do not exist cannot be written",
+			function: testGateMetadataNotExist,
+		},
+	}
+
+	runGateTests(t, tests, func(t testing.TB, path feature.MountPoint, tier *feature.Tier) {
+		createGate(t, tier, "family-A", "gate-1", "workspaces", 1234)
+	})
+}
+
+func testGateMetadataCreated(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	m := readGateMetadata(t, tier, "family-A", "gate-1")
+
+	if m.Created.IsZero() || time.Since(m.Created) > time.Minute {
+		t.Errorf("invalid creation time: %s", m.Created)
+	}
+
+	if err := tier.CreateGate("family-A", "gate-1", "users", 1234); err != nil {
+		t.Fatal(err)
+	}
+	if created := readGateMetadata(t, tier, "family-A", "gate-1").Created; !created.Equal(m.Created) {
+		t.Errorf("creation time changed: want %s, got %s", m.Created, created)
+	}
+}
+
+func testGateMetadataReadWrite(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	created := readGateMetadata(t, tier, "family-A", "gate-1").Created
+
+	if err := tier.WriteGateMetadata("family-A", "gate-1", feature.GateMetadata{
+		Description: "Discards observability events",
+		Owner:       "integrations",
+		Tags:        []string{"observability", "kill-switch", "observability"},
+		Link:        "https://example.com/tickets/42",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := feature.GateMetadata{
+		Description: "Discards observability events",
+		Owner:       "integrations",
+		Tags:        []string{"kill-switch", "observability"},
+		Link:        "https://example.com/tickets/42",
+		Created:     created,
+	}
+
+	expectGateMetadata(t, readGateMetadata(t, tier, "family-A", "gate-1"), want)
+
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	m, ok := c.GateMetadata("family-A", "gate-1")
+	if !ok {
+		t.Fatal("the cache has no metadata for the gate")
+	}
+	expectGateMetadata(t, m, want)
+
+	if !m.HasTag("kill-switch") || m.HasTag("kill") {
+		t.Errorf("tags mismatch: %q", m.Tags)
+	}
+
+	if _, ok := c.GateMetadata("family-A", "gate-2"); ok {
+		t.Error("the cache has metadata for a gate which does not exist")
+	}
+}
+
+func testGateMetadataPreserve(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	file := filepath.Join(string(path), "standard", "1", "gates", "family-A", "gate-1", ".metadata")
+	if err := ioutil.WriteFile(file, []byte("# reviewed\nowner\tgrowth\nslack\t#growth\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := readGateMetadata(t, tier, "family-A", "gate-1")
+	m.Owner = "integrations"
+	if err := tier.WriteGateMetadata("family-A", "gate-1", m); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# reviewed\nowner\tintegrations\nslack\t#growth\n"; string(b) != want {
+		t.Error("metadata file mismatch")
+		t.Logf("want: %q", want)
+		t.Logf("got:  %q", b)
+	}
+}
+
+func testGateMetadataExpired(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	if err := tier.CreateGate("family-A", "gate-2", "workspaces", 1234); err != nil {
+		t.Fatal(err)
+	}
+	if err := tier.CreateGate("family-B", "gate-3", "workspaces", 1234); err != nil {
+		t.Fatal(err)
+	}
+
+	expires := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, gate := range []struct {
+		family  string
+		name    string
+		expires time.Time
+	}{
+		{"family-A", "gate-1", expires},
+		{"family-A", "gate-2", time.Now().Add(time.Hour)},
+		{"family-B", "gate-3", expires},
+	} {
+		if err := tier.WriteGateMetadata(gate.family, gate.name, feature.GateMetadata{Expires: gate.expires}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if m := readGateMetadata(t, tier, "family-A", "gate-1"); !m.Expires.Equal(expires) || m.Created.IsZero() {
+		t.Errorf("invalid metadata: %+v", m)
+	}
+
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if !c.GateExpired("family-A", "gate-1") {
+		t.Error("family-A/gate-1 is not expired")
+	}
+	if c.GateExpired("family-A", "gate-2") {
+		t.Error("family-A/gate-2 is expired")
+	}
+	if gates := c.ExpiredGates(); !reflect.DeepEqual(gates, []string{"family-A/gate-1", "family-B/gate-3"}) {
+		t.Errorf("expired gates mismatch: %q", gates)
+	}
+}
+
+func testGateMetadataNotExist(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	err := tier.WriteGateMetadata("family-A", "gate-2", feature.GateMetadata{Owner: "growth"})
+	if !os.IsNotExist(err) {
+		t.Errorf("expected an error indicating that the gate does not exist, got %v", err)
+	}
+
+	err = tier.WriteGateMetadata("family-A", "gate-1", feature.GateMetadata{Description: "line\nbreak"})
+	if err == nil {
+		t.Error("writing metadata with line breaks did not fail")
+	}
+}
+
+func readGateMetadata(t testing.TB, tier *feature.Tier, family, gate string) feature.GateMetadata {
+	t.Helper()
+
+	m, err := tier.ReadGateMetadata(family, gate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func expectGateMetadata(t testing.TB, found, want feature.GateMetadata) {
+	t.Helper()
+
+	if found.Description != want.Description ||
+		found.Owner != want.Owner ||
+		found.Link != want.Link ||
+		!found.Created.Equal(want.Created) ||
+		!found.Expires.Equal(want.Expires) ||
+		!reflect.DeepEqual(found.Tags, want.Tags) {
+		t.Error("metadata mismatch")
+		t.Logf("want: %+v", want)
+		t.Logf("got:  %+v", found)
+	}
+}
@@ -0,0 +1,85 @@
+package feature
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxNameLength is the maximum length in bytes of the names of groups, tiers,
+// families, gates, and collections.
+const MaxNameLength = 128
+
+// NameError is returned by APIs of the package when a group, tier, family,
+// gate, or collection name is invalid.
+type NameError struct {
+	// The component that the name was given to (e.g. "group", "tier", ...).
+	Kind string
+
+	// The invalid name.
+	Name string
+
+	// A description of the reason why the name is invalid.
+	Reason string
+}
+
+// Error satisfies the error interface.
+func (e *NameError) Error() string {
+	return fmt.Sprintf("invalid %s name %q: %s", e.Kind, e.Name, e.Reason)
+}
+
+// ValidateName returns a *NameError if name is not a valid name for the kind
+// of component (which is only used in the error message).
+//
+// Names are used as file names in the feature database, the grammar ensures
+// that they always designate a single entry of the directory they belong to:
+// valid names are non-empty UTF-8 strings of at most MaxNameLength bytes,
+// which contain no path separators or control characters, and do not start
+// with a dot (hidden names are reserved for internal files, which also rules
+// out the "." and ".." segments).
+func ValidateName(kind, name string) error {
+	reason := ""
+
+	switch {
+	case name == "":
+		reason = "name is empty"
+	case len(name) > MaxNameLength:
+		reason = fmt.Sprintf("name is longer than %d bytes", MaxNameLength)
+	case name == "." || name == "..":
+		reason = "name is a dot segment"
+	case strings.ContainsAny(name, `/\`):
+		reason = "name contains a path separator"
+	case strings.HasPrefix(name, "."):
+		reason = "name starts with a dot, which is reserved for hidden files"
+	case !utf8.ValidString(name):
+		reason = "name is not valid UTF-8"
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		reason = "name contains control characters"
+	default:
+		return nil
+	}
+
+	return &NameError{Kind: kind, Name: name, Reason: reason}
+}
+
+func validateTierNames(group, tier string) error {
+	if err := ValidateName("group", group); err != nil {
+		return err
+	}
+	return ValidateName("tier", tier)
+}
+
+func validateGateNames(family, gate, collection string) error {
+	if err := validateFamilyGateNames(family, gate); err != nil {
+		return err
+	}
+	return ValidateName("collection", collection)
+}
+
+func validateFamilyGateNames(family, gate string) error {
+	if err := ValidateName("family", family); err != nil {
+		return err
+	}
+	return ValidateName("gate", gate)
+}
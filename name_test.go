@@ -0,0 +1,138 @@
+package feature_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/feature"
+)
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{name: "standard", valid: true},
+		{name: "destinations-54521fdc25e721e32a72ef04", valid: true},
+		{name: "gate_1:v2", valid: true},
+		{name: "über", valid: true},
+		{name: strings.Repeat("x", feature.MaxNameLength), valid: true},
+
+		{name: ""},
+		{name: "."},
+		{name: ".."},
+		{name: ".hidden"},
+		{name: "a/b"},
+		{name: "../../etc"},
+		{name: `a\b`},
+		{name: "a\nb"},
+		{name: "a\x00b"},
+		{name: "\xff"},
+		{name: strings.Repeat("x", feature.MaxNameLength+1)},
+	}
+
+	for _, test := range tests {
+		err := feature.ValidateName("gate", test.name)
+
+		if test.valid {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+
+		nameErr := new(feature.NameError)
+		if !errors.As(err, &nameErr) {
+			t.Errorf("%q: expected a name error, got %v", test.name, err)
+			continue
+		}
+		if nameErr.Kind != "gate" || nameErr.Name != test.name {
+			t.Errorf("%q: name error mismatch: %+v", test.name, nameErr)
+		}
+	}
+}
+
+func TestWriteInvalidNames(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	path := feature.MountPoint(filepath.Join(tmp, "db"))
+
+	if err := os.Mkdir(string(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tier, err := path.CreateTier("standard", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tier.Close()
+
+	if err := ioutil.WriteFile(filepath.Join(tmp, "etc"), []byte("do not delete\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		scenario string
+		kind     string
+		function func() error
+	}{
+		{
+			scenario: "creating a tier in a group with a dot segment",
+			kind:     "group",
+			function: func() error { _, err := path.CreateTier("..", "1"); return err },
+		},
+
+		{
+			scenario: "deleting a tier with a path separator",
+			kind:     "tier",
+			function: func() error { return path.DeleteTier("standard", "../..") },
+		},
+
+		{
+			scenario: "creating a collection with a path separator",
+			kind:     "collection",
+			function: func() error { _, err := tier.CreateCollection("a/b"); return err },
+		},
+
+		{
+			scenario: "creating a gate in a family escaping the tier",
+			kind:     "family",
+			function: func() error { return tier.CreateGate("../../../..", "etc", "workspaces", 0) },
+		},
+
+		{
+			scenario: "deleting a hidden gate",
+			kind:     "gate",
+			function: func() error { return tier.DeleteGate("family-A", ".lock", "workspaces") },
+		},
+
+		{
+			scenario: "enabling a gate with a control character in the collection",
+			kind:     "collection",
+			function: func() error { return tier.EnableGate("family-A", "gate-1", "work\tspaces", 1, true) },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			nameErr := new(feature.NameError)
+			if err := test.function(); !errors.As(err, &nameErr) {
+				t.Fatalf("expected a name error, got %v", err)
+			}
+			if nameErr.Kind != test.kind {
+				t.Errorf("kind mismatch: want %s, got %s", test.kind, nameErr.Kind)
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(tmp, "etc")); err != nil {
+		t.Error(err)
+	}
+}
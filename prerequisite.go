@@ -0,0 +1,289 @@
+package feature
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// prerequisitesFile is the name of the file listing the prerequisites of a
+// gate, in the gate directory.
+const prerequisitesFile = ".prerequisites"
+
+// ReadGatePrerequisites returns the sorted list of prerequisites of a gate, in
+// the "family/gate" form.
+func (tier *Tier) ReadGatePrerequisites(family, name string) ([]string, error) {
+	if err := validateFamilyGateNames(family, name); err != nil {
+		return nil, err
+	}
+	prerequisites, err := readPrerequisites(tier.prerequisitesPath(family, name))
+	if err != nil {
+		return nil, err
+	}
+	return formatGateNames(prerequisites), nil
+}
+
+// SetGatePrerequisites replaces the prerequisites of a gate, which must have
+// been created in the tier. Prerequisites are gates, possibly of other
+// families, in the "family/gate" form. A gate is only open for an id if all its
+// prerequisites are open for the same collection and id.
+//
+// The method fails if the prerequisites would form a cycle with those of the
+// gates of any tier of the database, after resolving aliases like Load does.
+// An empty list removes the prerequisites of the gate.
+func (tier *Tier) SetGatePrerequisites(family, name string, prerequisites []string) error {
+	if err := validateFamilyGateNames(family, name); err != nil {
+		return err
+	}
+	list := make([]gateName, 0, len(prerequisites))
+	for _, p := range prerequisites {
+		f, g, err := splitGateName(p)
+		if err != nil {
+			return err
+		}
+		list = append(list, gateName{f, g})
+	}
+	list = sortGateNames(list)
+
+	path := tier.prerequisitesPath(family, name)
+	return tier.update(path, func() error {
+		if _, err := os.Stat(tier.gatePath(family, name)); err != nil {
+			return err
+		}
+		graph, err := tier.path.prerequisites(tier, gateName{family, name}, list)
+		if err != nil {
+			return err
+		}
+		if cycle := findCycle(graph); cycle != nil {
+			return cycle
+		}
+		if len(list) == 0 {
+			return unlink(path)
+		}
+		return writeFile(path, func(f *os.File) error {
+			for _, p := range list {
+				if _, err := fmt.Fprintf(f, "%s/%s\n", p.family, p.gate); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func (tier *Tier) prerequisitesPath(family, name string) string {
+	return filepath.Join(tier.gatePath(family, name), prerequisitesFile)
+}
+
+// prerequisites returns the graph of prerequisites of the gates of the tier.
+func (tier *Tier) prerequisites() (map[gateName][]gateName, error) {
+	graph := make(map[gateName][]gateName)
+
+	err := Scan(tier.Families(), func(family string) error {
+		return Scan(tier.Gates(family), func(gate string) error {
+			list, err := readPrerequisites(tier.prerequisitesPath(family, gate))
+			if len(list) != 0 {
+				graph[gateName{family, gate}] = list
+			}
+			return err
+		})
+	})
+
+	return graph, err
+}
+
+// prerequisites returns the graph of prerequisites of the gates of all the
+// tiers of the database, where the prerequisites of the gate name in tier t
+// are replaced by list. Prerequisites apply to a gate in all tiers, so the
+// edges of the graph are the union of the prerequisites found in each tier,
+// and aliases are resolved to the gates they target.
+func (path MountPoint) prerequisites(t *Tier, name gateName, list []gateName) (map[gateName][]gateName, error) {
+	graph := make(map[gateName][]gateName)
+	aliases := make(map[gateName]gateName)
+	gates := make(map[gateName]bool)
+
+	err := Scan(path.Groups(), func(group string) error {
+		return Scan(path.Tiers(group), func(tier string) error {
+			other, err := path.OpenTier(group, tier)
+			if err != nil {
+				return err
+			}
+			defer other.Close()
+
+			a, err := other.ReadAliases()
+			if err != nil {
+				return err
+			}
+			for _, alias := range a {
+				if _, ok := aliases[gateName{alias.Family, alias.Gate}]; !ok {
+					aliases[gateName{alias.Family, alias.Gate}] = gateName{alias.TargetFamily, alias.TargetGate}
+				}
+			}
+
+			if err := Scan(other.Families(), func(family string) error {
+				return Scan(other.Gates(family), func(gate string) error {
+					gates[gateName{family, gate}] = true
+					return nil
+				})
+			}); err != nil {
+				return err
+			}
+
+			g, err := other.prerequisites()
+			if err != nil {
+				return err
+			}
+			if group == t.group && tier == t.name {
+				g[name] = list
+			}
+			for gate, prerequisites := range g {
+				graph[gate] = append(graph[gate], prerequisites...)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Like in Load, aliases are ignored when the gate exists under their name.
+	resolve := func(name gateName) gateName {
+		if target, ok := aliases[name]; ok && !gates[name] {
+			return target
+		}
+		return name
+	}
+
+	resolved := make(map[gateName][]gateName, len(graph))
+	for gate, prerequisites := range graph {
+		gate = resolve(gate)
+		for _, p := range prerequisites {
+			resolved[gate] = append(resolved[gate], resolve(p))
+		}
+	}
+	return resolved, nil
+}
+
+// PrerequisiteCycleError is returned when the prerequisites of gates form a
+// cycle, in which case none of the gates of the cycle could ever be open.
+type PrerequisiteCycleError struct {
+	// The gates forming the cycle, in the "family/gate" form. The first gate
+	// is repeated at the end of the list.
+	Gates []string
+}
+
+// Error satisfies the error interface.
+func (e *PrerequisiteCycleError) Error() string {
+	return "prerequisite cycle: " + strings.Join(e.Gates, " -> ")
+}
+
+// findCycle returns a *PrerequisiteCycleError describing a cycle of the graph,
+// or nil if the graph has none. Gates are visited in sorted order so the same
+// cycle is always reported for a given graph.
+func findCycle(graph map[gateName][]gateName) *PrerequisiteCycleError {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	names := make([]gateName, 0, len(graph))
+	for name := range graph {
+		names = append(names, name)
+	}
+	names = sortGateNames(names)
+
+	state := make(map[gateName]int, len(graph))
+	stack := make([]gateName, 0, 8)
+
+	var visit func(gateName) []gateName
+	visit = func(name gateName) []gateName {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i := range stack {
+				if stack[i] == name {
+					return append(stack[i:len(stack):len(stack)], name)
+				}
+			}
+		}
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, next := range graph[name] {
+			if cycle := visit(next); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, name := range names {
+		if cycle := visit(name); cycle != nil {
+			return &PrerequisiteCycleError{Gates: formatGateNames(cycle)}
+		}
+	}
+	return nil
+}
+
+func formatGateNames(names []gateName) []string {
+	list := make([]string, len(names))
+	for i, name := range names {
+		list[i] = name.family + "/" + name.gate
+	}
+	return list
+}
+
+func sortGateNames(names []gateName) []gateName {
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].family != names[j].family {
+			return names[i].family < names[j].family
+		}
+		return names[i].gate < names[j].gate
+	})
+	n := 0
+	for i := range names {
+		if i == 0 || names[i] != names[n-1] {
+			names[n] = names[i]
+			n++
+		}
+	}
+	return names[:n]
+}
+
+// readPrerequisites reads the prerequisites file at path, which lists one gate
+// per line in the "family/gate" form.
+func readPrerequisites(path string) ([]gateName, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return nil, err
+	}
+
+	list := make([]gateName, 0, 4)
+	line := 0
+	forEachLine(b, func(i, n int) {
+		if line++; err != nil {
+			return
+		}
+		s := bytes.TrimSpace(b[i : i+n])
+		if len(s) == 0 || s[0] == '#' {
+			return
+		}
+		f, g, e := splitGateName(string(s))
+		if e != nil {
+			err = fmt.Errorf("%s:%d: %w", path, line, e)
+			return
+		}
+		list = append(list, gateName{f, g})
+	})
+
+	return sortGateNames(list), err
+}
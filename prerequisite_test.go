@@ -0,0 +1,202 @@
+package feature_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/feature"
+)
+
+func TestGatePrerequisites(t *testing.T) {
+	tests := []gateTest{
+		{
+			scenario: "prerequisites written to a tier can be read back",
+			function: testGatePrerequisitesReadWrite,
+		},
+
+		{
+			scenario: "gates are closed when one of their prerequisites is closed",
+			function: testGatePrerequisitesEvaluate,
+		},
+
+		{
+			scenario: "prerequisites forming a cycle in a tier are rejected",
+			function: testGatePrerequisitesCycle,
+		},
+
+		{
+			scenario: "prerequisites forming a cycle across tiers are rejected",
+			function: testGatePrerequisitesCycleAcrossTiers,
+		},
+
+		{
+			scenario: "explanations report the prerequisite which closed the gate",
+			function: testGatePrerequisitesExplain,
+		},
+	}
+
+	runGateTests(t, tests, func(t testing.TB, path feature.MountPoint, tier *feature.Tier) {
+		populateCollection(t, createCollection(t, tier, "workspaces"), []string{"id-1", "id-2"})
+		createGate(t, tier, "family-A", "gate-1", "workspaces", 1234)
+		createGate(t, tier, "family-A", "gate-2", "workspaces", 1234)
+		createGate(t, tier, "family-B", "gate-1", "workspaces", 1234)
+		enableGate(t, tier, "family-A", "gate-1", "workspaces", 1, false)
+		enableGate(t, tier, "family-A", "gate-2", "workspaces", 1, false)
+		enableGate(t, tier, "family-B", "gate-1", "workspaces", 1, false)
+	})
+}
+
+func testGatePrerequisitesReadWrite(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	expectPrerequisites(t, tier, "family-A", "gate-1", nil)
+	setPrerequisites(t, tier, "family-A", "gate-1", "family-B/gate-1", "family-A/gate-2", "family-B/gate-1")
+	expectPrerequisites(t, tier, "family-A", "gate-1", []string{"family-A/gate-2", "family-B/gate-1"})
+
+	setPrerequisites(t, tier, "family-A", "gate-1")
+	expectPrerequisites(t, tier, "family-A", "gate-1", nil)
+
+	if err := tier.SetGatePrerequisites("family-A", "gate-3", []string{"family-A/gate-1"}); !os.IsNotExist(err) {
+		t.Errorf("expected an error indicating that the gate does not exist, got %v", err)
+	}
+	if err := tier.SetGatePrerequisites("family-A", "gate-1", []string{"gate-2"}); err == nil {
+		t.Error("setting a malformed prerequisite did not fail")
+	}
+
+	expectProblems(t, string(path), validate(t, path), nil)
+}
+
+func testGatePrerequisitesEvaluate(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	setPrerequisites(t, tier, "family-A", "gate-1", "family-B/gate-1")
+	setPrerequisites(t, tier, "family-B", "gate-1", "family-A/gate-2")
+	enableGate(t, tier, "family-A", "gate-2", "workspaces", 0, false)
+
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"id-1", "id-2"} {
+		expectGateIsEnabled(t, c, "family-A", "gate-1", "workspaces", id, false)
+		expectGateIsEnabled(t, c, "family-A", "gate-2", "workspaces", id, false)
+		expectGateIsEnabled(t, c, "family-B", "gate-1", "workspaces", id, false)
+		expectGateLookup(t, c, "family-A", "workspaces", id, nil)
+		expectGateLookup(t, c, "family-B", "workspaces", id, nil)
+	}
+	c.Close()
+
+	enableGate(t, tier, "family-A", "gate-2", "workspaces", 1, false)
+
+	if c, err = path.Load(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, id := range []string{"id-1", "id-2"} {
+		expectGateIsEnabled(t, c, "family-A", "gate-1", "workspaces", id, true)
+		expectGateLookup(t, c, "family-A", "workspaces", id, []string{"gate-1", "gate-2"})
+		expectGateLookup(t, c, "family-B", "workspaces", id, []string{"gate-1"})
+	}
+}
+
+func testGatePrerequisitesCycle(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	setPrerequisites(t, tier, "family-A", "gate-1", "family-A/gate-2")
+	setPrerequisites(t, tier, "family-A", "gate-2", "family-B/gate-1")
+
+	err := tier.SetGatePrerequisites("family-B", "gate-1", []string{"family-A/gate-1"})
+	expectPrerequisiteCycle(t, err, []string{"family-A/gate-1", "family-A/gate-2", "family-B/gate-1", "family-A/gate-1"})
+	expectPrerequisites(t, tier, "family-B", "gate-1", nil)
+}
+
+func testGatePrerequisitesCycleAcrossTiers(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	setPrerequisites(t, tier, "family-A", "gate-1", "family-A/gate-2")
+
+	other := createTier(t, path, "standard", "2")
+	defer other.Close()
+	createGate(t, other, "family-A", "gate-2", "workspaces", 1234)
+
+	err := other.SetGatePrerequisites("family-A", "gate-2", []string{"family-A/gate-1"})
+	expectPrerequisiteCycle(t, err, []string{"family-A/gate-1", "family-A/gate-2", "family-A/gate-1"})
+	expectPrerequisites(t, other, "family-A", "gate-2", nil)
+
+	// Aliases are resolved to the gates they target.
+	if err := other.CreateAlias("family-A", "gate-3", "family-A", "gate-1"); err != nil {
+		t.Fatal(err)
+	}
+	err = other.SetGatePrerequisites("family-A", "gate-2", []string{"family-A/gate-3"})
+	expectPrerequisiteCycle(t, err, []string{"family-A/gate-1", "family-A/gate-2", "family-A/gate-1"})
+
+	// Cycles written without the package still fail loading the cache.
+	file := filepath.Join(string(path), "standard", "2", "gates", "family-A", "gate-2", ".prerequisites")
+	if err := ioutil.WriteFile(file, []byte("family-A/gate-1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	refreshManifest(t, path)
+	c, err := path.Load()
+	if err == nil {
+		c.Close()
+	}
+	expectPrerequisiteCycle(t, err, []string{"family-A/gate-1", "family-A/gate-2", "family-A/gate-1"})
+}
+
+func testGatePrerequisitesExplain(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	setPrerequisites(t, tier, "family-A", "gate-1", "family-B/gate-1")
+	enableGate(t, tier, "family-B", "gate-1", "workspaces", 0, false)
+
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	e := c.Explain("family-A", "gate-1", "workspaces", "id-1")
+	if e.Open || e.Prerequisite != "family-B/gate-1" || e.Group != "standard" || e.Tier != "1" {
+		t.Errorf("explanation mismatch: %+v", e)
+	}
+
+	e = c.Explain("family-A", "gate-2", "workspaces", "id-1")
+	if !e.Open || e.Prerequisite != "" {
+		t.Errorf("explanation mismatch: %+v", e)
+	}
+}
+
+func setPrerequisites(t testing.TB, tier *feature.Tier, family, gate string, prerequisites ...string) {
+	t.Helper()
+
+	if err := tier.SetGatePrerequisites(family, gate, prerequisites); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectPrerequisites(t testing.TB, tier *feature.Tier, family, gate string, want []string) {
+	t.Helper()
+
+	found, err := tier.ReadGatePrerequisites(family, gate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Error("prerequisites mismatch")
+		t.Logf("want: %q", want)
+		t.Logf("got:  %q", found)
+	}
+}
+
+func expectPrerequisiteCycle(t testing.TB, err error, gates []string) {
+	t.Helper()
+
+	var cycle *feature.PrerequisiteCycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("expected a *feature.PrerequisiteCycleError, got %v", err)
+	}
+	if !reflect.DeepEqual(cycle.Gates, gates) {
+		t.Error("prerequisite cycle mismatch")
+		t.Logf("want: %q", gates)
+		t.Logf("got:  %q", cycle.Gates)
+	}
+}
@@ -0,0 +1,211 @@
+package feature
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ramp is a schedule progressively changing the volume of a gate over time,
+// which allows rolling out gates without having to enable them repeatedly.
+//
+// Before the first step of the ramp, the gate has the volume it was enabled
+// with. Then the volume of the gate is the volume of the last step that was
+// reached, or when the ramp is linear, the volume interpolated between the
+// surrounding steps.
+//
+// Because the volume of a gate admits ids in the same order for a given salt,
+// ids admitted at one step of a ramp remain admitted at the next steps as long
+// as the volume does not decrease.
+type Ramp struct {
+	Linear bool
+	Steps  []RampStep
+}
+
+// RampStep is a point of a ramp, setting the volume of a gate at a given time.
+type RampStep struct {
+	Time   time.Time
+	Volume float64
+}
+
+// IsZero returns true if the ramp has no steps.
+func (r Ramp) IsZero() bool {
+	return len(r.Steps) == 0
+}
+
+// String returns the representation of the ramp in gate files, which is the
+// interpolation mode ("steps" or "linear") followed by the list of steps in
+// the "volume@time" form.
+func (r Ramp) String() string {
+	s := new(strings.Builder)
+	if r.Linear {
+		s.WriteString("linear")
+	} else {
+		s.WriteString("steps")
+	}
+	for _, step := range r.Steps {
+		fmt.Fprintf(s, " %g@%s", step.Volume, step.Time.Format(time.RFC3339))
+	}
+	return s.String()
+}
+
+// VolumeAt returns the volume of the ramp at time t, or volume if the ramp had
+// not started yet.
+func (r Ramp) VolumeAt(t time.Time, volume float64) float64 {
+	i := sort.Search(len(r.Steps), func(i int) bool {
+		return r.Steps[i].Time.After(t)
+	})
+	if i == 0 {
+		return volume
+	}
+	prev := r.Steps[i-1]
+	if !r.Linear || i == len(r.Steps) {
+		return prev.Volume
+	}
+	next := r.Steps[i]
+	f := float64(t.Sub(prev.Time)) / float64(next.Time.Sub(prev.Time))
+	return prev.Volume + f*(next.Volume-prev.Volume)
+}
+
+// NextStep returns the first step of the ramp after time t, and a boolean
+// indicating whether one was found.
+func (r Ramp) NextStep(t time.Time) (RampStep, bool) {
+	i := sort.Search(len(r.Steps), func(i int) bool {
+		return r.Steps[i].Time.After(t)
+	})
+	if i == len(r.Steps) {
+		return RampStep{}, false
+	}
+	return r.Steps[i], true
+}
+
+// validate returns an error if the steps of the ramp are not in increasing
+// order of time, or if their volumes are not between 0 and 1.
+func (r Ramp) validate() error {
+	for i, step := range r.Steps {
+		if step.Time.IsZero() {
+			return fmt.Errorf("invalid ramp: step %d has no time", i+1)
+		}
+		if step.Volume < 0 || step.Volume > 1 || math.IsNaN(step.Volume) {
+			return fmt.Errorf("invalid ramp: volume %g of step %d is not between 0 and 1", step.Volume, i+1)
+		}
+		if i > 0 && !r.Steps[i-1].Time.Before(step.Time) {
+			return fmt.Errorf("invalid ramp: step %d is not after step %d", i+1, i)
+		}
+	}
+	return nil
+}
+
+// decreasing returns true if the volume decreases at one of the steps of the
+// ramp, in which case some of the ids admitted earlier are excluded.
+func (r Ramp) decreasing() bool {
+	for i := 1; i < len(r.Steps); i++ {
+		if r.Steps[i].Volume < r.Steps[i-1].Volume {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Ramp) maxVolume() float64 {
+	max := 0.0
+	for _, step := range r.Steps {
+		if step.Volume > max {
+			max = step.Volume
+		}
+	}
+	return max
+}
+
+// maxVolume returns the maximum volume that the gate reaches, which is the
+// volume it was enabled with or the highest volume of its ramp.
+func (g *gate) maxVolume() float64 {
+	if v := g.ramp.maxVolume(); v > g.volume {
+		return v
+	}
+	return g.volume
+}
+
+// RampGate sets the ramp of a gate for a collection, an empty ramp removes it.
+// The method returns a *StateError if the lifecycle state of the gate does not
+// allow raising its volume to the volumes of the ramp (see GateState).
+func (tier *Tier) RampGate(family, name, collection string, ramp Ramp) error {
+	if err := validateGateNames(family, name, collection); err != nil {
+		return err
+	}
+	if err := ramp.validate(); err != nil {
+		return err
+	}
+	steps := make([]RampStep, len(ramp.Steps))
+	for i, step := range ramp.Steps {
+		steps[i] = RampStep{Time: step.Time.UTC(), Volume: step.Volume}
+	}
+	ramp.Steps = steps
+
+	path := tier.gateCollectionPath(family, name, collection)
+	return tier.update(path, func() error {
+		g, err := readGate(path)
+		if err != nil {
+			return err
+		}
+		state, err := readState(tier.statePath(family, name))
+		if err != nil {
+			return err
+		}
+		next := g
+		next.ramp = ramp
+		if err := state.checkEnable(family, name, g, next); err != nil {
+			return err
+		}
+		return tier.writeGate(path, next)
+	})
+}
+
+// ReadGateRamp returns the ramp of a gate for a collection, which is the zero
+// value if the gate has no ramp.
+func (tier *Tier) ReadGateRamp(family, name, collection string) (Ramp, error) {
+	if err := validateGateNames(family, name, collection); err != nil {
+		return Ramp{}, err
+	}
+	g, err := readGate(tier.gateCollectionPath(family, name, collection))
+	return g.ramp, err
+}
+
+func parseRamp(s string) (Ramp, error) {
+	var r Ramp
+
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return r, fmt.Errorf("invalid ramp: %q", s)
+	}
+
+	switch fields[0] {
+	case "linear":
+		r.Linear = true
+	case "steps":
+	default:
+		return r, fmt.Errorf("invalid ramp: unknown interpolation mode %q", fields[0])
+	}
+
+	r.Steps = make([]RampStep, 0, len(fields)-1)
+	for _, f := range fields[1:] {
+		i := strings.IndexByte(f, '@')
+		if i < 0 {
+			return r, fmt.Errorf("invalid ramp step: %q", f)
+		}
+		volume, err := strconv.ParseFloat(f[:i], 64)
+		if err != nil {
+			return r, fmt.Errorf("invalid ramp step: %q: %w", f, err)
+		}
+		t, err := time.Parse(time.RFC3339, f[i+1:])
+		if err != nil {
+			return r, fmt.Errorf("invalid ramp step: %q: %w", f, err)
+		}
+		r.Steps = append(r.Steps, RampStep{Time: t, Volume: volume})
+	}
+
+	return r, r.validate()
+}
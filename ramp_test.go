@@ -0,0 +1,256 @@
+package feature_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/feature"
+)
+
+var rampStart = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func TestGateRamp(t *testing.T) {
+	tests := []gateTest{
+		{
+			scenario: "ramps written to a tier can be read back",
+			function: testGateRampReadWrite,
+		},
+
+		{
+			scenario: "the volume of ramps is computed from their steps",
+			function: testGateRampVolume,
+		},
+
+		{
+			scenario: "caches evaluate ramps at query time and keep admitting the same ids",
+			function: testGateRampCache,
+		},
+
+		{
+			scenario: "caches evaluate linear ramps again each time their level changes",
+			function: testGateRampLevels,
+		},
+
+		{
+			scenario: "the state of gates restricts the volumes of their ramps",
+			function: testGateRampState,
+		},
+
+		{
+			scenario: "ramps decreasing the volume are reported by validation",
+			function: testGateRampDecreasing,
+		},
+	}
+
+	runGateTests(t, tests, func(t testing.TB, path feature.MountPoint, tier *feature.Tier) {
+		populateCollection(t, createCollection(t, tier, "workspaces"), makeIDs("id-%03d", 200))
+		createGate(t, tier, "family-A", "gate-1", "workspaces", 1234)
+	})
+}
+
+func testGateRampReadWrite(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	ramp := feature.Ramp{
+		Linear: true,
+		Steps: []feature.RampStep{
+			{Time: rampStart, Volume: 0.01},
+			{Time: rampStart.Add(7 * 24 * time.Hour), Volume: 1},
+		},
+	}
+	if err := tier.RampGate("family-A", "gate-1", "workspaces", ramp); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := tier.ReadGateRamp("family-A", "gate-1", "workspaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(found, ramp) {
+		t.Errorf("ramp mismatch: want %s, got %s", ramp, found)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(string(path), "standard", "1", "gates", "family-A", "gate-1", "workspaces"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "open\tfalse\nsalt\t1234\nvolume\t0\nramp\tlinear 0.01@2021-06-01T00:00:00Z 1@2021-06-08T00:00:00Z\n" {
+		t.Errorf("gate file mismatch:\n%s", s)
+	}
+
+	for _, steps := range [][]feature.RampStep{
+		{{Time: rampStart, Volume: 0.5}, {Time: rampStart, Volume: 1}},
+		{{Time: rampStart, Volume: 1.5}},
+		{{Volume: 0.5}},
+	} {
+		if err := tier.RampGate("family-A", "gate-1", "workspaces", feature.Ramp{Steps: steps}); err == nil {
+			t.Errorf("setting an invalid ramp did not fail: %v", steps)
+		}
+	}
+
+	if err := tier.RampGate("family-A", "gate-1", "workspaces", feature.Ramp{}); err != nil {
+		t.Fatal(err)
+	}
+	if found, err = tier.ReadGateRamp("family-A", "gate-1", "workspaces"); err != nil {
+		t.Fatal(err)
+	}
+	if !found.IsZero() {
+		t.Errorf("the ramp was not removed: %s", found)
+	}
+}
+
+func testGateRampVolume(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	steps := []feature.RampStep{
+		{Time: rampStart, Volume: 0.1},
+		{Time: rampStart.Add(10 * time.Hour), Volume: 0.5},
+		{Time: rampStart.Add(20 * time.Hour), Volume: 1},
+	}
+
+	for _, test := range []struct {
+		linear bool
+		at     time.Duration
+		volume float64
+		next   int
+	}{
+		{false, -time.Hour, 0.2, 0},
+		{false, 0, 0.1, 1},
+		{false, 5 * time.Hour, 0.1, 1},
+		{false, 10 * time.Hour, 0.5, 2},
+		{false, 30 * time.Hour, 1, -1},
+		{true, -time.Hour, 0.2, 0},
+		{true, 5 * time.Hour, 0.3, 1},
+		{true, 15 * time.Hour, 0.75, 2},
+		{true, 30 * time.Hour, 1, -1},
+	} {
+		r := feature.Ramp{Linear: test.linear, Steps: steps}
+		now := rampStart.Add(test.at)
+
+		if volume := r.VolumeAt(now, 0.2); math.Abs(volume-test.volume) > 1e-9 {
+			t.Errorf("%s: volume mismatch at %s: want %g, got %g", r, now, test.volume, volume)
+		}
+
+		next, ok := r.NextStep(now)
+		switch {
+		case test.next < 0 && ok:
+			t.Errorf("%s: unexpected next step at %s: %v", r, now, next)
+		case test.next >= 0 && (!ok || next != steps[test.next]):
+			t.Errorf("%s: next step mismatch at %s: want %v, got %v", r, now, steps[test.next], next)
+		}
+	}
+}
+
+func testGateRampCache(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	ramp := feature.Ramp{
+		Linear: true,
+		Steps: []feature.RampStep{
+			{Time: rampStart, Volume: 0},
+			{Time: rampStart.Add(100 * time.Hour), Volume: 1},
+		},
+	}
+	if err := tier.RampGate("family-A", "gate-1", "workspaces", ramp); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	now := rampStart.Add(-time.Hour)
+	c.SetClock(func() time.Time { return now })
+
+	admitted := make(map[string]bool)
+
+	for ; !now.After(rampStart.Add(101 * time.Hour)); now = now.Add(47 * time.Minute) {
+		for i := 0; i < 200; i++ {
+			id := fmt.Sprintf("id-%03d", i)
+			open := c.GateOpen("family-A", "gate-1", "workspaces", id)
+
+			if e := c.Explain("family-A", "gate-1", "workspaces", id); e.Open != open {
+				t.Fatalf("%s: cached state of %s is stale at %s: want %t, got %t", ramp, id, now, e.Open, open)
+			}
+			if admitted[id] && !open {
+				t.Fatalf("%s: %s was admitted but is closed at %s", ramp, id, now)
+			}
+			admitted[id] = open
+		}
+	}
+
+	for id, open := range admitted {
+		if !open {
+			t.Errorf("%s is closed at the end of the ramp", id)
+		}
+	}
+}
+
+func testGateRampLevels(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	// The level of the gates changes every second, the cache must never
+	// serve a state computed with the previous level.
+	for _, ramp := range []feature.Ramp{
+		{Linear: true, Steps: []feature.RampStep{{Time: rampStart, Volume: 0}, {Time: rampStart.Add(100 * time.Second), Volume: 1}}},
+		{Linear: true, Steps: []feature.RampStep{{Time: rampStart, Volume: 1}, {Time: rampStart.Add(100 * time.Second), Volume: 0}}},
+	} {
+		if err := tier.RampGate("family-A", "gate-1", "workspaces", ramp); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := path.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		now := rampStart
+		c.SetClock(func() time.Time { return now })
+
+		for ; now.Before(rampStart.Add(101 * time.Second)); now = now.Add(13 * time.Millisecond) {
+			for i := 0; i < 10; i++ {
+				id := fmt.Sprintf("id-%03d", i)
+				if e := c.Explain("family-A", "gate-1", "workspaces", id); e.Open != c.GateOpen("family-A", "gate-1", "workspaces", id) {
+					t.Fatalf("%s: cached state of %s is stale at %s", ramp, id, now)
+				}
+			}
+		}
+
+		c.Close()
+	}
+}
+
+func testGateRampState(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	enableGate(t, tier, "family-A", "gate-1", "workspaces", 0.5, false)
+	if err := tier.SetGateState("family-A", "gate-1", feature.Deprecated); err != nil {
+		t.Fatal(err)
+	}
+
+	ramp := feature.Ramp{
+		Steps: []feature.RampStep{
+			{Time: rampStart, Volume: 0.2},
+			{Time: rampStart.Add(time.Hour), Volume: 0.6},
+		},
+	}
+	expectStateError(t, tier.RampGate("family-A", "gate-1", "workspaces", ramp))
+
+	ramp.Steps[1].Volume = 0
+	if err := tier.RampGate("family-A", "gate-1", "workspaces", ramp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testGateRampDecreasing(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	ramp := feature.Ramp{
+		Steps: []feature.RampStep{
+			{Time: rampStart, Volume: 0.5},
+			{Time: rampStart.Add(time.Hour), Volume: 0.2},
+		},
+	}
+	if err := tier.RampGate("family-A", "gate-1", "workspaces", ramp); err != nil {
+		t.Fatal(err)
+	}
+
+	expectProblems(t, string(path), validate(t, path), []string{
+		"standard/1/gates/family-A/gate-1/workspaces:4: warning: the volume of the ramp decreases, ids admitted earlier will be excluded",
+	})
+}
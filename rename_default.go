@@ -0,0 +1,7 @@
+// +build !linux
+
+package feature
+
+func exchange(oldpath, newpath string) error {
+	return errExchangeNotSupported
+}
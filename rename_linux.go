@@ -0,0 +1,61 @@
+package feature
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// The syscall package does not expose renameat2(2) on all architectures, the
+// system call numbers are stable so we maintain our own table.
+var sysRenameat2 = map[string]uintptr{
+	"386":      353,
+	"amd64":    316,
+	"arm":      382,
+	"arm64":    276,
+	"loong64":  276,
+	"mips64":   5311,
+	"mips64le": 5311,
+	"ppc64":    357,
+	"ppc64le":  357,
+	"riscv64":  276,
+	"s390x":    347,
+}[runtime.GOARCH]
+
+const (
+	atFdcwd        = -0x64
+	renameExchange = 1 << 1
+)
+
+func exchange(oldpath, newpath string) error {
+	if sysRenameat2 == 0 {
+		return errExchangeNotSupported
+	}
+
+	p1, err := syscall.BytePtrFromString(oldpath)
+	if err != nil {
+		return err
+	}
+	p2, err := syscall.BytePtrFromString(newpath)
+	if err != nil {
+		return err
+	}
+
+	fd := atFdcwd
+	_, _, errno := syscall.Syscall6(sysRenameat2,
+		uintptr(fd), uintptr(unsafe.Pointer(p1)),
+		uintptr(fd), uintptr(unsafe.Pointer(p2)),
+		renameExchange, 0,
+	)
+
+	switch errno {
+	case 0:
+		return nil
+	case syscall.ENOSYS, syscall.EINVAL:
+		// The kernel or file system does not support the operation.
+		return errExchangeNotSupported
+	default:
+		return &os.LinkError{Op: "exchange", Old: oldpath, New: newpath, Err: errno}
+	}
+}
@@ -0,0 +1,67 @@
+package feature
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ConflictError is returned by compare-and-set operations when the revision
+// of the gate or collection they modify does not match the expected revision,
+// which indicates that it was modified concurrently.
+type ConflictError struct {
+	// The path to the file that was modified concurrently.
+	Path string
+
+	// The revision that the operation expected.
+	Revision string
+
+	// The current revision of the file, which is empty if it does not exist.
+	Current string
+}
+
+// Error satisfies the error interface.
+func (e *ConflictError) Error() string {
+	if e.Current == "" {
+		return fmt.Sprintf("%s: expected revision %s but the file does not exist", e.Path, e.Revision)
+	}
+	return fmt.Sprintf("%s: expected revision %s but the current revision is %s", e.Path, e.Revision, e.Current)
+}
+
+// revision returns the revision of the file at path, which is a hash of its
+// content.
+func revision(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
+
+// compareRevision returns a *ConflictError if the revision of the file at path
+// differs from rev. An empty rev matches any revision.
+//
+// The function must be called while holding the lock of the tier that the file
+// belongs to, so the revision cannot change before the file is rewritten.
+func compareRevision(path, rev string) error {
+	if rev == "" {
+		return nil
+	}
+	cur, err := revision(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if cur != rev {
+		return &ConflictError{Path: path, Revision: rev, Current: cur}
+	}
+	return nil
+}
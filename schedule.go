@@ -0,0 +1,232 @@
+package feature
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// ScheduleGate sets the window of time during which a gate applies its
+// configuration to a collection. Outside of the window, the gate behaves as if
+// its volume was zero and its default state closed. A zero start or end time
+// leaves the window unbounded on that side, so passing two zero times removes
+// the schedule of the gate.
+//
+// Caches evaluate schedules against their clock (see Cache.SetClock), gates
+// open and close at the start and end times without changes to the file system.
+func (tier *Tier) ScheduleGate(family, name, collection string, start, end time.Time) error {
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		return fmt.Errorf("%s/%s: the schedule must start before it ends", family, name)
+	}
+	return tier.updateGate(family, name, collection, func(g *gate) {
+		g.start, g.end = start.UTC(), end.UTC()
+	})
+}
+
+// ReadGateSchedule returns the window of time during which a gate applies its
+// configuration to a collection, zero times mean that the window is unbounded.
+func (tier *Tier) ReadGateSchedule(family, name, collection string) (start, end time.Time, err error) {
+	if err = validateGateNames(family, name, collection); err != nil {
+		return
+	}
+	g, err := readGate(tier.gateCollectionPath(family, name, collection))
+	return g.start, g.end, err
+}
+
+// SetClock sets the function that the cache uses to get the current time when
+// evaluating the schedules of gates and their expiry times. A nil clock
+// restores the default, which is time.Now.
+//
+// Programs usually do not need to call this method, it is mostly useful to
+// test the behavior of scheduled gates.
+func (c *Cache) SetClock(clock func() time.Time) {
+	c.clock.Store(clock)
+	c.mutex.Lock()
+	c.period = period{}
+	c.mutex.Unlock()
+}
+
+// SetClock sets the clock of the store, see Cache.SetClock. The clock remains
+// installed when the store reloads.
+func (s *Store) SetClock(clock func() time.Time) {
+	s.cache.SetClock(clock)
+}
+
+func (c *Cache) now() time.Time {
+	if clock, _ := c.clock.Load().(func() time.Time); clock != nil {
+		return clock()
+	}
+	return time.Now()
+}
+
+// checkSchedule returns the current time if gates of the cache are scheduled,
+// or the zero time otherwise. The cached results of lookups are discarded when
+// the clock crossed the start or end time of a gate since they were computed.
+func (c *Cache) checkSchedule() time.Time {
+	c.mutex.RLock()
+	if len(c.schedule) == 0 {
+		c.mutex.RUnlock()
+		return time.Time{}
+	}
+	now := c.now()
+	changed := c.scheduleChanged(now)
+	c.mutex.RUnlock()
+
+	if changed {
+		c.mutex.Lock()
+		if c.scheduleChanged(now) {
+			c.period = periodOf(c.schedule, now)
+			for _, g := range c.ramps {
+				if t := g.nextLevelChange(now); !t.IsZero() && t.UnixNano() < c.period.end {
+					c.period.end = t.UnixNano()
+				}
+			}
+			c.cache.clear()
+		}
+		c.mutex.Unlock()
+	}
+
+	return now
+}
+
+// scheduleChanged returns true if the schedules of the gates, or the volumes
+// of their linear ramps, may have changed the state of gates at time now since
+// the lookup cache was cleared. The cache mutex must be held.
+func (c *Cache) scheduleChanged(now time.Time) bool {
+	return !c.period.contains(now)
+}
+
+// nextLevelChange returns the time after now at which the level of a gate with
+// a linear ramp changes next, or the zero time if it does not change before the
+// next step of the ramp, which is part of the schedule of the cache.
+//
+// The time is predicted slightly early to absorb rounding errors, the level is
+// then computed again when the period ends, so the prediction is never late.
+func (g *cachedGate) nextLevelChange(now time.Time) time.Time {
+	steps := g.ramp.Steps
+	i := sort.Search(len(steps), func(i int) bool {
+		return steps[i].Time.After(now)
+	})
+	if i == 0 || i == len(steps) {
+		return time.Time{}
+	}
+
+	prev, next := steps[i-1], steps[i]
+	if prev.Volume == next.Volume {
+		return time.Time{}
+	}
+
+	// The level is the floor of the number of buckets times the volume, it
+	// changes when the volume reaches the next multiple of 1/buckets going
+	// up, or falls below the current one going down.
+	level := g.level(now)
+	if next.Volume > prev.Volume {
+		level++
+	}
+	f := (level/float64(g.buckets) - prev.Volume) / (next.Volume - prev.Volume)
+	t := prev.Time.Add(time.Duration(f * float64(next.Time.Sub(prev.Time)))).Add(-rampMargin)
+
+	switch {
+	case !t.Before(next.Time):
+		return time.Time{}
+	case !t.After(now):
+		return now.Add(1)
+	default:
+		return t
+	}
+}
+
+// rampMargin is how early the changes of levels of linear ramps are predicted.
+const rampMargin = time.Microsecond
+
+// period is a range of time during which the schedules of gates do not change
+// their state, expressed in nanoseconds since the unix epoch. The zero value
+// is an empty period.
+type period struct {
+	start int64
+	end   int64
+}
+
+func (p period) contains(t time.Time) bool {
+	n := t.UnixNano()
+	return n >= p.start && n < p.end
+}
+
+// periodOf returns the period containing t, schedule must be the sorted list
+// of start and end times of the gates and of the steps of their ramps.
+func periodOf(schedule []time.Time, t time.Time) period {
+	p := period{start: math.MinInt64, end: math.MaxInt64}
+	i := sort.Search(len(schedule), func(i int) bool {
+		return schedule[i].After(t)
+	})
+	if i > 0 {
+		p.start = schedule[i-1].UnixNano()
+	}
+	if i < len(schedule) {
+		p.end = schedule[i].UnixNano()
+	}
+	return p
+}
+
+// scheduleOf returns the sorted list of the start and end times of the gates of
+// the tiers, and of the steps of their ramps.
+func scheduleOf(tiers []cachedTier) []time.Time {
+	schedule := make([]time.Time, 0)
+
+	for i := range tiers {
+		for _, gates := range tiers[i].gates {
+			for _, g := range gates {
+				if !g.start.IsZero() {
+					schedule = append(schedule, g.start)
+				}
+				if !g.end.IsZero() {
+					schedule = append(schedule, g.end)
+				}
+				for _, step := range g.ramp.Steps {
+					schedule = append(schedule, step.Time)
+				}
+			}
+		}
+	}
+
+	if len(schedule) == 0 {
+		return nil
+	}
+
+	sort.Slice(schedule, func(i, j int) bool {
+		return schedule[i].Before(schedule[j])
+	})
+
+	n := 1
+	for _, t := range schedule[1:] {
+		if !t.Equal(schedule[n-1]) {
+			schedule[n] = t
+			n++
+		}
+	}
+	return schedule[:n]
+}
+
+// rampsOf returns the list of gates of the tiers which have linear ramps.
+func rampsOf(tiers []cachedTier) []*cachedGate {
+	var ramps []*cachedGate
+
+	for i := range tiers {
+		for _, gates := range tiers[i].gates {
+			for j := range gates {
+				if g := &gates[j]; g.ramp.Linear && !g.ramp.IsZero() {
+					ramps = append(ramps, g)
+				}
+			}
+		}
+	}
+
+	return ramps
+}
+
+// active returns true if t is within the window [start, end) of a schedule,
+// zero times leave the window unbounded.
+func active(t, start, end time.Time) bool {
+	return (start.IsZero() || !t.Before(start)) && (end.IsZero() || t.Before(end))
+}
@@ -0,0 +1,170 @@
+package feature_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/segmentio/feature"
+)
+
+var (
+	scheduleStart = time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+	scheduleEnd   = time.Date(2021, 6, 2, 9, 0, 0, 0, time.UTC)
+)
+
+func TestGateSchedule(t *testing.T) {
+	tests := []gateTest{
+		{
+			scenario: "schedules written to a tier can be read back",
+			function: testGateScheduleReadWrite,
+		},
+
+		{
+			scenario: "caches open scheduled gates between their start and end times",
+			function: testGateScheduleCache,
+		},
+
+		{
+			scenario: "stores re-evaluate scheduled gates without changes to the file system",
+			function: testGateScheduleStore,
+		},
+
+		{
+			scenario: "invalid schedules are reported by validation",
+			function: testGateScheduleInvalid,
+		},
+	}
+
+	runGateTests(t, tests, func(t testing.TB, path feature.MountPoint, tier *feature.Tier) {
+		populateCollection(t, createCollection(t, tier, "workspaces"), []string{"id-1"})
+		createGate(t, tier, "family-A", "gate-1", "workspaces", 1234)
+		createGate(t, tier, "family-A", "gate-2", "workspaces", 1234)
+		enableGate(t, tier, "family-A", "gate-1", "workspaces", 1, true)
+		enableGate(t, tier, "family-A", "gate-2", "workspaces", 1, true)
+	})
+}
+
+func testGateScheduleReadWrite(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	expectGateSchedule(t, tier, "family-A", "gate-1", time.Time{}, time.Time{})
+
+	if err := tier.SetGateAttribute("family-A", "gate-1", "workspaces", "ticket", "1234"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tier.ScheduleGate("family-A", "gate-1", "workspaces", scheduleStart, scheduleEnd); err != nil {
+		t.Fatal(err)
+	}
+	expectGateSchedule(t, tier, "family-A", "gate-1", scheduleStart, scheduleEnd)
+
+	if err := tier.ScheduleGate("family-A", "gate-1", "workspaces", time.Time{}, scheduleEnd); err != nil {
+		t.Fatal(err)
+	}
+	expectGateSchedule(t, tier, "family-A", "gate-1", time.Time{}, scheduleEnd)
+
+	if err := tier.ScheduleGate("family-A", "gate-1", "workspaces", scheduleEnd, scheduleStart); err == nil {
+		t.Error("setting a schedule ending before it starts did not fail")
+	}
+	if err := tier.SetGateAttribute("family-A", "gate-1", "workspaces", "start", "now"); err == nil {
+		t.Error("setting the start time as an attribute did not fail")
+	}
+
+	if err := tier.ScheduleGate("family-A", "gate-1", "workspaces", time.Time{}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(string(path), "standard", "1", "gates", "family-A", "gate-1", "workspaces"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "open\ttrue\nsalt\t1234\nvolume\t1\nticket\t1234\n" {
+		t.Errorf("gate file mismatch:\n%s", s)
+	}
+}
+
+func testGateScheduleCache(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	if err := tier.ScheduleGate("family-A", "gate-1", "workspaces", scheduleStart, scheduleEnd); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	now := scheduleStart.Add(-time.Second)
+	c.SetClock(func() time.Time { return now })
+
+	for _, step := range []struct {
+		now  time.Time
+		open bool
+	}{
+		{scheduleStart.Add(-time.Second), false},
+		{scheduleStart, true},
+		{scheduleEnd.Add(-time.Second), true},
+		{scheduleEnd, false},
+		{scheduleStart.Add(time.Hour), true},
+	} {
+		now = step.now
+		for _, id := range []string{"id-1", "id-2"} {
+			expectGateIsEnabled(t, c, "family-A", "gate-1", "workspaces", id, step.open)
+			expectGateIsEnabled(t, c, "family-A", "gate-2", "workspaces", id, true)
+		}
+	}
+}
+
+func testGateScheduleStore(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	if err := tier.ScheduleGate("family-A", "gate-1", "workspaces", time.Time{}, scheduleEnd); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := path.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := scheduleStart
+	s.SetClock(func() time.Time { return now })
+
+	if !s.GateOpen("family-A", "gate-1", "workspaces", "id-1") {
+		t.Error("family-A/gate-1 is closed before the end of its schedule")
+	}
+
+	now = scheduleEnd
+	if s.GateOpen("family-A", "gate-1", "workspaces", "id-1") {
+		t.Error("family-A/gate-1 is open after the end of its schedule")
+	}
+	if gates := s.LookupGates("family-A", "workspaces", "id-1"); len(gates) != 1 || gates[0] != "gate-2" {
+		t.Errorf("gates mismatch: %q", gates)
+	}
+}
+
+func testGateScheduleInvalid(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	file := filepath.Join(string(path), "standard", "1", "gates", "family-A", "gate-1", "workspaces")
+	if err := ioutil.WriteFile(file, []byte("open\ttrue\nsalt\t1234\nvolume\t1\nstart\ttomorrow\nend\t2021-06-01T00:00:00Z\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file = filepath.Join(string(path), "standard", "1", "gates", "family-A", "gate-2", "workspaces")
+	if err := ioutil.WriteFile(file, []byte("open\ttrue\nsalt\t1234\nvolume\t1\nstart\t2021-06-02T00:00:00Z\nend\t2021-06-01T00:00:00Z\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	refreshManifest(t, path)
+
+	expectProblems(t, string(path), validate(t, path), []string{
+		"standard/1/gates/family-A/gate-1/workspaces:4: error: invalid value of \"start\": \"tomorrow\" is not a RFC3339 time",
+		"standard/1/gates/family-A/gate-2/workspaces:5: error: the schedule ends at 2021-06-01T00:00:00Z before it starts at 2021-06-02T00:00:00Z",
+	})
+}
+
+func expectGateSchedule(t testing.TB, tier *feature.Tier, family, gate string, start, end time.Time) {
+	t.Helper()
+
+	s, e, err := tier.ReadGateSchedule(family, gate, "workspaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Equal(start) || !e.Equal(end) {
+		t.Errorf("gate schedule mismatch: want [%s, %s), got [%s, %s)", start, end, s, e)
+	}
+}
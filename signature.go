@@ -0,0 +1,149 @@
+package feature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// signatureFile is the name of the file holding the signature of the manifest
+// at the root of feature databases.
+const signatureFile = ".manifest.sig"
+
+// SignatureError is returned when loading a feature database with trusted keys
+// and the database is not signed by any of them.
+type SignatureError struct {
+	// The path of the feature database.
+	Path string
+
+	// A description of the reason why the signature was rejected.
+	Reason string
+}
+
+// Error satisfies the error interface.
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Reason)
+}
+
+// Sign signs the manifest of the database at the mount point with key.
+//
+// The signature covers the manifest, which itself records the content hashes
+// of all the files of the database, so any modification made to the database
+// after signing it invalidates the signature. The database must have a
+// manifest, which can be written with WriteManifest.
+func (path MountPoint) Sign(key ed25519.PrivateKey) error {
+	if len(key) != ed25519.PrivateKeySize {
+		return fmt.Errorf("invalid ed25519 private key length: %d", len(key))
+	}
+	root := string(path)
+	return withLock(filepath.Join(root, manifestLockFile), true, func() error {
+		b, err := ioutil.ReadFile(filepath.Join(root, manifestFile))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("signing feature database at %s: the database has no manifest", path)
+			}
+			return err
+		}
+		sig := ed25519.Sign(key, b)
+		return writeFile(filepath.Join(root, signatureFile), func(f *os.File) error {
+			_, err := fmt.Fprintf(f, "%s\n", base64.StdEncoding.EncodeToString(sig))
+			return err
+		})
+	})
+}
+
+// VerifySignature checks that the manifest of the database at the mount point
+// was signed by one of the trusted keys, returning a *SignatureError if it was
+// not.
+//
+// Only the manifest is verified, use Manifest.Verify to check that the files
+// of the database match it.
+func (path MountPoint) VerifySignature(keys ...ed25519.PublicKey) error {
+	b, err := ioutil.ReadFile(filepath.Join(string(path), manifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &SignatureError{Path: string(path), Reason: "feature database has no manifest"}
+		}
+		return err
+	}
+	return verifySignature(path, b, keys)
+}
+
+// verifySignature checks the signature of the manifest content b of the
+// database at path against the trusted keys.
+func verifySignature(path MountPoint, manifest []byte, keys []ed25519.PublicKey) error {
+	s, err := ioutil.ReadFile(filepath.Join(string(path), signatureFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &SignatureError{Path: string(path), Reason: "feature database is not signed"}
+		}
+		return err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(s)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return &SignatureError{Path: string(path), Reason: "malformed signature"}
+	}
+
+	for _, key := range keys {
+		if len(key) == ed25519.PublicKeySize && ed25519.Verify(key, manifest, sig) {
+			return nil
+		}
+	}
+
+	return &SignatureError{Path: string(path), Reason: "feature database is not signed by any of the trusted keys"}
+}
+
+// ParsePublicKey parses an ed25519 public key from a PEM encoded PKIX block,
+// as written by `openssl pkey -pubout`.
+func ParsePublicKey(b []byte) (ed25519.PublicKey, error) {
+	der, err := decodePEM(b, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	k, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("expected an ed25519 public key but got %T", k)
+	}
+	return key, nil
+}
+
+// ParsePrivateKey parses an ed25519 private key from a PEM encoded PKCS #8
+// block, as written by `openssl genpkey -algorithm ed25519`.
+func ParsePrivateKey(b []byte) (ed25519.PrivateKey, error) {
+	der, err := decodePEM(b, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	k, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("expected an ed25519 private key but got %T", k)
+	}
+	return key, nil
+}
+
+func decodePEM(b []byte, typ string) ([]byte, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if block.Type != typ {
+		return nil, fmt.Errorf("expected a PEM block of type %q but got %q", typ, block.Type)
+	}
+	return block.Bytes, nil
+}
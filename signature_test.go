@@ -0,0 +1,190 @@
+package feature_test
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/segmentio/feature"
+)
+
+func TestSignature(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, feature.MountPoint, ed25519.PublicKey, ed25519.PrivateKey)
+	}{
+		{
+			scenario: "databases signed by a trusted key are loaded",
+			function: testSignatureTrusted,
+		},
+
+		{
+			scenario: "unsigned databases are rejected",
+			function: testSignatureUnsigned,
+		},
+
+		{
+			scenario: "databases signed by an untrusted key are rejected",
+			function: testSignatureUntrusted,
+		},
+
+		{
+			scenario: "databases modified after being signed are rejected",
+			function: testSignatureModified,
+		},
+
+		{
+			scenario: "stores keep serving the previous version when verification fails",
+			function: testSignatureStore,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "feature")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+			path := feature.MountPoint(filepath.Join(tmp, "features"))
+
+			pub, key := generateKey(t)
+			b := newBuilder(t, path)
+			defer b.Abort()
+			b.SetSigningKey(key)
+			buildGate(t, b, "standard", "1", "family-A", "gate-1", "workspaces", 1.0, []string{"id-1"})
+			commitBuilder(t, b)
+
+			test.function(t, path, pub, key)
+		})
+	}
+}
+
+func testSignatureTrusted(t *testing.T, path feature.MountPoint, pub ed25519.PublicKey, key ed25519.PrivateKey) {
+	other, _ := generateKey(t)
+
+	c, err := path.Load(other, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if !c.GateOpen("family-A", "gate-1", "workspaces", "id-1") {
+		t.Error("gate is not open")
+	}
+}
+
+func testSignatureUnsigned(t *testing.T, path feature.MountPoint, pub ed25519.PublicKey, key ed25519.PrivateKey) {
+	b, err := path.NewBuilderFrom(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Abort()
+	commitBuilder(t, b)
+
+	expectSignatureError(t, path, pub)
+}
+
+func testSignatureUntrusted(t *testing.T, path feature.MountPoint, pub ed25519.PublicKey, key ed25519.PrivateKey) {
+	other, _ := generateKey(t)
+	expectSignatureError(t, path, other)
+}
+
+func testSignatureModified(t *testing.T, path feature.MountPoint, pub ed25519.PublicKey, key ed25519.PrivateKey) {
+	tier, err := path.OpenTier("standard", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tier.Close()
+
+	if err := tier.EnableGate("family-A", "gate-1", "workspaces", 0, false); err != nil {
+		t.Fatal(err)
+	}
+	expectSignatureError(t, path, pub)
+
+	if err := path.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := path.VerifySignature(pub); err != nil {
+		t.Error(err)
+	}
+
+	// Files modified without updating the manifest are detected when loading
+	// with trusted keys, even though the signature of the manifest is valid.
+	f := filepath.Join(string(path), "standard", "1", "collections", "workspaces")
+	if err := ioutil.WriteFile(f, []byte("id-1\nid-2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := path.Load(pub)
+	if err == nil {
+		c.Close()
+		t.Fatal("loading the modified database did not fail")
+	}
+	if manifestErr := new(feature.ManifestError); !errors.As(err, &manifestErr) {
+		t.Errorf("expected a manifest error, got %v", err)
+	}
+}
+
+func testSignatureStore(t *testing.T, path feature.MountPoint, pub ed25519.PublicKey, key ed25519.PrivateKey) {
+	s, err := path.Open(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	b, err := path.NewBuilderFrom(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Abort()
+	if err := b.EnableGate("standard", "1", "family-A", "gate-1", "workspaces", 0, false); err != nil {
+		t.Fatal(err)
+	}
+	commitBuilder(t, b)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Err() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the store to report the verification failure")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sigErr := new(feature.SignatureError)
+	if !errors.As(s.Err(), &sigErr) {
+		t.Errorf("expected a signature error, got %v", s.Err())
+	}
+	if !s.GateOpen("family-A", "gate-1", "workspaces", "id-1") {
+		t.Error("the store did not keep serving the previous version of the database")
+	}
+}
+
+func generateKey(t testing.TB) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pub, key
+}
+
+func expectSignatureError(t testing.TB, path feature.MountPoint, keys ...ed25519.PublicKey) {
+	t.Helper()
+
+	c, err := path.Load(keys...)
+	if err == nil {
+		c.Close()
+		t.Fatal("loading the database did not fail")
+	}
+
+	sigErr := new(feature.SignatureError)
+	if !errors.As(err, &sigErr) {
+		t.Errorf("expected a signature error, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package feature
+
+import (
+	"os"
+	"time"
+)
+
+// StaleGate describes a gate of a tier which is likely safe to remove, as
+// reported by StaleGates.
+type StaleGate struct {
+	Group  string
+	Tier   string
+	Family string
+	Gate   string
+
+	// The expiry time of the gate if it expired, zero otherwise.
+	Expires time.Time
+
+	// The time since which the gate has been fully rolled out if it exceeds
+	// the threshold, zero otherwise.
+	RolledOut time.Time
+}
+
+// StaleGates returns the gates which expired at the given time, or have been
+// open for all the ids of all their collections for longer than threshold. The
+// latter check is disabled when threshold is zero or negative.
+//
+// Gates are considered fully rolled out since the time recorded in their
+// metadata when EnableGate opened them for all their collections (see
+// GateMetadata.RolledOut).
+func (path MountPoint) StaleGates(now time.Time, threshold time.Duration) ([]StaleGate, error) {
+	stale := make([]StaleGate, 0)
+
+	err := Scan(path.Groups(), func(group string) error {
+		return Scan(path.Tiers(group), func(tier string) error {
+			t, err := path.OpenTier(group, tier)
+			if err != nil {
+				return err
+			}
+			defer t.Close()
+
+			return Scan(t.Families(), func(family string) error {
+				return Scan(t.Gates(family), func(gate string) error {
+					m, err := t.ReadGateMetadata(family, gate)
+					if err != nil {
+						return err
+					}
+
+					g := StaleGate{
+						Group:  group,
+						Tier:   tier,
+						Family: family,
+						Gate:   gate,
+					}
+					if m.Expired(now) {
+						g.Expires = m.Expires
+					}
+
+					if threshold > 0 {
+						rolledOut, err := t.rolledOut(family, gate)
+						if err != nil {
+							return err
+						}
+						if !rolledOut.IsZero() && now.Sub(rolledOut) >= threshold {
+							g.RolledOut = rolledOut
+						}
+					}
+
+					if !g.Expires.IsZero() || !g.RolledOut.IsZero() {
+						stale = append(stale, g)
+					}
+					return nil
+				})
+			})
+		})
+	})
+
+	return stale, err
+}
+
+// rolledOut returns the time since which a gate is open for all the ids of all
+// its collections, or the zero time if it is not. The time is read from the
+// metadata of the gate, gates which were rolled out before it was recorded use
+// the last modification time of their files.
+func (tier *Tier) rolledOut(family, gate string) (time.Time, error) {
+	full, last, err := tier.fullyOpen(family, gate)
+	if err != nil || !full {
+		return time.Time{}, err
+	}
+	m, err := readMetadata(tier.metadataPath(family, gate))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !m.RolledOut.IsZero() {
+		return m.RolledOut, nil
+	}
+	return last, nil
+}
+
+// recordRollout records the time at which a gate becomes open for all the ids
+// of all its collections in its metadata, or clears it when it is not anymore.
+// The tier must be locked.
+func (tier *Tier) recordRollout(family, gate string, now time.Time) error {
+	full, _, err := tier.fullyOpen(family, gate)
+	if err != nil {
+		return err
+	}
+	path := tier.metadataPath(family, gate)
+	m, err := readMetadata(path)
+	if err != nil {
+		return err
+	}
+	if full == !m.RolledOut.IsZero() {
+		return nil
+	}
+	if full {
+		m.RolledOut = now
+	} else {
+		m.RolledOut = time.Time{}
+	}
+	return writeMetadata(path, m)
+}
+
+// fullyOpen returns true if the volume of a gate is 1 in all its collections,
+// and the last modification time of its files.
+func (tier *Tier) fullyOpen(family, gate string) (bool, time.Time, error) {
+	var last time.Time
+	var full = true
+
+	err := Scan(tier.GatesCreated(family, gate), func(collection string) error {
+		path := tier.gateCollectionPath(family, gate, collection)
+		g, err := readGate(path)
+		if err != nil {
+			return err
+		}
+		s, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if s.ModTime().After(last) {
+			last = s.ModTime()
+		}
+		full = full && g.volume >= 1
+		return nil
+	})
+
+	return full && err == nil, last, err
+}
@@ -0,0 +1,87 @@
+package feature_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/segmentio/feature"
+)
+
+func TestStaleGates(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	path := feature.MountPoint(tmp)
+
+	tier := createTier(t, path, "standard", "1")
+	defer tier.Close()
+
+	now := time.Now()
+	month := 30 * 24 * time.Hour
+
+	// gate-1 expired, gate-2 is fully rolled out since two months, gate-3 is
+	// only partially rolled out in one of its collections, and gate-4 was
+	// fully rolled out recently.
+	for _, gate := range []string{"gate-1", "gate-2", "gate-3", "gate-4"} {
+		createGate(t, tier, "family-A", gate, "workspaces", 1234)
+		enableGate(t, tier, "family-A", gate, "workspaces", 1, false)
+	}
+	createGate(t, tier, "family-A", "gate-3", "users", 1234)
+	enableGate(t, tier, "family-A", "gate-3", "users", 0.5, false)
+	enableGate(t, tier, "family-A", "gate-1", "workspaces", 0.5, false)
+
+	if err := tier.WriteGateMetadata("family-A", "gate-1", feature.GateMetadata{Expires: now.Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The rollout time is recorded when the gates are enabled, and is not
+	// affected by later modifications of the gate files.
+	for _, gate := range []string{"gate-2", "gate-3"} {
+		if err := tier.WriteGateMetadata("family-A", gate, feature.GateMetadata{RolledOut: now.Add(-2 * month)}); err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(tmp, "standard", "1", "gates", "family-A", gate, "workspaces")
+		if err := os.Chtimes(file, now, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m := readGateMetadata(t, tier, "family-A", "gate-4"); m.RolledOut.IsZero() {
+		t.Error("the rollout time of gate-4 was not recorded")
+	}
+	if m := readGateMetadata(t, tier, "family-A", "gate-1"); !m.RolledOut.IsZero() {
+		t.Error("the rollout time of gate-1 was not cleared when lowering its volume")
+	}
+
+	stale, err := path.StaleGates(now, month)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := make(map[string]feature.StaleGate)
+	for _, g := range stale {
+		found[g.Gate] = g
+	}
+
+	if len(found) != 2 {
+		t.Errorf("wrong number of stale gates: %+v", stale)
+	}
+	if g := found["gate-1"]; g.Expires.IsZero() || !g.RolledOut.IsZero() {
+		t.Errorf("gate-1 should be reported as expired: %+v", g)
+	}
+	if g := found["gate-2"]; !g.Expires.IsZero() || now.Sub(g.RolledOut) < month {
+		t.Errorf("gate-2 should be reported as fully rolled out: %+v", g)
+	}
+
+	stale, err = path.StaleGates(now, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0].Gate != "gate-1" {
+		t.Errorf("only gate-1 should be reported when the threshold is zero: %+v", stale)
+	}
+}
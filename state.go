@@ -0,0 +1,201 @@
+package feature
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// stateFile is the name of the file holding the lifecycle state of a gate, in
+// the gate directory.
+const stateFile = ".state"
+
+// GateState represents the lifecycle state of a gate in a tier.
+//
+// Gates have no state until one is assigned with Tier.SetGateState, in which
+// case none of the restrictions associated with states apply.
+type GateState string
+
+const (
+	// Draft gates are being prepared and cannot be opened for any id.
+	Draft GateState = "draft"
+
+	// RollingOut gates are being opened progressively.
+	RollingOut GateState = "rolling-out"
+
+	// Launched gates have completed their rollout.
+	Launched GateState = "launched"
+
+	// Deprecated gates are about to be removed, their volume cannot be raised
+	// and they cannot be opened by default.
+	Deprecated GateState = "deprecated"
+
+	// Removed gates must not be evaluated anymore, they cannot be opened for
+	// any id and strict evaluation fails with a *StateError.
+	Removed GateState = "removed"
+)
+
+// gateTransitions maps each state to the states that gates can transition to.
+var gateTransitions = map[GateState][]GateState{
+	Draft:      {RollingOut, Removed},
+	RollingOut: {Draft, Launched, Deprecated, Removed},
+	Launched:   {RollingOut, Deprecated},
+	Deprecated: {Removed},
+	Removed:    {},
+}
+
+// GateStates returns the list of gate states, in lifecycle order.
+func GateStates() []GateState {
+	return []GateState{Draft, RollingOut, Launched, Deprecated, Removed}
+}
+
+// ParseGateState parses the name of a gate state.
+func ParseGateState(s string) (GateState, error) {
+	state := GateState(s)
+	if _, ok := gateTransitions[state]; !ok {
+		return "", fmt.Errorf("invalid gate state: %q", s)
+	}
+	return state, nil
+}
+
+// CanTransition returns true if gates in state s can transition to the state
+// passed as argument. Gates without a state can transition to any state, and
+// staying in the same state is always allowed.
+func (s GateState) CanTransition(to GateState) bool {
+	if s == "" || s == to {
+		return true
+	}
+	for _, next := range gateTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StateError is returned when an operation is not allowed by the lifecycle
+// state of a gate.
+type StateError struct {
+	Family string
+	Gate   string
+	State  GateState
+
+	// A description of the reason why the operation was rejected.
+	Reason string
+}
+
+// Error satisfies the error interface.
+func (e *StateError) Error() string {
+	return fmt.Sprintf("%s/%s: %s gate: %s", e.Family, e.Gate, e.State, e.Reason)
+}
+
+// ReadGateState returns the lifecycle state of a gate, which is empty if none
+// was assigned.
+func (tier *Tier) ReadGateState(family, name string) (GateState, error) {
+	if err := validateFamilyGateNames(family, name); err != nil {
+		return "", err
+	}
+	return readState(tier.statePath(family, name))
+}
+
+// SetGateState changes the lifecycle state of a gate, which must have been
+// created in the tier. The method returns a *StateError if the current state
+// of the gate cannot transition to the new state, or if the gate is open in
+// one of its collections and the new state does not allow it to be (gates
+// must be closed, and their ramps removed, before being moved back to draft or
+// removed).
+func (tier *Tier) SetGateState(family, name string, state GateState) error {
+	if err := validateFamilyGateNames(family, name); err != nil {
+		return err
+	}
+	if _, err := ParseGateState(string(state)); err != nil {
+		return err
+	}
+	path := tier.statePath(family, name)
+	return tier.update(path, func() error {
+		if _, err := os.Stat(tier.gatePath(family, name)); err != nil {
+			return err
+		}
+		prev, err := readState(path)
+		if err != nil {
+			return err
+		}
+		if !prev.CanTransition(state) {
+			return &StateError{
+				Family: family,
+				Gate:   name,
+				State:  prev,
+				Reason: fmt.Sprintf("cannot transition to %s", state),
+			}
+		}
+		if err := Scan(tier.GatesCreated(family, name), func(collection string) error {
+			g, err := readGate(tier.gateCollectionPath(family, name, collection))
+			if err != nil {
+				return err
+			}
+			// The current configuration of the gate must be one that could
+			// have been set in the new state.
+			if state.checkEnable(family, name, g, g) != nil {
+				return &StateError{
+					Family: family,
+					Gate:   name,
+					State:  prev,
+					Reason: fmt.Sprintf("cannot transition to %s while the gate is open for %s", state, collection),
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		return writeFile(path, func(f *os.File) error {
+			_, err := fmt.Fprintln(f, state)
+			return err
+		})
+	})
+}
+
+func (tier *Tier) statePath(family, name string) string {
+	return filepath.Join(tier.gatePath(family, name), stateFile)
+}
+
+// checkEnable returns a *StateError if a gate in state s cannot change from
+// one configuration to another. Volumes are compared with the maximum volume
+// that the gate reaches, including the volumes of its ramp.
+func (s GateState) checkEnable(family, name string, from, to gate) error {
+	var reason string
+
+	switch s {
+	case Draft, Removed:
+		if to.maxVolume() > 0 || to.open {
+			reason = "the gate cannot be opened"
+		}
+	case Deprecated:
+		if to.maxVolume() > from.maxVolume() {
+			reason = fmt.Sprintf("the volume cannot be raised from %g to %g", from.maxVolume(), to.maxVolume())
+		} else if to.open && !from.open {
+			reason = "the gate cannot be opened by default"
+		}
+	}
+
+	if reason != "" {
+		return &StateError{Family: family, Gate: name, State: s, Reason: reason}
+	}
+	return nil
+}
+
+func readState(path string) (GateState, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return "", err
+	}
+	state, err := ParseGateState(string(bytes.TrimSpace(b)))
+	if err != nil {
+		err = &os.PathError{Op: "read", Path: path, Err: err}
+	}
+	return state, err
+}
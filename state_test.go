@@ -0,0 +1,241 @@
+package feature_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/segmentio/feature"
+)
+
+func TestGateState(t *testing.T) {
+	tests := []gateTest{
+		{
+			scenario: "gates have no state until one is assigned",
+			function: testGateStateUnset,
+		},
+
+		{
+			scenario: "gates can only transition to the states allowed by their lifecycle",
+			function: testGateStateTransitions,
+		},
+
+		{
+			scenario: "the state of gates restricts the changes made by enabling them",
+			function: testGateStateEnable,
+		},
+
+		{
+			scenario: "gates which are open cannot be moved to draft or removed",
+			function: testGateStateOpen,
+		},
+
+		{
+			scenario: "the volumes of ramps are restricted by the state of gates",
+			function: testGateStateRamp,
+		},
+
+		{
+			scenario: "strict evaluation of removed gates fails",
+			function: testGateStateStrict,
+		},
+
+		{
+			scenario: "invalid states are reported by validation",
+			function: testGateStateInvalid,
+		},
+	}
+
+	runGateTests(t, tests, func(t testing.TB, path feature.MountPoint, tier *feature.Tier) {
+		createGate(t, tier, "family-A", "gate-1", "workspaces", 1234)
+	})
+}
+
+func testGateStateUnset(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	expectGateState(t, tier, "family-A", "gate-1", "")
+	enableGate(t, tier, "family-A", "gate-1", "workspaces", 1, true)
+
+	if err := tier.SetGateState("family-A", "gate-1", feature.Deprecated); err != nil {
+		t.Fatal(err)
+	}
+	expectGateState(t, tier, "family-A", "gate-1", feature.Deprecated)
+
+	if err := tier.SetGateState("family-A", "gate-2", feature.Draft); !os.IsNotExist(err) {
+		t.Errorf("expected an error indicating that the gate does not exist, got %v", err)
+	}
+}
+
+func testGateStateTransitions(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	for _, step := range []struct {
+		state feature.GateState
+		fail  bool
+	}{
+		{feature.Draft, false},
+		{feature.Launched, true},
+		{feature.RollingOut, false},
+		{feature.Launched, false},
+		{feature.Launched, false},
+		{feature.Removed, true},
+		{feature.Deprecated, false},
+		{feature.RollingOut, true},
+		{feature.Removed, false},
+		{feature.Draft, true},
+	} {
+		err := tier.SetGateState("family-A", "gate-1", step.state)
+		if step.fail {
+			expectStateError(t, err)
+		} else if err != nil {
+			t.Fatalf("transition to %s failed: %v", step.state, err)
+		}
+	}
+	expectGateState(t, tier, "family-A", "gate-1", feature.Removed)
+}
+
+func testGateStateEnable(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	setGateState := func(state feature.GateState) {
+		t.Helper()
+		if err := tier.SetGateState("family-A", "gate-1", state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setGateState(feature.Draft)
+	expectStateError(t, tier.EnableGate("family-A", "gate-1", "workspaces", 0.1, false))
+	expectStateError(t, tier.EnableGate("family-A", "gate-1", "workspaces", 0, true))
+
+	setGateState(feature.RollingOut)
+	enableGate(t, tier, "family-A", "gate-1", "workspaces", 0.5, false)
+
+	setGateState(feature.Deprecated)
+	expectStateError(t, tier.EnableGate("family-A", "gate-1", "workspaces", 0.6, false))
+	expectStateError(t, tier.EnableGate("family-A", "gate-1", "workspaces", 0.5, true))
+	enableGate(t, tier, "family-A", "gate-1", "workspaces", 0.2, false)
+
+	enableGate(t, tier, "family-A", "gate-1", "workspaces", 0, false)
+	setGateState(feature.Removed)
+	expectStateError(t, tier.EnableGate("family-A", "gate-1", "workspaces", 0.1, false))
+	enableGate(t, tier, "family-A", "gate-1", "workspaces", 0, false)
+}
+
+func testGateStateOpen(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	populateCollection(t, createCollection(t, tier, "workspaces"), []string{"1234"})
+	createGate(t, tier, "family-A", "gate-2", "workspaces", 1234)
+	enableGate(t, tier, "family-A", "gate-1", "workspaces", 1, false)
+	enableGate(t, tier, "family-A", "gate-2", "workspaces", 0, true)
+
+	// Gates open for any id cannot be moved to states which do not allow it,
+	// since they would remain open.
+	for _, gate := range []string{"gate-1", "gate-2"} {
+		for _, state := range []feature.GateState{feature.Draft, feature.Removed} {
+			expectStateError(t, tier.SetGateState("family-A", gate, state))
+		}
+		expectGateState(t, tier, "family-A", gate, "")
+	}
+
+	enableGate(t, tier, "family-A", "gate-1", "workspaces", 0, false)
+	if err := tier.SetGateState("family-A", "gate-1", feature.Removed); err != nil {
+		t.Fatal(err)
+	}
+	expectCacheGateOpened(t, path, "family-A", "gate-1", "workspaces", "1234", false)
+	expectCacheGateOpened(t, path, "family-A", "gate-2", "workspaces", "5678", true)
+}
+
+func testGateStateRamp(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	ramp := feature.Ramp{
+		Steps: []feature.RampStep{{Time: time.Now().Add(time.Hour), Volume: 0.5}},
+	}
+	if err := tier.RampGate("family-A", "gate-1", "workspaces", ramp); err != nil {
+		t.Fatal(err)
+	}
+
+	// The gate is closed until its ramp starts, but would open afterwards.
+	for _, state := range []feature.GateState{feature.Draft, feature.Removed} {
+		expectStateError(t, tier.SetGateState("family-A", "gate-1", state))
+	}
+	expectGateState(t, tier, "family-A", "gate-1", "")
+
+	if err := tier.SetGateState("family-A", "gate-1", feature.Deprecated); err != nil {
+		t.Fatal(err)
+	}
+	// Enabling the gate below the volume of its ramp does not raise the
+	// volume that the gate reaches, but raising the ramp does.
+	enableGate(t, tier, "family-A", "gate-1", "workspaces", 0.3, false)
+	ramp.Steps[0].Volume = 0.8
+	expectStateError(t, tier.RampGate("family-A", "gate-1", "workspaces", ramp))
+
+	enableGate(t, tier, "family-A", "gate-1", "workspaces", 0, false)
+	if err := tier.RampGate("family-A", "gate-1", "workspaces", feature.Ramp{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tier.SetGateState("family-A", "gate-1", feature.Removed); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testGateStateStrict(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	createGate(t, tier, "family-A", "gate-2", "workspaces", 1234)
+	enableGate(t, tier, "family-A", "gate-2", "workspaces", 0, true)
+
+	for _, state := range []feature.GateState{feature.Deprecated, feature.Removed} {
+		if err := tier.SetGateState("family-A", "gate-1", state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.GateOpenStrict("family-A", "gate-1", "workspaces", "1234"); err == nil {
+		t.Error("evaluating a removed gate in strict mode did not fail")
+	} else {
+		expectStateError(t, err)
+	}
+
+	open, err := c.GateOpenStrict("family-A", "gate-2", "workspaces", "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !open {
+		t.Error("family-A/gate-2 is not open")
+	}
+}
+
+func testGateStateInvalid(t *testing.T, path feature.MountPoint, tier *feature.Tier) {
+	file := filepath.Join(string(path), "standard", "1", "gates", "family-A", "gate-1", ".state")
+	if err := ioutil.WriteFile(file, []byte("shipped\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	refreshManifest(t, path)
+
+	expectProblems(t, string(path), validate(t, path), []string{
+		"standard/1/gates/family-A/gate-1/.state: error: read " + file + ": invalid gate state: \"shipped\"",
+		"standard/1/gates/family-A/gate-1/workspaces: warning: gate references collection \"workspaces\" which does not exist in the tier",
+	})
+}
+
+func expectGateState(t testing.TB, tier *feature.Tier, family, gate string, state feature.GateState) {
+	t.Helper()
+
+	found, err := tier.ReadGateState(family, gate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != state {
+		t.Errorf("gate state mismatch: want %q, got %q", state, found)
+	}
+}
+
+func expectStateError(t testing.TB, err error) {
+	t.Helper()
+
+	var stateErr *feature.StateError
+	if !errors.As(err, &stateErr) {
+		t.Errorf("expected a *feature.StateError, got %v", err)
+	}
+}
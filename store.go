@@ -2,6 +2,7 @@ package feature
 
 import (
 	"context"
+	"crypto/ed25519"
 	"log"
 	"os"
 	"path/filepath"
@@ -19,6 +20,10 @@ type Store struct {
 	join   sync.WaitGroup
 	done   chan struct{}
 	notify chan string
+	keys   []ed25519.PublicKey
+
+	mutex sync.Mutex
+	err   error
 }
 
 // Close closes the store, releasing all associated resources.
@@ -34,34 +39,92 @@ func (s *Store) GateOpen(family, gate, collection, id string) bool {
 	return s.cache.GateOpen(family, gate, collection, id)
 }
 
+// GateOpenKey is like GateOpen but evaluates the volume of gates which bucket
+// by the collection of key with the bucket of the key, see Cache.GateOpenKey.
+func (s *Store) GateOpenKey(family, gate, collection, id string, key Identifier) bool {
+	return s.cache.GateOpenKey(family, gate, collection, id, key)
+}
+
+// GateOpenStrict is like GateOpen but fails if the gate was removed, see
+// Cache.GateOpenStrict.
+func (s *Store) GateOpenStrict(family, gate, collection, id string) (bool, error) {
+	return s.cache.GateOpenStrict(family, gate, collection, id)
+}
+
+// GateMetadata returns the metadata of a gate, see Cache.GateMetadata.
+func (s *Store) GateMetadata(family, gate string) (GateMetadata, bool) {
+	return s.cache.GateMetadata(family, gate)
+}
+
+// GateExpired returns true if the expiry time of a gate has passed, see
+// Cache.GateExpired.
+func (s *Store) GateExpired(family, gate string) bool {
+	return s.cache.GateExpired(family, gate)
+}
+
+// ExpiredGates returns the list of gates which have expired, see
+// Cache.ExpiredGates.
+func (s *Store) ExpiredGates() []string {
+	return s.cache.ExpiredGates()
+}
+
 // LookupGates returns the list of open gates in a family for a given id.
 func (s *Store) LookupGates(family, collection, id string) []string {
 	return s.cache.LookupGates(family, collection, id)
 }
 
+// LookupGatesKey is like LookupGates but evaluates the volume of gates which
+// bucket by the collection of key with the bucket of the key, see
+// Cache.GateOpenKey.
+func (s *Store) LookupGatesKey(family, collection, id string, key Identifier) []string {
+	return s.cache.LookupGatesKey(family, collection, id, key)
+}
+
+// Err returns the error that occurred the last time the store attempted to
+// reload the feature database, or nil if it succeeded.
+//
+// When reloading fails (for example because the database was not signed by
+// any of the trusted keys), the store keeps serving the previously loaded
+// version of the database.
+func (s *Store) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err
+}
+
+func (s *Store) setErr(err error) {
+	s.mutex.Lock()
+	s.err = err
+	s.mutex.Unlock()
+}
+
 // The Open method opens the features at the mount point it was called on,
 // returning a Store object exposing the state.
 //
+// Trusted keys have the same meaning as in Load, they apply to the initial
+// load and to all the versions of the database that the store reloads.
+//
 // The returned store holds operating system resources and therefore must be
 // closed when the program does not need it anymore.
-func (path MountPoint) Open() (*Store, error) {
+func (path MountPoint) Open(keys ...ed25519.PublicKey) (*Store, error) {
 	notify := make(chan string)
 
 	if err := fs.Notify(notify, string(path)); err != nil {
 		return nil, err
 	}
 
-	c, err := path.Load()
+	c, err := path.Load(keys...)
 	if err != nil {
 		fs.Stop(notify)
 		return nil, err
 	}
 
 	s := &Store{
-		cache:  Cache{tiers: c.tiers},
 		done:   make(chan struct{}),
 		notify: notify,
+		keys:   keys,
 	}
+	s.cache.swap(c)
 
 	s.join.Add(1)
 	go path.watch(s)
@@ -81,9 +144,10 @@ func (path MountPoint) watch(s *Store) {
 				log.Printf("CRIT feature - %s - %s", path, err)
 			}
 			start := time.Now()
-			c, err := path.Load()
+			c, err := path.Load(s.keys...)
+			s.setErr(err)
 			if err != nil {
-				log.Printf("ERROR feature - %s - %s", path, err)
+				log.Printf("ERROR feature - %s - %s, keeping the previous version of the feature database", path, err)
 			} else {
 				log.Printf("NOTICE feature - %s - feature database reloaded in %gs", path, time.Since(start).Round(time.Millisecond).Seconds())
 				c = s.cache.swap(c)
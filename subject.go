@@ -0,0 +1,231 @@
+package feature
+
+import (
+	"sort"
+	"time"
+)
+
+// Identifier is the id of an entity in a collection.
+type Identifier struct {
+	Collection string
+	ID         string
+}
+
+// Subject is a set of identifiers of related entities which are evaluated
+// together, for example the write key, source, and workspace carried by a
+// request, so gates configured for any of their collections can be tested in
+// a single call.
+//
+// A subject has one id per collection, when a collection appears more than
+// once, only its first identifier is used.
+type Subject []Identifier
+
+// ID returns the id of the subject in a collection, and a boolean indicating
+// whether the subject had one.
+func (s Subject) ID(collection string) (string, bool) {
+	if i := s.index(collection); i >= 0 {
+		return s[i].ID, true
+	}
+	return "", false
+}
+
+func (s Subject) index(collection string) int {
+	for i := range s {
+		if s[i].Collection == collection {
+			return i
+		}
+	}
+	return -1
+}
+
+// subjectState carries the result of evaluating a gate for one identifier of
+// a subject, across all tiers.
+type subjectState struct {
+	configured bool // the gate has a configuration for the collection
+	listed     bool // the id is in the collection of at least one tier
+	opened     bool // one of the tiers opens the gate
+	closed     bool // one of the tiers lists the id and closes the gate
+}
+
+// GateOpenSubject returns true if a gate is open for a subject. The gate is
+// evaluated for each identifier of the subject whose collection it has a
+// configuration for, with the same rules as GateOpen, and the results are
+// combined as follows:
+//
+//   - collections listing the id of the subject take precedence over those
+//     where the gate applies its default state, which are ignored if at least
+//     one collection lists the id
+//   - among the remaining collections, the gate is open only if it is open for
+//     all of them, a closed result wins
+//   - the gate is closed if it has no configuration for any of the
+//     collections of the subject
+//
+// Gates which bucket by another collection (see Tier.SetGateBucketBy) compute
+// the bucket from the id of the subject in that collection, if it has one.
+// Prerequisites are evaluated for the same subject.
+//
+// Exposures are reported for each identifier of the subject that the gate has
+// a configuration for, with the state of the gate for the whole subject.
+//
+// A subject with a single identifier is evaluated like GateOpen, but unlike
+// GateOpen, the results are not cached.
+func (c *Cache) GateOpenSubject(family, gate string, subject Subject) bool {
+	family, gate = c.resolve(family, gate)
+	now := c.checkSchedule()
+
+	h := acquireBufferedHash64()
+	defer releaseBufferedHash64(h)
+
+	c.mutex.RLock()
+	open := c.evaluateSubject(gateName{family, gate}, subject, now, h)
+	c.mutex.RUnlock()
+
+	if x := c.exposures(); x != nil {
+		c.exposeSubject(x, family, gate, subject, open)
+	}
+	return open
+}
+
+// LookupGatesSubject returns the sorted list of gates in a family which are
+// open for a subject, using the rules of GateOpenSubject. Like LookupGates, the
+// gates are listed under their canonical names, except for gates which were
+// renamed into another family, which are listed under their former name.
+//
+// Unlike LookupGates, the results are not cached: each call evaluates all the
+// gates of the family configured for the collections of the subject, in all
+// tiers, so its cost grows with the number of gates times the number of tiers.
+// Programs evaluating the same subjects repeatedly on hot paths should prefer
+// LookupGates or LookupGatesKey.
+func (c *Cache) LookupGatesSubject(family string, subject Subject) []string {
+	now := c.checkSchedule()
+
+	h := acquireBufferedHash64()
+	defer releaseBufferedHash64(h)
+
+	var names, gates []string
+
+	c.mutex.RLock()
+	for i := range c.tiers {
+		for _, g := range c.tiers[i].gates[family] {
+			if subject.index(g.collection) >= 0 {
+				names = append(names, g.name)
+			}
+		}
+	}
+	if len(names) != 0 {
+		sort.Strings(names)
+		names = deduplicate(names)
+	}
+	for _, gate := range names {
+		if c.evaluateSubject(gateName{family, gate}, subject, now, h) {
+			gates = append(gates, gate)
+		}
+	}
+	for _, name := range c.moved[family] {
+		if c.evaluateSubject(c.aliasOf(name), subject, now, h) {
+			gates = append(gates, name.gate)
+		}
+	}
+	c.mutex.RUnlock()
+	sort.Strings(gates)
+
+	if x := c.exposures(); x != nil {
+		for _, gate := range names {
+			i := sort.SearchStrings(gates, gate)
+			c.exposeSubject(x, family, gate, subject, i < len(gates) && gates[i] == gate)
+		}
+	}
+	return gates
+}
+
+// evaluateSubject returns true if a gate and its prerequisites are open for a
+// subject. The cache mutex must be held.
+func (c *Cache) evaluateSubject(name gateName, subject Subject, now time.Time, h *bufferedHash64) bool {
+	// Subjects rarely have more than a few identifiers, the buffer avoids
+	// allocating the states in the common case.
+	var buffer [4]subjectState
+	states := buffer[:]
+	if len(subject) > len(buffer) {
+		states = make([]subjectState, len(subject))
+	}
+	states = states[:len(subject)]
+
+	for j, id := range subject {
+		if subject.index(id.Collection) != j {
+			continue
+		}
+		// Each identifier is evaluated like a lookup of the family, so the
+		// ids are assigned to the same buckets as with GateOpen.
+		state := &states[j]
+		c.evaluateGateTiers(name, id.Collection, id.ID, Identifier{}, subject, now, h, func(r tierResult) {
+			state.configured = true
+			switch {
+			case r.listed && r.open:
+				state.listed, state.opened = true, true
+			case r.listed:
+				state.listed, state.closed = true, true
+			case r.open:
+				state.opened = true
+			}
+		})
+	}
+
+	listed := false
+	for _, state := range states {
+		listed = listed || state.listed
+	}
+
+	open := false
+	for _, state := range states {
+		if !state.configured || (listed && !state.listed) {
+			continue
+		}
+		if !state.opened || state.closed {
+			return false
+		}
+		open = true
+	}
+	if !open {
+		return false
+	}
+
+	_, closed := c.closedSubjectPrerequisite(name, subject, now, h)
+	return !closed
+}
+
+// closedSubjectPrerequisite returns the first prerequisite of a gate which is
+// closed for a subject, like closedPrerequisite. The cache mutex must be held.
+func (c *Cache) closedSubjectPrerequisite(name gateName, subject Subject, now time.Time, h *bufferedHash64) (gateName, bool) {
+	for i := range c.tiers {
+		for _, p := range c.tiers[i].prerequisites[name] {
+			if p = c.aliasOf(p); !c.evaluateSubject(p, subject, now, h) {
+				return p, true
+			}
+		}
+	}
+	return gateName{}, false
+}
+
+func (c *Cache) exposeSubject(x *exposureLogger, family, gate string, subject Subject, open bool) {
+	for i, id := range subject {
+		if subject.index(id.Collection) != i {
+			continue
+		}
+		names := c.gateNames(family, id.Collection)
+		if j := sort.SearchStrings(names, gate); j < len(names) && names[j] == gate {
+			x.expose(c, family, gate, id.Collection, id.ID, Identifier{}, subject, open)
+		}
+	}
+}
+
+// GateOpenSubject returns true if a gate is open for a subject, see
+// Cache.GateOpenSubject.
+func (s *Store) GateOpenSubject(family, gate string, subject Subject) bool {
+	return s.cache.GateOpenSubject(family, gate, subject)
+}
+
+// LookupGatesSubject returns the list of open gates in a family for a subject,
+// see Cache.LookupGatesSubject.
+func (s *Store) LookupGatesSubject(family string, subject Subject) []string {
+	return s.cache.LookupGatesSubject(family, subject)
+}
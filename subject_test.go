@@ -0,0 +1,234 @@
+package feature_test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/feature"
+)
+
+func TestGateOpenSubject(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	path := feature.MountPoint(tmp)
+	createDatabase(t, path)
+
+	tier := createTier(t, path, "standard", "1")
+	defer tier.Close()
+
+	populateCollection(t, createCollection(t, tier, "write-keys"), []string{"wk-1"})
+	populateCollection(t, createCollection(t, tier, "sources"), []string{"src-1", "src-2"})
+	populateCollection(t, createCollection(t, tier, "workspaces"), []string{"ws-1"})
+
+	// gate-1 is open for the listed sources and closed for the listed
+	// workspaces.
+	createGate(t, tier, "family-A", "gate-1", "sources", 1234)
+	enableGate(t, tier, "family-A", "gate-1", "sources", 1, false)
+	createGate(t, tier, "family-A", "gate-1", "workspaces", 1234)
+	enableGate(t, tier, "family-A", "gate-1", "workspaces", 0, false)
+
+	// gate-2 is only configured for write keys, and open by default.
+	createGate(t, tier, "family-A", "gate-2", "write-keys", 1234)
+	enableGate(t, tier, "family-A", "gate-2", "write-keys", 0, true)
+
+	// gate-3 is open by default for sources, and closed by default for
+	// workspaces.
+	createGate(t, tier, "family-A", "gate-3", "sources", 1234)
+	enableGate(t, tier, "family-A", "gate-3", "sources", 0, true)
+	createGate(t, tier, "family-A", "gate-3", "workspaces", 1234)
+	enableGate(t, tier, "family-A", "gate-3", "workspaces", 0, false)
+
+	// gate-4 is open for the listed workspaces, and requires gate-2.
+	createGate(t, tier, "family-A", "gate-4", "workspaces", 1234)
+	enableGate(t, tier, "family-A", "gate-4", "workspaces", 1, false)
+	setPrerequisites(t, tier, "family-A", "gate-4", "family-A/gate-2")
+
+	// gate-5 buckets sources by workspace.
+	createGate(t, tier, "family-B", "gate-5", "sources", 1234)
+	enableGate(t, tier, "family-B", "gate-5", "sources", 0.5, false)
+	if err := tier.SetGateBucketBy("family-B", "gate-5", "sources", "workspaces"); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := path.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	subject := func(ids ...string) feature.Subject {
+		s := make(feature.Subject, 0, len(ids)/2)
+		for i := 0; i < len(ids); i += 2 {
+			s = append(s, feature.Identifier{Collection: ids[i], ID: ids[i+1]})
+		}
+		return s
+	}
+
+	tests := []struct {
+		scenario string
+		subject  feature.Subject
+		gates    []string
+	}{
+		{
+			scenario: "a closed result wins over an open result when both collections list the ids",
+			subject:  subject("sources", "src-1", "workspaces", "ws-1"),
+			gates:    nil,
+		},
+
+		{
+			scenario: "collections listing the ids take precedence over default states",
+			subject:  subject("sources", "src-1", "workspaces", "ws-2"),
+			gates:    []string{"gate-1"},
+		},
+
+		{
+			scenario: "a closed default state wins when no collection lists the ids",
+			subject:  subject("sources", "src-9", "workspaces", "ws-9"),
+			gates:    nil,
+		},
+
+		{
+			scenario: "collections which a gate has no configuration for are ignored",
+			subject:  subject("write-keys", "wk-9", "sources", "src-9"),
+			gates:    []string{"gate-2", "gate-3"},
+		},
+
+		{
+			scenario: "prerequisites are evaluated for the whole subject",
+			subject:  subject("workspaces", "ws-1", "write-keys", "wk-9"),
+			gates:    []string{"gate-2", "gate-4"},
+		},
+
+		{
+			scenario: "gates are closed when their prerequisites are not configured for the subject",
+			subject:  subject("workspaces", "ws-1"),
+			gates:    nil,
+		},
+
+		{
+			scenario: "only the first id of a collection is used",
+			subject:  subject("sources", "src-9", "sources", "src-1"),
+			gates:    []string{"gate-3"},
+		},
+
+		{
+			scenario: "empty subjects have no open gates",
+			subject:  nil,
+			gates:    nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if gates := c.LookupGatesSubject("family-A", test.subject); !reflect.DeepEqual(gates, test.gates) {
+				t.Errorf("gates mismatch: want %q, got %q", test.gates, gates)
+			}
+			for _, gate := range []string{"gate-1", "gate-2", "gate-3", "gate-4"} {
+				open := false
+				for _, g := range test.gates {
+					open = open || g == gate
+				}
+				if c.GateOpenSubject("family-A", gate, test.subject) != open {
+					t.Errorf("%s: state mismatch: want %t", gate, open)
+				}
+			}
+		})
+	}
+
+	t.Run("subjects with a single identifier are evaluated like GateOpen", func(t *testing.T) {
+		for _, id := range []feature.Identifier{
+			{"write-keys", "wk-1"}, {"write-keys", "wk-9"},
+			{"sources", "src-1"}, {"sources", "src-2"}, {"sources", "src-9"},
+			{"workspaces", "ws-1"}, {"workspaces", "ws-9"},
+		} {
+			s := feature.Subject{id}
+			if gates := c.LookupGatesSubject("family-A", s); !reflect.DeepEqual(gates, c.LookupGates("family-A", id.Collection, id.ID)) {
+				t.Errorf("%v: gates mismatch: want %q, got %q", id, c.LookupGates("family-A", id.Collection, id.ID), gates)
+			}
+		}
+	})
+
+	t.Run("gates bucketing by another collection use the id of the subject in that collection", func(t *testing.T) {
+		for _, src := range []string{"src-1", "src-2"} {
+			for _, ws := range []string{"ws-1", "ws-2", "ws-3", "ws-4"} {
+				open := c.GateOpenKey("family-B", "gate-5", "sources", src, feature.Identifier{Collection: "workspaces", ID: ws})
+				if c.GateOpenSubject("family-B", "gate-5", subject("sources", src, "workspaces", ws)) != open {
+					t.Errorf("%s/%s: state mismatch: want %t", src, ws, open)
+				}
+			}
+		}
+	})
+
+	t.Run("exposures of subjects are attributed using the id of the subject in the collection to bucket by", func(t *testing.T) {
+		// The gate is open for all the sources in the tier evaluated first, so
+		// the second tier determines the state whenever it closes the gate.
+		tier0 := createTier(t, path, "standard", "0")
+		defer tier0.Close()
+		populateCollection(t, createCollection(t, tier0, "sources"), []string{"src-1", "src-2"})
+		createGate(t, tier0, "family-B", "gate-5", "sources", 1234)
+		enableGate(t, tier0, "family-B", "gate-5", "sources", 1, false)
+
+		c, err := path.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		exposures := make(map[string]feature.Exposure)
+		c.SetExposureListener(feature.ExposureConfig{
+			Listener: feature.ExposureListenerFunc(func(e feature.Exposure) {
+				exposures[e.Collection+"/"+e.ID] = e
+			}),
+		})
+
+		for _, src := range []string{"src-1", "src-2"} {
+			for _, ws := range []string{"ws-1", "ws-2", "ws-3", "ws-4"} {
+				open := c.GateOpenSubject("family-B", "gate-5", subject("sources", src, "workspaces", ws))
+				tier := "1"
+				if open {
+					tier = "0"
+				}
+				if e := exposures["sources/"+src]; e.Open != open || e.Tier != tier {
+					t.Errorf("%s/%s: exposure mismatch: want open=%t tier=%s, got open=%t tier=%s", src, ws, open, tier, e.Open, e.Tier)
+				}
+			}
+		}
+	})
+
+	t.Run("renamed gates are listed like LookupGates lists them", func(t *testing.T) {
+		// gate-2 moves to another family, so it remains listed under its
+		// former name in family-A, while gate-3 is listed under its new name.
+		if err := path.RenameGate("family-A", "gate-2", "family-C", "gate-6"); err != nil {
+			t.Fatal(err)
+		}
+		if err := path.RenameGate("family-A", "gate-3", "family-A", "gate-7"); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := path.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		s := subject("write-keys", "wk-9", "sources", "src-9")
+		if gates, want := c.LookupGatesSubject("family-A", s), []string{"gate-2", "gate-7"}; !reflect.DeepEqual(gates, want) {
+			t.Errorf("gates mismatch: want %q, got %q", want, gates)
+		}
+		if gates, want := c.LookupGatesSubject("family-C", s), []string{"gate-6"}; !reflect.DeepEqual(gates, want) {
+			t.Errorf("gates mismatch: want %q, got %q", want, gates)
+		}
+
+		for _, id := range []feature.Identifier{{"write-keys", "wk-9"}, {"sources", "src-9"}} {
+			want := c.LookupGates("family-A", id.Collection, id.ID)
+			if gates := c.LookupGatesSubject("family-A", feature.Subject{id}); !reflect.DeepEqual(gates, want) {
+				t.Errorf("%v: gates mismatch: want %q, got %q", id, want, gates)
+			}
+		}
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 )
 
 type GroupIter struct{ dir }
@@ -48,19 +49,35 @@ func (tier *Tier) Name() string {
 }
 
 func (tier *Tier) CreateCollection(collection string) (*Collection, error) {
-	if err := mkdir(tier.pathTo("collections")); err != nil {
+	if err := ValidateName("collection", collection); err != nil {
 		return nil, err
 	}
-	f, err := os.OpenFile(tier.collectionPath(collection), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	path := tier.collectionPath(collection)
+	err := tier.update(path, func() error {
+		if err := mkdir(tier.pathTo("collections")); err != nil {
+			return err
+		}
+		_, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			err = writeFile(path, func(*os.File) error { return nil })
+		}
+		if err != nil {
+			return fmt.Errorf("creating collection %q: %w", collection, err)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("creating collection %q: %w", collection, err)
+		return nil, err
 	}
-	return &Collection{file: f}, nil
+	return &Collection{tier: tier, path: path}, nil
 }
 
 func (tier *Tier) OpenCollection(collection string) (*Collection, error) {
-	f, err := os.OpenFile(tier.collectionPath(collection), os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
+	if err := ValidateName("collection", collection); err != nil {
+		return nil, err
+	}
+	path := tier.collectionPath(collection)
+	if _, err := os.Lstat(path); err != nil {
 		if os.IsNotExist(err) {
 			// Make a special case so the caller can use os.IsNotExist to test
 			// the error.
@@ -68,11 +85,26 @@ func (tier *Tier) OpenCollection(collection string) (*Collection, error) {
 		}
 		return nil, fmt.Errorf("opening collection %q: %w", collection, err)
 	}
-	return &Collection{file: f}, nil
+	return &Collection{tier: tier, path: path}, nil
 }
 
 func (tier *Tier) DeleteCollection(collection string) error {
-	return unlink(tier.collectionPath(collection))
+	if err := ValidateName("collection", collection); err != nil {
+		return err
+	}
+	path := tier.collectionPath(collection)
+	return tier.update(path, func() error {
+		return unlink(path)
+	})
+}
+
+// CollectionRevision returns the revision of a collection, which can be passed
+// to the compare-and-set methods of Collection.
+func (tier *Tier) CollectionRevision(collection string) (string, error) {
+	if err := ValidateName("collection", collection); err != nil {
+		return "", err
+	}
+	return revision(tier.collectionPath(collection))
 }
 
 func (tier *Tier) Collections() *CollectionIter {
@@ -135,37 +167,218 @@ func (tier *Tier) gates(collection, id string) (string, dir) {
 }
 
 func (tier *Tier) CreateGate(family, name, collection string, salt uint32) error {
-	if err := mkdir(tier.pathTo("gates")); err != nil {
+	if err := validateGateNames(family, name, collection); err != nil {
 		return err
 	}
-	if err := mkdir(tier.familyPath(family)); err != nil {
-		return err
+	path := tier.gateCollectionPath(family, name, collection)
+	return tier.update(tier.gatePath(family, name), func() error {
+		if err := mkdir(tier.pathTo("gates")); err != nil {
+			return err
+		}
+		if err := tier.expectNoAlias(family, name); err != nil {
+			return err
+		}
+		if err := mkdir(tier.familyPath(family)); err != nil {
+			return err
+		}
+		if err := mkdir(tier.gatePath(family, name)); err != nil {
+			return err
+		}
+		// The creation time of the gate is recorded the first time it is
+		// created in the tier, for any collection.
+		if _, err := os.Lstat(tier.metadataPath(family, name)); os.IsNotExist(err) {
+			if err := writeMetadata(tier.metadataPath(family, name), GateMetadata{Created: time.Now()}); err != nil {
+				return err
+			}
+		}
+		if err := writeGate(path, gate{
+			salt: strconv.FormatUint(uint64(salt), 10),
+		}); err != nil {
+			return err
+		}
+		return tier.recordRollout(family, name, time.Now())
+	})
+}
+
+// EnableGate sets the volume and default open state of a gate. The method
+// returns a *StateError if the lifecycle state of the gate does not allow the
+// change (see GateState).
+func (tier *Tier) EnableGate(family, name, collection string, volume float64, open bool) error {
+	return tier.CompareAndEnableGate(family, name, collection, volume, open, "")
+}
+
+// CompareAndEnableGate is like EnableGate but fails with a *ConflictError if
+// the revision of the gate differs from the one passed as argument, which is
+// usually obtained by calling ReadGateRevision. An empty revision matches any
+// revision of the gate.
+func (tier *Tier) CompareAndEnableGate(family, name, collection string, volume float64, open bool, revision string) error {
+	return tier.CompareAndConfigureGate(family, name, collection, GateConfig{Volume: volume, Open: open}, revision)
+}
+
+// GateConfig is the configuration of a gate for a collection which is written
+// by CompareAndConfigureGate. The volume and default open state are always
+// set, the zero values of the other fields leave the current settings of the
+// gate unchanged.
+type GateConfig struct {
+	Volume float64
+	Open   bool
+
+	// The number of buckets of the gate, see SetGateBuckets.
+	Buckets uint64
+
+	// The name of the hash algorithm of the gate, see SetGateHash.
+	Hash string
+
+	// The collection that the gate buckets by, see SetGateBucketBy. Setting
+	// ClearBucketBy removes it instead.
+	BucketBy      string
+	ClearBucketBy bool
+}
+
+func (config *GateConfig) validate() error {
+	if config.Hash != "" {
+		if _, ok := LookupHash(config.Hash); !ok {
+			return fmt.Errorf("unknown hash algorithm: %q", config.Hash)
+		}
 	}
-	if err := mkdir(tier.gatePath(family, name)); err != nil {
+	if config.BucketBy != "" {
+		if config.ClearBucketBy {
+			return fmt.Errorf("the collection that the gate buckets by cannot be both set and cleared")
+		}
+		if err := ValidateName("collection", config.BucketBy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CompareAndConfigureGate is like CompareAndEnableGate but also changes the
+// bucketing settings of the gate, all the changes are written at once after
+// comparing the revision.
+func (tier *Tier) CompareAndConfigureGate(family, name, collection string, config GateConfig, revision string) error {
+	if err := validateGateNames(family, name, collection); err != nil {
 		return err
 	}
-	return writeGate(tier.gateCollectionPath(family, name, collection), gate{
-		salt: strconv.FormatUint(uint64(salt), 10),
+	if err := config.validate(); err != nil {
+		return fmt.Errorf("%s/%s: %w", family, name, err)
+	}
+	path := tier.gateCollectionPath(family, name, collection)
+	// The whole gate directory is updated since the rollout time is recorded
+	// in the metadata of the gate.
+	return tier.update(tier.gatePath(family, name), func() error {
+		if err := compareRevision(path, revision); err != nil {
+			return err
+		}
+		g, err := readGate(path)
+		if err != nil {
+			return err
+		}
+		state, err := readState(tier.statePath(family, name))
+		if err != nil {
+			return err
+		}
+		next := g
+		next.open, next.volume = config.Open, config.Volume
+		if err := state.checkEnable(family, name, g, next); err != nil {
+			return err
+		}
+		g = next
+		if config.Buckets != 0 {
+			g.buckets = config.Buckets
+		}
+		if config.Hash != "" {
+			g.hash = config.Hash
+		}
+		if config.BucketBy != "" || config.ClearBucketBy {
+			g.bucketBy = config.BucketBy
+		}
+		if err := tier.writeGate(path, g); err != nil {
+			return err
+		}
+		return tier.recordRollout(family, name, time.Now())
 	})
 }
 
-func (tier *Tier) EnableGate(family, name, collection string, volume float64, open bool) error {
-	path := tier.gateCollectionPath(family, name, collection)
-	g, err := readGate(path)
-	if err != nil {
-		return err
+// SetGateBuckets sets the number of buckets that ids are hashed into to
+// evaluate the volume of a gate, which defines the granularity of the volume:
+// 10000 buckets allow volumes in increments of 0.01%. Setting DefaultBuckets
+// restores the historical algorithm.
+//
+// Changing the number of buckets of a gate changes which ids are admitted at a
+// given volume, it is best done before the gate is rolled out.
+func (tier *Tier) SetGateBuckets(family, name, collection string, buckets uint64) error {
+	if buckets == 0 {
+		return fmt.Errorf("%s/%s: the number of buckets must be positive", family, name)
+	}
+	return tier.updateGate(family, name, collection, func(g *gate) { g.buckets = buckets })
+}
+
+// ReadGateBuckets returns the number of buckets that ids are hashed into to
+// evaluate the volume of a gate.
+func (tier *Tier) ReadGateBuckets(family, name, collection string) (uint64, error) {
+	if err := validateGateNames(family, name, collection); err != nil {
+		return 0, err
 	}
-	g.open, g.volume = open, volume
-	return writeGate(path, g)
+	g, err := readGate(tier.gateCollectionPath(family, name, collection))
+	return g.bucketCount(), err
+}
+
+// SetGateBucketBy declares the collection whose ids a gate buckets by when it
+// is evaluated with a bucketing key, which keeps volume rollouts consistent
+// across related entities (e.g. all sources of a workspace). An empty
+// collection name removes the declaration, and the gate buckets by the ids it
+// is evaluated for.
+func (tier *Tier) SetGateBucketBy(family, name, collection, bucketBy string) error {
+	if bucketBy != "" {
+		if err := ValidateName("collection", bucketBy); err != nil {
+			return err
+		}
+	}
+	return tier.updateGate(family, name, collection, func(g *gate) { g.bucketBy = bucketBy })
+}
+
+// ReadGateBucketBy returns the name of the collection whose ids a gate buckets
+// by, or an empty string if the gate buckets by the ids it is evaluated for.
+func (tier *Tier) ReadGateBucketBy(family, name, collection string) (string, error) {
+	if err := validateGateNames(family, name, collection); err != nil {
+		return "", err
+	}
+	g, err := readGate(tier.gateCollectionPath(family, name, collection))
+	return g.bucketBy, err
 }
 
 func (tier *Tier) ReadGate(family, name, collection string) (open bool, salt string, volume float64, err error) {
+	if err = validateGateNames(family, name, collection); err != nil {
+		return
+	}
 	g, err := readGate(tier.gateCollectionPath(family, name, collection))
 	return g.open, g.salt, g.volume, err
 }
 
+// ReadGateRevision is like ReadGate but also returns the revision of the gate,
+// which can be passed to CompareAndEnableGate.
+func (tier *Tier) ReadGateRevision(family, name, collection string) (open bool, salt string, volume float64, rev string, err error) {
+	if err = validateGateNames(family, name, collection); err != nil {
+		return
+	}
+	path := tier.gateCollectionPath(family, name, collection)
+	// Read the revision first, so the gate may only be more recent than the
+	// revision, which results in a conflict rather than a lost update.
+	if rev, err = revision(path); err != nil {
+		return
+	}
+	g, err := readGate(path)
+	return g.open, g.salt, g.volume, rev, err
+}
+
 func (tier *Tier) DeleteGate(family, name, collection string) error {
-	return rmdir(tier.gateCollectionPath(family, name, collection))
+	if err := validateGateNames(family, name, collection); err != nil {
+		return err
+	}
+	path := tier.gateCollectionPath(family, name, collection)
+	return tier.update(path, func() error {
+		return rmdir(path)
+	})
 }
 
 func (tier *Tier) familyPath(family string) string {
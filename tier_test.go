@@ -1,8 +1,11 @@
 package feature_test
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -38,6 +41,31 @@ func TestTier(t *testing.T) {
 			scenario: "ids added to a collection are exposed when listing ids",
 			function: testTierCollectionAddAndList,
 		},
+
+		{
+			scenario: "ids removed from a collection are not exposed when listing ids",
+			function: testTierCollectionRemoveAndList,
+		},
+
+		{
+			scenario: "updating collections does not leave temporary files behind",
+			function: testTierCollectionNoTemporaryFiles,
+		},
+
+		{
+			scenario: "hidden files are not exposed when listing collections",
+			function: testTierCollectionHiddenFiles,
+		},
+
+		{
+			scenario: "collection updates with a stale revision fail with a conflict",
+			function: testTierCollectionCompareAndSync,
+		},
+
+		{
+			scenario: "gate updates with a stale revision fail with a conflict",
+			function: testTierCompareAndEnableGate,
+		},
 	}
 
 	for _, test := range tests {
@@ -120,6 +148,129 @@ func testTierCollectionAddAndList(t *testing.T, tier *feature.Tier) {
 	})
 }
 
+func testTierCollectionRemoveAndList(t *testing.T, tier *feature.Tier) {
+	col := createCollection(t, tier, "collection")
+	defer col.Close()
+
+	populateCollection(t, col, []string{
+		"id-1",
+		"id-2",
+		"id-3",
+	})
+
+	if err := col.Remove("id-2", "id-4"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectIDs(t, tier, "collection", []string{
+		"id-1",
+		"id-3",
+	})
+}
+
+func testTierCollectionNoTemporaryFiles(t *testing.T, tier *feature.Tier) {
+	col := createCollection(t, tier, "collection")
+	defer col.Close()
+
+	populateCollection(t, col, []string{"id-1", "id-2"})
+	populateCollection(t, col, []string{"id-3"})
+
+	if err := col.Remove("id-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(filepath.Dir(col.Path()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range files {
+		if f.Name() != "collection" {
+			t.Errorf("unexpected file in collections directory: %s", f.Name())
+		}
+	}
+}
+
+func testTierCollectionHiddenFiles(t *testing.T, tier *feature.Tier) {
+	col := createCollection(t, tier, "collection")
+	defer col.Close()
+
+	hidden := filepath.Join(filepath.Dir(col.Path()), ".collection.tmp-1234")
+	if err := ioutil.WriteFile(hidden, []byte("id-1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expectCollections(t, tier, []string{"collection"})
+}
+
+func testTierCollectionCompareAndSync(t *testing.T, tier *feature.Tier) {
+	col := createCollection(t, tier, "collection")
+	defer col.Close()
+
+	rev, err := tier.CollectionRevision("collection")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	populateCollection(t, col, []string{"id-1"})
+	col.Add("id-2")
+
+	err = col.CompareAndSync(rev)
+	conflict := new(feature.ConflictError)
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+
+	if rev, err = col.Revision(); err != nil {
+		t.Fatal(err)
+	}
+	if conflict.Current != rev {
+		t.Errorf("current revision mismatch: want %s, got %s", rev, conflict.Current)
+	}
+
+	if err := col.CompareAndRemove(rev, "id-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectIDs(t, tier, "collection", []string{
+		"id-2",
+	})
+
+	// The revision is compared even if there are no ids to sync.
+	if err := col.CompareAndSync(rev); !errors.As(err, &conflict) {
+		t.Errorf("expected a conflict error with no pending ids, got %v", err)
+	}
+}
+
+func testTierCompareAndEnableGate(t *testing.T, tier *feature.Tier) {
+	if err := tier.CreateGate("family-A", "gate-1", "collection", 1234); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, _, rev, err := tier.ReadGateRevision("family-A", "gate-1", "collection")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tier.CompareAndEnableGate("family-A", "gate-1", "collection", 0.5, false, rev); err != nil {
+		t.Fatal(err)
+	}
+
+	err = tier.CompareAndEnableGate("family-A", "gate-1", "collection", 1, true, rev)
+	conflict := new(feature.ConflictError)
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+
+	open, _, volume, _, err := tier.ReadGateRevision("family-A", "gate-1", "collection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if open || volume != 0.5 {
+		t.Errorf("gate was modified despite the conflict: open=%t volume=%g", open, volume)
+	}
+}
+
 func createCollection(t testing.TB, tier *feature.Tier, collection string) *feature.Collection {
 	t.Helper()
 
@@ -172,3 +323,12 @@ func populateCollection(t testing.TB, col *feature.Collection, ids []string) {
 		t.Error(err)
 	}
 }
+
+// makeIDs returns n ids formatted with their index, e.g. "id-%03d".
+func makeIDs(format string, n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf(format, i)
+	}
+	return ids
+}
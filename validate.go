@@ -0,0 +1,565 @@
+package feature
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Severity represents the severity of problems found when validating feature
+// databases.
+type Severity int
+
+const (
+	// Warning is the severity of problems that do not prevent the database
+	// from being loaded, but indicate that it was not produced correctly.
+	Warning Severity = iota
+	// Error is the severity of problems that prevent the database from being
+	// loaded, or cause gates to be evaluated incorrectly.
+	Error
+)
+
+// String returns a human-readable representation of s.
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	case Off:
+		return "off"
+	default:
+		return "Severity(" + strconv.Itoa(int(s)) + ")"
+	}
+}
+
+// Problem represents a problem found when validating a feature database.
+type Problem struct {
+	// The path to the file or directory where the problem was found.
+	Path string
+
+	// The line where the problem was found, or zero if the problem does not
+	// apply to a specific line.
+	Line int
+
+	// The severity of the problem.
+	Severity Severity
+
+	// A description of the problem.
+	Message string
+
+	// The name of the lint rule which reported the problem, empty for problems
+	// reported by Validate.
+	Rule string
+
+	fix func() error
+}
+
+// String returns a representation of p formatted as "path:line: severity: message",
+// followed by the name of the rule in brackets for lint problems.
+func (p Problem) String() string {
+	s := p.Path
+	if p.Line != 0 {
+		s += ":" + strconv.Itoa(p.Line)
+	}
+	s += ": " + p.Severity.String() + ": " + p.Message
+	if p.Rule != "" {
+		s += " [" + p.Rule + "]"
+	}
+	return s
+}
+
+// Fixable returns true if the problem can be fixed by calling Fix.
+func (p Problem) Fixable() bool {
+	return p.fix != nil
+}
+
+// Fix attempts to fix the problem, modifying the database in place.
+func (p Problem) Fix() error {
+	if p.fix == nil {
+		return fmt.Errorf("%s: problem cannot be fixed automatically: %s", p.Path, p.Message)
+	}
+	return p.fix()
+}
+
+// Validate walks the feature database at the mount point and returns the list
+// of problems that were found. The returned error is only non-nil if the
+// database could not be walked, problems found in the database are never
+// reported as errors.
+//
+// Validate reports structural problems (unexpected files or directories,
+// invalid names), parse errors in gate files with the line where they were
+// found, out-of-range values, duplicate keys, unknown keys which look like
+// misspelled known keys, duplicate or unsorted ids in
+// collections, gates referencing collections that do not exist in their tier,
+// temporary files left behind by interrupted updates, and files which do not
+// match the manifest of the database. Databases using a layout version which
+// is not supported by the package are reported as a single problem.
+func (path MountPoint) Validate() ([]Problem, error) {
+	v := &validator{format: MinFormatVersion}
+
+	root, err := filepath.EvalSymlinks(string(path))
+	if err != nil {
+		return nil, err
+	}
+
+	if m, err := MountPoint(root).ReadManifest(); err == nil {
+		// The rest of the database cannot be validated if its layout is not
+		// understood by the package.
+		if err := checkFormat(root, m.Format); err != nil {
+			v.report(filepath.Join(root, manifestFile), 0, Error, nil, "%s", err.(*FormatError).reason())
+			return v.problems, nil
+		}
+		v.format = m.Format
+		if err := m.check(root, func(e *ManifestError) {
+			v.report(filepath.Join(root, e.Path), 0, Error, nil, "%s", e.Reason)
+		}); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		v.report(filepath.Join(root, manifestFile), 0, Error, nil, "%s", err)
+	}
+
+	if err := v.walk(root, func(group string, info os.FileInfo) error {
+		if !v.expectDir(filepath.Join(root, group), "group", info) {
+			return nil
+		}
+		return v.walk(filepath.Join(root, group), func(tier string, info os.FileInfo) error {
+			if !v.expectDir(filepath.Join(root, group, tier), "tier", info) {
+				return nil
+			}
+			return v.validateTier(&Tier{path: MountPoint(root), group: group, name: tier})
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return v.problems, nil
+}
+
+type validator struct {
+	format   int
+	problems []Problem
+}
+
+func (v *validator) report(path string, line int, severity Severity, fix func() error, msg string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{
+		Path:     path,
+		Line:     line,
+		Severity: severity,
+		Message:  fmt.Sprintf(msg, args...),
+		fix:      fix,
+	})
+}
+
+// walk calls do for each entry of the directory at path. Hidden entries are
+// not passed to do, internal files are ignored and other hidden entries are
+// reported as leftover temporary files.
+func (v *validator) walk(path string, do func(string, os.FileInfo) error) error {
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		name := f.Name()
+		p := filepath.Join(path, name)
+
+		if isHidden(name) {
+			if !internalFiles[name] {
+				v.report(p, 0, Warning, func() error { return rmdir(p) },
+					"leftover temporary file")
+			}
+			continue
+		}
+
+		if err := do(name, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// internalFiles is the set of hidden file names used by the package, which
+// are not reported as leftover temporary files.
+var internalFiles = map[string]bool{
+	".lock":           true,
+	manifestFile:      true,
+	manifestLockFile:  true,
+	signatureFile:     true,
+	metadataFile:      true,
+	stateFile:         true,
+	aliasesFile:       true,
+	prerequisitesFile: true,
+}
+
+func (v *validator) expectDir(path, kind string, info os.FileInfo) bool {
+	if err := ValidateName(kind, info.Name()); err != nil {
+		v.report(path, 0, Error, nil, "%s", err)
+		return false
+	}
+	if !info.IsDir() {
+		v.report(path, 0, Error, nil, "%s is not a directory", kind)
+		return false
+	}
+	return true
+}
+
+func (v *validator) expectFile(path, kind string, info os.FileInfo) bool {
+	if err := ValidateName(kind, info.Name()); err != nil {
+		v.report(path, 0, Error, nil, "%s", err)
+		return false
+	}
+	if !info.Mode().IsRegular() {
+		v.report(path, 0, Error, nil, "%s is not a regular file", kind)
+		return false
+	}
+	return true
+}
+
+func (v *validator) validateTier(tier *Tier) error {
+	collections := make(map[string]bool)
+
+	if err := v.walk(tier.pathTo(""), func(name string, info os.FileInfo) error {
+		switch name {
+		case "collections", "gates":
+			if !info.IsDir() {
+				v.report(tier.pathTo(name), 0, Error, nil, "%s is not a directory", name)
+			}
+		default:
+			v.report(tier.pathTo(name), 0, Warning, nil, "unexpected entry in tier directory")
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := v.walkIfExist(tier.pathTo("collections"), func(name string, info os.FileInfo) error {
+		path := tier.collectionPath(name)
+		if v.expectFile(path, "collection", info) {
+			collections[name] = true
+			return v.validateCollection(tier, path)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	v.validateAliases(tier)
+
+	if graph, err := tier.prerequisites(); err == nil {
+		if cycle := findCycle(graph); cycle != nil {
+			v.report(tier.pathTo("gates"), 0, Error, nil, "%s", cycle)
+		}
+	}
+
+	return v.walkIfExist(tier.pathTo("gates"), func(family string, info os.FileInfo) error {
+		if !v.expectDir(tier.familyPath(family), "family", info) {
+			return nil
+		}
+		return v.walk(tier.familyPath(family), func(gate string, info os.FileInfo) error {
+			if !v.expectDir(tier.gatePath(family, gate), "gate", info) {
+				return nil
+			}
+			if _, err := readMetadata(tier.metadataPath(family, gate)); err != nil {
+				v.report(tier.metadataPath(family, gate), 0, Error, nil, "%s", err)
+			}
+			if _, err := readState(tier.statePath(family, gate)); err != nil {
+				v.report(tier.statePath(family, gate), 0, Error, nil, "%s", err)
+			}
+			if _, err := readPrerequisites(tier.prerequisitesPath(family, gate)); err != nil {
+				v.report(tier.prerequisitesPath(family, gate), 0, Error, nil, "%s", err)
+			}
+			return v.walk(tier.gatePath(family, gate), func(collection string, info os.FileInfo) error {
+				path := tier.gateCollectionPath(family, gate, collection)
+				if !v.expectFile(path, "collection", info) {
+					return nil
+				}
+				if !collections[collection] {
+					fix := func() error {
+						c, err := tier.CreateCollection(collection)
+						if err != nil {
+							return err
+						}
+						return c.Close()
+					}
+					v.report(path, 0, Warning, fix, "gate references collection %q which does not exist in the tier", collection)
+				}
+				return v.validateGate(tier, path)
+			})
+		})
+	})
+}
+
+// validateAliases reports aliases which cannot be parsed, shadow gates of the
+// tier, or point to gates which do not exist.
+func (v *validator) validateAliases(tier *Tier) {
+	path := tier.aliasesPath()
+	aliases, err := readAliases(path)
+	if err != nil {
+		v.report(path, 0, Error, nil, "%s", err)
+		return
+	}
+	for _, a := range aliases {
+		if _, err := os.Stat(tier.gatePath(a.Family, a.Gate)); err == nil {
+			v.report(path, 0, Warning, nil, "alias %s/%s has the name of a gate of the tier", a.Family, a.Gate)
+		}
+		if _, err := os.Stat(tier.gatePath(a.TargetFamily, a.TargetGate)); os.IsNotExist(err) {
+			v.report(path, 0, Warning, nil, "alias %s/%s points to gate %s/%s which does not exist in the tier", a.Family, a.Gate, a.TargetFamily, a.TargetGate)
+		}
+	}
+}
+
+// walkIfExist is like walk but does nothing if path is not a directory, which
+// validateTier already reported.
+func (v *validator) walkIfExist(path string, do func(string, os.FileInfo) error) error {
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return err
+	}
+	return v.walk(path, do)
+}
+
+func (v *validator) validateCollection(tier *Tier, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	fix := func() error { return tier.update(path, func() error { return sortCollection(path) }) }
+	// Starting with format version 2, readers may rely on collections being
+	// sorted and deduplicated.
+	severity := Warning
+	if v.format >= 2 {
+		severity = Error
+	}
+	seen := make(map[string]int)
+	prev := ""
+	sorted := true
+	line := 0
+
+	forEachLine(b, func(i, n int) {
+		line++
+		id := string(b[i : i+n])
+
+		switch {
+		case id == "":
+			v.report(path, line, Warning, fix, "empty line")
+			return
+		case seen[id] != 0:
+			v.report(path, line, severity, fix, "duplicate id %q (first seen on line %d)", id, seen[id])
+			return
+		}
+
+		if sorted && id < prev {
+			v.report(path, line, severity, fix, "collection is not sorted, id %q is out of order", id)
+			sorted = false
+		}
+
+		seen[id], prev = line, id
+	})
+
+	return nil
+}
+
+// sortCollection rewrites the collection at path with its ids sorted and
+// deduplicated, and empty lines removed.
+func sortCollection(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, 64)
+	forEachLine(b, func(i, n int) {
+		if n != 0 {
+			ids = append(ids, string(b[i:i+n]))
+		}
+	})
+	sort.Strings(ids)
+
+	return writeFile(path, func(f *os.File) error {
+		w := bufio.NewWriter(f)
+		for i, id := range ids {
+			if i == 0 || id != ids[i-1] {
+				w.WriteString(id)
+				w.WriteByte('\n')
+			}
+		}
+		return w.Flush()
+	})
+}
+
+func (v *validator) validateGate(tier *Tier, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]int)
+	line := 0
+	var start, end time.Time
+
+	forEachLine(b, func(i, n int) {
+		line++
+		k, val := splitKeyValue(bytes.TrimSpace(b[i : i+n]))
+		key := string(k)
+
+		if key == "" || key[0] == '#' {
+			return
+		}
+		if seen[key] != 0 {
+			v.report(path, line, Warning, nil, "duplicate key %q (first seen on line %d)", key, seen[key])
+		}
+		seen[key] = line
+
+		if format := gateKeyFormats[key]; format > v.format {
+			v.report(path, line, Error, nil, "the %q key requires format version %d, but the database uses version %d", key, format, v.format)
+		}
+
+		switch key {
+		case "open":
+			if _, err := strconv.ParseBool(string(val)); err != nil {
+				v.report(path, line, Error, nil, "invalid value of %q: %q is not a boolean", key, val)
+			}
+		case "salt":
+			if len(val) == 0 {
+				v.report(path, line, Warning, nil, "empty salt")
+			}
+		case "volume":
+			f, err := strconv.ParseFloat(string(val), 64)
+			switch {
+			case err != nil:
+				v.report(path, line, Error, nil, "invalid value of %q: %q is not a number", key, val)
+			case f < 0 || f > 1:
+				v.report(path, line, Error, func() error { return tier.update(path, func() error { return clampVolume(path) }) },
+					"volume out of range: %g is not between 0 and 1", f)
+			}
+		case "start", "end":
+			t, err := time.Parse(time.RFC3339, string(val))
+			switch {
+			case err != nil:
+				v.report(path, line, Error, nil, "invalid value of %q: %q is not a RFC3339 time", key, val)
+			case key == "start":
+				start = t
+			default:
+				end = t
+			}
+		case "buckets":
+			if _, err := parseBuckets(string(val)); err != nil {
+				v.report(path, line, Error, nil, "invalid value of %q: %q is not a positive integer", key, val)
+			}
+		case "hash":
+			// Programs may register hash algorithms which are unknown here, so
+			// the problem is only a warning, but the gate is closed in
+			// programs which did not register it.
+			if _, ok := LookupHash(string(val)); !ok {
+				v.report(path, line, Warning, nil, "unknown hash algorithm %q, the gate is closed in programs which did not register it", val)
+			}
+		case "bucket-by":
+			collection := string(val)
+			switch {
+			case ValidateName("collection", collection) != nil:
+				v.report(path, line, Error, nil, "invalid value of %q: %q is not a valid collection name", key, val)
+			case collection == filepath.Base(path):
+				v.report(path, line, Warning, nil, "the gate buckets by its own collection %q", collection)
+			default:
+				if _, err := os.Stat(tier.collectionPath(collection)); os.IsNotExist(err) {
+					v.report(path, line, Warning, nil, "the gate buckets by collection %q which does not exist in the tier", collection)
+				}
+			}
+		case "ramp":
+			r, err := parseRamp(string(val))
+			switch {
+			case err != nil:
+				v.report(path, line, Error, nil, "%s", err)
+			case r.decreasing():
+				v.report(path, line, Warning, nil, "the volume of the ramp decreases, ids admitted earlier will be excluded")
+			}
+		default:
+			// Other keys are attributes preserved for other tools, but a key
+			// which is a small edit away from a known key is most likely a
+			// typo which leaves the gate with the default value of that key.
+			if known := similarGateKey(key); known != "" {
+				v.report(path, line, Warning, nil, "unknown key %q, did you mean %q?", key, known)
+			}
+		}
+	})
+
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		v.report(path, seen["end"], Error, nil, "the schedule ends at %s before it starts at %s", end.Format(time.RFC3339), start.Format(time.RFC3339))
+	}
+
+	if seen["salt"] == 0 {
+		v.report(path, 0, Warning, nil, "missing salt")
+	}
+	return nil
+}
+
+// similarGateKey returns the known gate key which key is likely a misspelling
+// of, or an empty string if there are none. Keys of up to four letters must be
+// within one edit of a known key, longer keys within two.
+func similarGateKey(key string) string {
+	for _, known := range gateKeys {
+		max := 2
+		if len(known) <= 4 {
+			max = 1
+		}
+		if editDistance(key, known) <= max {
+			return known
+		}
+	}
+	return ""
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		diag := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d := diag + cost
+			if row[j]+1 < d {
+				d = row[j] + 1
+			}
+			if row[j-1]+1 < d {
+				d = row[j-1] + 1
+			}
+			diag, row[j] = row[j], d
+		}
+	}
+	return row[len(b)]
+}
+
+// clampVolume rewrites the gate at path with its volume clamped to [0, 1].
+func clampVolume(path string) error {
+	g, err := readGate(path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case g.volume < 0:
+		g.volume = 0
+	case g.volume > 1:
+		g.volume = 1
+	}
+	return writeGate(path, g)
+}
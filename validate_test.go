@@ -0,0 +1,198 @@
+package feature_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/feature"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		scenario string
+		files    map[string]string
+		problems []string
+		fixed    []string
+	}{
+		{
+			scenario: "valid databases have no problems",
+			files: map[string]string{
+				"standard/1/collections/workspaces":           "id-1\nid-2\n",
+				"standard/1/gates/family-A/gate-1/workspaces": "open\ttrue\nsalt\t1234\nvolume\t0.5\n",
+				"standard/1/.lock":                            "",
+			},
+		},
+
+		{
+			scenario: "parse errors are reported with the line where they were found",
+			files: map[string]string{
+				"standard/1/collections/workspaces":           "",
+				"standard/1/gates/family-A/gate-1/workspaces": "open\ttrue\nsalt\t1234\nvolume\t0.5x\n",
+			},
+			problems: []string{
+				`standard/1/gates/family-A/gate-1/workspaces:3: error: invalid value of "volume": "0.5x" is not a number`,
+			},
+			fixed: []string{
+				`standard/1/gates/family-A/gate-1/workspaces:3: error: invalid value of "volume": "0.5x" is not a number`,
+			},
+		},
+
+		{
+			scenario: "out of range volumes are clamped",
+			files: map[string]string{
+				"standard/1/collections/workspaces":           "",
+				"standard/1/gates/family-A/gate-1/workspaces": "open\ttrue\nsalt\t1234\nvolume\t1.5\n",
+			},
+			problems: []string{
+				`standard/1/gates/family-A/gate-1/workspaces:3: error: volume out of range: 1.5 is not between 0 and 1`,
+			},
+		},
+
+		{
+			scenario: "duplicate keys, misspelled keys and missing salts are reported, attributes and comments are not",
+			files: map[string]string{
+				"standard/1/collections/workspaces":           "",
+				"standard/1/gates/family-A/gate-1/workspaces": "# comment\nopen\ttrue\nvolume\t1\ncolor\tred\nopen\tfalse\nvolme\t0.5\nowner\tteam-A\n",
+			},
+			problems: []string{
+				`standard/1/gates/family-A/gate-1/workspaces:5: warning: duplicate key "open" (first seen on line 2)`,
+				`standard/1/gates/family-A/gate-1/workspaces:6: warning: unknown key "volme", did you mean "volume"?`,
+				`standard/1/gates/family-A/gate-1/workspaces: warning: missing salt`,
+			},
+			fixed: []string{
+				`standard/1/gates/family-A/gate-1/workspaces:5: warning: duplicate key "open" (first seen on line 2)`,
+				`standard/1/gates/family-A/gate-1/workspaces:6: warning: unknown key "volme", did you mean "volume"?`,
+				`standard/1/gates/family-A/gate-1/workspaces: warning: missing salt`,
+			},
+		},
+
+		{
+			scenario: "duplicate and unsorted ids are fixed by sorting collections",
+			files: map[string]string{
+				"standard/1/collections/workspaces": "id-2\nid-1\nid-2\n",
+			},
+			problems: []string{
+				`standard/1/collections/workspaces:2: warning: collection is not sorted, id "id-1" is out of order`,
+				`standard/1/collections/workspaces:3: warning: duplicate id "id-2" (first seen on line 1)`,
+			},
+		},
+
+		{
+			scenario: "gates referencing missing collections and leftover temporary files are fixed",
+			files: map[string]string{
+				"standard/1/collections/.workspaces.tmp-1234": "id-1\n",
+				"standard/1/gates/family-A/gate-1/workspaces": "open\ttrue\nsalt\t1234\nvolume\t1\n",
+			},
+			problems: []string{
+				`standard/1/collections/.workspaces.tmp-1234: warning: leftover temporary file`,
+				`standard/1/gates/family-A/gate-1/workspaces: warning: gate references collection "workspaces" which does not exist in the tier`,
+			},
+		},
+
+		{
+			scenario: "unexpected files in the tree are reported",
+			files: map[string]string{
+				"README":                  "",
+				"standard/1/collections":  "",
+				"standard/1/gates/family": "",
+			},
+			problems: []string{
+				`README: error: group is not a directory`,
+				`standard/1/collections: error: collections is not a directory`,
+				`standard/1/gates/family: error: family is not a directory`,
+			},
+			fixed: []string{
+				`README: error: group is not a directory`,
+				`standard/1/collections: error: collections is not a directory`,
+				`standard/1/gates/family: error: family is not a directory`,
+			},
+		},
+
+		{
+			scenario: "keys which are not supported by the format version of the database are reported",
+			files: map[string]string{
+				"standard/1/collections/workspaces":           "",
+				"standard/1/gates/family-A/gate-1/workspaces": "open\ttrue\nsalt\t1234\nvolume\t1\nend\t2021-06-01T00:00:00Z\n",
+			},
+			problems: []string{
+				`standard/1/gates/family-A/gate-1/workspaces:4: error: the "end" key requires format version 3, but the database uses version 1`,
+			},
+			fixed: []string{
+				`standard/1/gates/family-A/gate-1/workspaces:4: error: the "end" key requires format version 3, but the database uses version 1`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "feature")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			// Problems are reported on the resolved path of the mount point.
+			if tmp, err = filepath.EvalSymlinks(tmp); err != nil {
+				t.Fatal(err)
+			}
+			path := feature.MountPoint(tmp)
+
+			for name, content := range test.files {
+				p := filepath.Join(tmp, name)
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			problems := validate(t, path)
+			expectProblems(t, tmp, problems, test.problems)
+
+			for _, p := range problems {
+				if p.Fixable() {
+					if err := p.Fix(); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+
+			expectProblems(t, tmp, validate(t, path), test.fixed)
+		})
+	}
+}
+
+func validate(t testing.TB, path feature.MountPoint) []feature.Problem {
+	t.Helper()
+
+	problems, err := path.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return problems
+}
+
+func expectProblems(t testing.TB, root string, problems []feature.Problem, want []string) {
+	t.Helper()
+
+	found := make([]string, len(problems))
+	for i, p := range problems {
+		found[i] = strings.TrimPrefix(p.String(), root+"/")
+	}
+
+	if len(want) == 0 {
+		want = []string{}
+	}
+
+	if !reflect.DeepEqual(found, want) {
+		t.Error("problems mismatch")
+		t.Logf("want: %q", want)
+		t.Logf("got:  %q", found)
+	}
+}
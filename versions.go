@@ -0,0 +1,326 @@
+package feature
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// DefaultRetain is the default number of versions retained by Versions.
+const DefaultRetain = 10
+
+// Versions manages immutable versions of a feature database.
+//
+// Each version is stored in a directory of its own, and the mount point that
+// programs open the database from is a symbolic link to the current version.
+// Publishing and rolling back versions atomically replace the symbolic link,
+// which Store values detect to reload the database.
+//
+// Versions are immutable, programs must not modify them in place; new versions
+// can be constructed from the current one with a Builder and published with
+// its Publish method.
+type Versions struct {
+	// The symbolic link to the current version, which programs use as mount
+	// point to open the feature database.
+	Path MountPoint
+
+	// The directory where versions are stored. When empty, the directory is
+	// the path of the mount point with a ".versions" suffix.
+	Dir string
+
+	// The number of versions retained after publishing a new version. When
+	// zero, DefaultRetain is used. The current version is always retained.
+	Retain int
+}
+
+// Version represents a version of a feature database managed by Versions.
+type Version struct {
+	// The name of the version, which sorts in publishing order.
+	Name string
+
+	// The path to the directory where the version is stored.
+	Path string
+
+	// The time at which the version was published.
+	Time time.Time
+
+	// Set to true if the version is the one that the mount point points to.
+	Current bool
+}
+
+const versionTimeFormat = "20060102T150405.000000000Z"
+
+// Publish moves the database at dir to a new version, then makes it the
+// current version. Versions exceeding the retention count are deleted.
+//
+// The database is validated before being published. If dir is on a different
+// file system than the versions directory, it is copied instead of moved.
+func (v *Versions) Publish(dir string) (Version, error) {
+	if err := validate(MountPoint(dir)); err != nil {
+		return Version{}, fmt.Errorf("validating feature database at %s: %w", dir, err)
+	}
+
+	if err := os.MkdirAll(v.dir(), 0755); err != nil {
+		return Version{}, err
+	}
+
+	var ver Version
+	err := v.lock(func() (err error) {
+		ver, err = v.publish(dir)
+		return err
+	})
+	return ver, err
+}
+
+func (v *Versions) publish(dir string) (Version, error) {
+	now := time.Now().UTC()
+	ver := Version{
+		Name: now.Format(versionTimeFormat),
+		Time: now,
+	}
+	ver.Path = filepath.Join(v.dir(), ver.Name)
+
+	if err := os.Rename(dir, ver.Path); err != nil {
+		if !errors.Is(err, syscall.EXDEV) {
+			return Version{}, err
+		}
+		if err := copyDir(ver.Path, dir); err != nil {
+			return Version{}, err
+		}
+	}
+
+	if err := v.link(ver.Path); err != nil {
+		return Version{}, err
+	}
+
+	ver.Current = true
+	return ver, v.prune(ver.Name)
+}
+
+// List returns the list of versions, sorted from oldest to newest.
+func (v *Versions) List() ([]Version, error) {
+	current, err := v.current()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := filepath.Abs(v.dir())
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Version, 0, 16)
+	d := readdir(dir)
+	defer d.close()
+
+	for d.next() {
+		t, err := time.Parse(versionTimeFormat, d.name())
+		if err != nil {
+			continue // not a version
+		}
+		path := filepath.Join(dir, d.name())
+		list = append(list, Version{
+			Name:    d.name(),
+			Path:    path,
+			Time:    t,
+			Current: path == current,
+		})
+	}
+
+	if err := d.close(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+// Current returns the current version.
+func (v *Versions) Current() (Version, error) {
+	list, err := v.List()
+	if err != nil {
+		return Version{}, err
+	}
+	for _, ver := range list {
+		if ver.Current {
+			return ver, nil
+		}
+	}
+	return Version{}, fmt.Errorf("%s: no current version", v.Path)
+}
+
+// Rollback makes the version with the given name the current version. If the
+// name is empty, the version published before the current one is used.
+//
+// Rolling back does not delete any versions, so the program may roll forward
+// again by passing the name of a newer version.
+func (v *Versions) Rollback(name string) (Version, error) {
+	var ver Version
+	err := v.lock(func() (err error) {
+		ver, err = v.rollback(name)
+		return err
+	})
+	return ver, err
+}
+
+func (v *Versions) rollback(name string) (Version, error) {
+	list, err := v.List()
+	if err != nil {
+		return Version{}, err
+	}
+
+	i := -1
+	for j, ver := range list {
+		if name == "" && ver.Current {
+			i = j - 1
+			break
+		}
+		if name != "" && ver.Name == name {
+			i = j
+			break
+		}
+	}
+
+	if i < 0 {
+		if name == "" {
+			return Version{}, fmt.Errorf("%s: no previous version to roll back to", v.Path)
+		}
+		return Version{}, fmt.Errorf("%s: version does not exist: %s", v.Path, name)
+	}
+
+	ver := list[i]
+	if err := v.link(ver.Path); err != nil {
+		return Version{}, err
+	}
+	ver.Current = true
+	return ver, nil
+}
+
+func (v *Versions) dir() string {
+	if v.Dir != "" {
+		return v.Dir
+	}
+	return string(v.Path) + ".versions"
+}
+
+// lock calls do while holding an exclusive lock on the versions directory, so
+// concurrent publishers and rollbacks are serialized.
+func (v *Versions) lock(do func() error) error {
+	return withLock(filepath.Join(v.dir(), ".lock"), true, do)
+}
+
+func (v *Versions) retain() int {
+	if v.Retain > 0 {
+		return v.Retain
+	}
+	return DefaultRetain
+}
+
+// current returns the path to the directory that the mount point links to, or
+// an empty string if it does not exist.
+func (v *Versions) current() (string, error) {
+	link, err := os.Readlink(string(v.Path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if !filepath.IsAbs(link) {
+		link = filepath.Join(filepath.Dir(string(v.Path)), link)
+	}
+	return filepath.Abs(link)
+}
+
+// link atomically replaces the mount point with a symbolic link to target.
+func (v *Versions) link(target string) error {
+	path := string(v.Path)
+
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("%s: mount point exists and is not a symbolic link", path)
+	}
+
+	// Relative links remain valid if the parent directory of the mount point
+	// and versions is moved.
+	if rel, err := filepath.Rel(filepath.Dir(path), target); err == nil {
+		target = rel
+	}
+
+	tmp, err := ioutil.TempDir(filepath.Dir(path), "."+filepath.Base(path)+".link-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	link := filepath.Join(tmp, "link")
+	if err := os.Symlink(target, link); err != nil {
+		return err
+	}
+	return os.Rename(link, path)
+}
+
+// prune deletes the oldest versions exceeding the retention count, except the
+// current version.
+func (v *Versions) prune(current string) error {
+	list, err := v.List()
+	if err != nil {
+		return err
+	}
+
+	for i, n := 0, len(list)-v.retain(); i < n; i++ {
+		if ver := list[i]; !ver.Current && ver.Name != current {
+			if err := rmdir(ver.Path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Publish validates the staged database and publishes it as a new version.
+//
+// Builders of versioned databases must use Publish instead of Commit, since
+// committing would modify the current version in place.
+func (b *Builder) Publish(v *Versions) (Version, error) {
+	if b.done {
+		return Version{}, errBuilderDone
+	}
+	if err := b.seal(); err != nil {
+		return Version{}, err
+	}
+	ver, err := v.Publish(string(b.staging))
+	if err != nil {
+		return ver, err
+	}
+	b.done = true
+	return ver, nil
+}
+
+// copyDir copies the directory at src to dst through a temporary directory,
+// so dst is never observed in a partially copied state.
+func copyDir(dst, src string) error {
+	tmp, err := ioutil.TempDir(filepath.Dir(dst), "."+filepath.Base(dst)+".copy-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+	if err := copyTree(tmp, src); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	return rmdir(src)
+}
@@ -0,0 +1,189 @@
+package feature_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/feature"
+)
+
+func TestVersions(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, *feature.Versions)
+	}{
+		{
+			scenario: "publishing a version makes it the current version",
+			function: testVersionsPublish,
+		},
+
+		{
+			scenario: "versions exceeding the retention count are deleted",
+			function: testVersionsRetain,
+		},
+
+		{
+			scenario: "rolling back restores the previous version",
+			function: testVersionsRollback,
+		},
+
+		{
+			scenario: "builders publish new versions seeded from the current version",
+			function: testVersionsBuilderPublish,
+		},
+
+		{
+			scenario: "invalid databases are not published",
+			function: testVersionsPublishInvalid,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "feature")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+			test.function(t, &feature.Versions{
+				Path:   feature.MountPoint(filepath.Join(tmp, "features")),
+				Retain: 2,
+			})
+		})
+	}
+}
+
+func testVersionsPublish(t *testing.T, v *feature.Versions) {
+	ver := publishVersion(t, v, "gate-1")
+
+	if !ver.Current {
+		t.Error("published version is not current")
+	}
+	expectCurrentVersion(t, v, ver.Name)
+	expectCacheGateOpened(t, v.Path, "family-A", "gate-1", "workspaces", "id-1", true)
+}
+
+func testVersionsRetain(t *testing.T, v *feature.Versions) {
+	publishVersion(t, v, "gate-1")
+	ver2 := publishVersion(t, v, "gate-2")
+	ver3 := publishVersion(t, v, "gate-3")
+
+	expectVersions(t, v, []string{ver2.Name, ver3.Name})
+	expectCacheGateOpened(t, v.Path, "family-A", "gate-3", "workspaces", "id-1", true)
+}
+
+func testVersionsRollback(t *testing.T, v *feature.Versions) {
+	ver1 := publishVersion(t, v, "gate-1")
+	ver2 := publishVersion(t, v, "gate-2")
+
+	ver, err := v.Rollback("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ver.Name != ver1.Name {
+		t.Errorf("rolled back to the wrong version: want %s, got %s", ver1.Name, ver.Name)
+	}
+	expectCurrentVersion(t, v, ver1.Name)
+	expectCacheGateOpened(t, v.Path, "family-A", "gate-2", "workspaces", "id-1", false)
+
+	if _, err := v.Rollback(""); err == nil {
+		t.Error("rolling back past the first version did not return an error")
+	}
+
+	if _, err := v.Rollback(ver2.Name); err != nil {
+		t.Fatal(err)
+	}
+	expectCurrentVersion(t, v, ver2.Name)
+	expectCacheGateOpened(t, v.Path, "family-A", "gate-2", "workspaces", "id-1", true)
+}
+
+func testVersionsBuilderPublish(t *testing.T, v *feature.Versions) {
+	ver1 := publishVersion(t, v, "gate-1")
+
+	b, err := v.Path.NewBuilderFrom(v.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Abort()
+
+	if err := b.EnableGate("standard", "1", "family-A", "gate-1", "workspaces", 0.0, false); err != nil {
+		t.Fatal(err)
+	}
+
+	ver2, err := b.Publish(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectVersions(t, v, []string{ver1.Name, ver2.Name})
+	expectCacheGateOpened(t, v.Path, "family-A", "gate-1", "workspaces", "id-1", false)
+	expectCacheGateOpened(t, feature.MountPoint(ver1.Path), "family-A", "gate-1", "workspaces", "id-1", true)
+}
+
+func testVersionsPublishInvalid(t *testing.T, v *feature.Versions) {
+	dir := filepath.Join(filepath.Dir(string(v.Path)), "invalid")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	tier := createTier(t, feature.MountPoint(dir), "standard", "1")
+	createGate(t, tier, "family-A", "gate-1", "workspaces", 1234)
+
+	gatePath := filepath.Join(dir, "standard", "1", "gates", "family-A", "gate-1", "workspaces")
+	if err := ioutil.WriteFile(gatePath, []byte("open\tmaybe\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.Publish(dir); err == nil {
+		t.Error("publishing an invalid database did not return an error")
+	}
+	expectVersions(t, v, []string{})
+}
+
+func publishVersion(t testing.TB, v *feature.Versions, gate string) feature.Version {
+	t.Helper()
+
+	b := newBuilder(t, feature.MountPoint(filepath.Join(filepath.Dir(string(v.Path)), "build")))
+	defer b.Abort()
+	buildGate(t, b, "standard", "1", "family-A", gate, "workspaces", 1.0, []string{"id-1"})
+
+	ver, err := b.Publish(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ver
+}
+
+func expectCurrentVersion(t testing.TB, v *feature.Versions, name string) {
+	t.Helper()
+
+	ver, err := v.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ver.Name != name {
+		t.Errorf("current version mismatch: want %s, got %s", name, ver.Name)
+	}
+}
+
+func expectVersions(t testing.TB, v *feature.Versions, names []string) {
+	t.Helper()
+
+	list, err := v.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := []string{}
+	for _, ver := range list {
+		found = append(found, ver.Name)
+	}
+
+	if !reflect.DeepEqual(found, names) {
+		t.Error("versions mismatch")
+		t.Logf("want: %q", names)
+		t.Logf("got:  %q", found)
+	}
+}